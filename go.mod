@@ -2,7 +2,10 @@ module polyglot
 
 go 1.24.2
 
-require bpe v0.0.0
+require (
+	bpe v0.0.0
+	normalize v0.0.0
+)
 
 require (
 	github.com/aws/aws-sdk-go-v2 v1.36.3 // indirect
@@ -23,8 +26,9 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.30.1 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.33.18 // indirect
 	github.com/aws/smithy-go v1.22.2 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/text v0.23.0 // indirect
-	normalize v0.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 replace (
@@ -10,22 +10,60 @@ import (
 // main function initializes the application and starts the training process.
 func main() {
 	// get a function
-	psFunction := flag.String("func", "", "Configuration File")
+	psFunction := flag.String("func", "", "Function to run: t (train), v (vocabulary size), e (export to tokenizer.json), i (import a vocabulary), b (convert between JSON and binary artifacts), or empty to serve")
+	psConfig := flag.String("config", "", "Training configuration file (JSON or YAML)")
+	psArtifact := flag.String("artifact", "artifacts/merges.json", "Merges artifact to serve or inspect")
+	piCache := flag.Int("cache", 0, "Number of chunk encodings the server caches (0 disables the cache)")
+	psOutput := flag.String("output", "", "Path of the exported tokenizer.json (default tokenizer.json), or of the imported or converted artifact")
+	psTemplate := flag.String("template", "", "Template of the artifact to export as the post-processor")
+	psSample := flag.String("sample", "", "Sample corpus (JSON of languages to sentences) to record expected tokens for")
+	psVocab := flag.String("vocab", "", "GPT-2 vocab.json or Hugging Face tokenizer.json to import")
+	psMerges := flag.String("merges", "", "GPT-2 merges.txt to import along with -vocab")
 	flag.Parse()
 
+	// load the training configuration, falling back to the original defaults
+	pdConfig := bpe.DefaultTrainingConfig()
+	if *psConfig != "" {
+		var err error
+		pdConfig, err = bpe.LoadTrainingConfig(*psConfig)
+		if err != nil {
+			fmt.Println("Error loading configuration:", err)
+			return
+		}
+	}
+
 	// execute the instruction
 	if *psFunction == "t" {
 		// train mode
-		if err := bpe.Train(); err != nil {
+		if err := bpe.Train(pdConfig); err != nil {
 			fmt.Println("Error during training:", err)
 		}
 	} else if *psFunction == "v" {
 		// get vocabulary size
-		if err := bpe.GetVocabularySize(); err != nil {
+		if err := bpe.GetVocabularySize(pdConfig, *psArtifact); err != nil {
 			fmt.Println("Error while calculating vocabulary suze:", err)
 		}
+	} else if *psFunction == "e" {
+		// export to Hugging Face
+		sOutput := *psOutput
+		if sOutput == "" {
+			sOutput = "tokenizer.json"
+		}
+		if err := bpe.ExportHuggingFace(*psArtifact, *psTemplate, sOutput, *psSample); err != nil {
+			fmt.Println("Error during export:", err)
+		}
+	} else if *psFunction == "i" {
+		// import a third-party vocabulary
+		if err := bpe.ImportVocabulary(*psVocab, *psMerges, *psOutput); err != nil {
+			fmt.Println("Error during import:", err)
+		}
+	} else if *psFunction == "b" {
+		// convert the artifact to or from the binary format
+		if err := bpe.ConvertArtifact(*psArtifact, *psOutput); err != nil {
+			fmt.Println("Error during conversion:", err)
+		}
 	} else {
 		// api mode
-		server.Launch()
+		server.Launch(*psArtifact, *piCache)
 	}
 }
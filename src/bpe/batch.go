@@ -0,0 +1,108 @@
+package bpe
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// EncodeResult is the encoding of one input of a batch
+type EncodeResult struct {
+	Tokens []int64
+	Err    error
+}
+
+// DecodeResult is the decoding of one token list of a batch
+type DecodeResult struct {
+	Text string
+	Err  error
+}
+
+// EncodeBatch encodes every input on a pool of iWorkers goroutines, or one per CPU when iWorkers is
+// zero or less. Results are in input order. Once the context is done no further input is started;
+// those inputs carry the context's error, which is also returned.
+func (t *Tokenizer) EncodeBatch(dataContext context.Context, asInputs []string, iWorkers int) ([]EncodeResult, error) {
+	aResults := make([]EncodeResult, len(asInputs))
+	err := runBatch(dataContext, len(asInputs), iWorkers, func(iIndex int) {
+		aResults[iIndex].Tokens = t.Encode(asInputs[iIndex])
+	}, func(iIndex int, err error) {
+		aResults[iIndex].Err = err
+	})
+	return aResults, err
+}
+
+// CountBatch counts the tokens of every input on a pool of workers, like EncodeBatch. Inputs that
+// were not counted because the context was done have a count of -1.
+func (t *Tokenizer) CountBatch(dataContext context.Context, asInputs []string, iWorkers int) ([]int, error) {
+	aiCounts := make([]int, len(asInputs))
+	err := runBatch(dataContext, len(asInputs), iWorkers, func(iIndex int) {
+		aiCounts[iIndex] = t.Count(asInputs[iIndex])
+	}, func(iIndex int, err error) {
+		aiCounts[iIndex] = -1
+	})
+	return aiCounts, err
+}
+
+// DecodeBatch decodes every token list on a pool of iWorkers goroutines, like EncodeBatch. A token
+// list that fails to decode only sets the error of its own result.
+func (t *Tokenizer) DecodeBatch(dataContext context.Context, aalTokens [][]int64, iWorkers int) ([]DecodeResult, error) {
+	aResults := make([]DecodeResult, len(aalTokens))
+	err := runBatch(dataContext, len(aalTokens), iWorkers, func(iIndex int) {
+		aResults[iIndex].Text, aResults[iIndex].Err = t.Decode(aalTokens[iIndex])
+	}, func(iIndex int, err error) {
+		aResults[iIndex].Err = err
+	})
+	return aResults, err
+}
+
+// runBatch calls fnItem for every index on a pool of workers and fnCancel for every index that was
+// not started before the context was done
+func runBatch(dataContext context.Context, iItems int, iWorkers int, fnItem func(int), fnCancel func(int, error)) error {
+	if iWorkers <= 0 {
+		iWorkers = runtime.GOMAXPROCS(0)
+	}
+	iWorkers = min(iWorkers, iItems)
+
+	// workers take indices until the channel is closed, skipping them once the context is done
+	chIndices := make(chan int)
+	var dWg sync.WaitGroup
+	var tfCancelled atomic.Bool
+	for range iWorkers {
+		dWg.Add(1)
+		go func() {
+			defer dWg.Done()
+			for iIndex := range chIndices {
+				if err := dataContext.Err(); err != nil {
+					tfCancelled.Store(true)
+					fnCancel(iIndex, err)
+					continue
+				}
+				fnItem(iIndex)
+			}
+		}()
+	}
+
+	// hand out indices until the context is done
+	iIndex := 0
+send:
+	for ; iIndex < iItems; iIndex++ {
+		select {
+		case chIndices <- iIndex:
+		case <-dataContext.Done():
+			break send
+		}
+	}
+	close(chIndices)
+	dWg.Wait()
+
+	// inputs that were never handed out are cancelled too
+	for ; iIndex < iItems; iIndex++ {
+		tfCancelled.Store(true)
+		fnCancel(iIndex, dataContext.Err())
+	}
+	if tfCancelled.Load() {
+		return dataContext.Err()
+	}
+	return nil
+}
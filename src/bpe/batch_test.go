@@ -0,0 +1,41 @@
+package bpe
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestCountBatch checks that CountBatch gives the length of every encoding in input order for any number of
+// workers, and -1 with the context's error for inputs it did not start
+func TestCountBatch(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, PreTokenizerWhitespace))
+	asInputs := append(testTexts(t), "", "the other", sStreamText)
+	aiExpected := make([]int, len(asInputs))
+	for iIndex, sInput := range asInputs {
+		aiExpected[iIndex] = len(pdTokenizer.Encode(sInput))
+	}
+
+	for _, iWorkers := range []int{0, -1, 1, 3, len(asInputs) + 10} {
+		for _, pdVariant := range []*Tokenizer{pdTokenizer, pdTokenizer.WithCache(16)} {
+			aiCounts, err := pdVariant.CountBatch(context.Background(), asInputs, iWorkers)
+			if err != nil || !slices.Equal(aiCounts, aiExpected) {
+				t.Errorf("%d workers: got %v, %v, want %v", iWorkers, aiCounts, err, aiExpected)
+			}
+		}
+	}
+	if aiCounts, err := pdTokenizer.CountBatch(context.Background(), nil, 4); err != nil || len(aiCounts) != 0 {
+		t.Errorf("empty batch: got %v, %v", aiCounts, err)
+	}
+
+	dataContext, fnCancel := context.WithCancel(context.Background())
+	fnCancel()
+	aiCounts, err := pdTokenizer.CountBatch(dataContext, asInputs, 2)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled batch: got error %v", err)
+	}
+	if !slices.Equal(aiCounts, slices.Repeat([]int{-1}, len(asInputs))) {
+		t.Errorf("cancelled batch counted inputs: %v", aiCounts)
+	}
+}
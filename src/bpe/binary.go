@@ -0,0 +1,550 @@
+package bpe
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Binary artifacts hold the vocabulary of an artifact in tables that are searched where they lie,
+// so a memory-mapped file is ready as soon as its checksum and tables are verified. Every integer
+// is a little-endian uint32:
+//
+//	magic "PGLB" and layout version
+//	alphabet size, number of minted tokens and length in bytes of the longest piece
+//	first id of the token table, size of a merge record, and position of the first minted token
+//	offset and length of the metadata, merges, offsets, ranks, index and texts sections, then 4
+//	reserved bytes
+//	metadata: the artifact as JSON, without its merges and ordering
+//	merges:   left, right and merged token of every merge, sorted by pair; the rank follows them
+//	          when a token is minted by more than one merge
+//	offsets:  where the text of every id from the first one starts, then where the last one ends
+//	ranks:    merge rank + 1 of every id, 0 when no merge mints it and 0xFFFFFFFF when nothing
+//	          spells it; left out when minted tokens follow each other in merge order
+//	index:    positions in the token table, sorted by text and then id
+//	texts:    the texts of the tokens back to back
+//	CRC-32C of everything before it
+const (
+	sBinaryMagic  = "PGLB"
+	iBinaryLayout = 1
+	iBinaryHeader = 84
+)
+
+// sections of a binary artifact, in file order
+const (
+	iSectionMetadata = iota
+	iSectionMerges
+	iSectionOffsets
+	iSectionRanks
+	iSectionIndex
+	iSectionTexts
+	iSections
+)
+
+// sizes of merge records without and with their rank
+const (
+	iMergeRecord       = 12
+	iRankedMergeRecord = 16
+)
+
+// lUnspelled marks the ranks of ids between the first and last that nothing spells out
+const lUnspelled = math.MaxUint32
+
+// unused ids the token table is allowed to hold between the first and last spelled-out ones
+const iMaxUnusedIDs = 1 << 22
+
+// ErrCorruptArtifact is returned for binary artifacts that are truncated, fail their checksum or
+// have inconsistent sections
+var ErrCorruptArtifact = errors.New("bpe: binary artifact is corrupt")
+
+// checksum table of binary artifacts
+var pdCastagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// tokenTable is the vocabulary of a tokenizer laid out as in a binary artifact: merges sorted for
+// binary search, and the texts and ranks of every id from the first spelled-out one. JSON artifacts
+// are laid out the same way when they are loaded, so both are looked up alike.
+type tokenTable struct {
+	abMerges     []byte
+	iMergeSize   int
+	abOffsets    []byte
+	abRanks      []byte
+	abIndex      []byte
+	sTexts       string
+	lFirstID     int64
+	iTokens      int
+	iFirstMinted int
+	iAlphabet    int
+	iMinted      int
+	iMaxPiece    int
+}
+
+// uint32At reads the iIndex-th integer of a section
+func uint32At(abSection []byte, iIndex int) int64 {
+	return int64(binary.LittleEndian.Uint32(abSection[4*iIndex:]))
+}
+
+// merges returns the number of merges
+func (t *tokenTable) merges() int {
+	return len(t.abMerges) / t.iMergeSize
+}
+
+// mergeField reads a field of a merge record: the left token, right token, merged token or rank
+func (t *tokenTable) mergeField(iRecord int, iField int) int64 {
+	return uint32At(t.abMerges, iRecord*t.iMergeSize/4+iField)
+}
+
+// tokenRank returns the merge rank + 1 of the token at a position, 0 for tokens no merge mints and
+// lUnspelled for unused ids
+func (t *tokenTable) tokenRank(iPosition int) int64 {
+	if len(t.abRanks) > 0 {
+		return uint32At(t.abRanks, iPosition)
+	}
+	if iPosition >= t.iFirstMinted && iPosition < t.iFirstMinted+t.merges() {
+		return int64(iPosition-t.iFirstMinted) + 1
+	}
+	return 0
+}
+
+// recordRank returns the rank of a merge record, which is that of the token it mints unless the
+// records carry their own
+func (t *tokenTable) recordRank(iRecord int) int64 {
+	if t.iMergeSize == iRankedMergeRecord {
+		return t.mergeField(iRecord, 3)
+	}
+	iPosition, _ := t.position(t.mergeField(iRecord, 2))
+	return t.tokenRank(iPosition) - 1
+}
+
+// rule finds the merge of a pair of tokens
+func (t *tokenTable) rule(lLeft int64, lRight int64) (mergeRule, bool) {
+	iLow, iHigh := 0, t.merges()
+	for iLow < iHigh {
+		iMiddle := int(uint(iLow+iHigh) >> 1)
+		lMiddleLeft := t.mergeField(iMiddle, 0)
+		if lMiddleLeft < lLeft || (lMiddleLeft == lLeft && t.mergeField(iMiddle, 1) < lRight) {
+			iLow = iMiddle + 1
+		} else {
+			iHigh = iMiddle
+		}
+	}
+	if iLow == t.merges() || t.mergeField(iLow, 0) != lLeft || t.mergeField(iLow, 1) != lRight {
+		return mergeRule{}, false
+	}
+	return mergeRule{lRank: t.recordRank(iLow), lToken: t.mergeField(iLow, 2)}, true
+}
+
+// ordering lists the merges in rank order
+func (t *tokenTable) ordering() [][2]int64 {
+	aaOrdering := make([][2]int64, t.merges())
+	for iRecord := range t.merges() {
+		aaOrdering[t.recordRank(iRecord)] = [2]int64{t.mergeField(iRecord, 0), t.mergeField(iRecord, 1)}
+	}
+	return aaOrdering
+}
+
+// position returns where an id lies in the token table, if something spells it out
+func (t *tokenTable) position(lID int64) (int, bool) {
+	lPosition := lID - t.lFirstID
+	if lPosition < 0 || lPosition >= int64(t.iTokens) || t.tokenRank(int(lPosition)) == lUnspelled {
+		return 0, false
+	}
+	return int(lPosition), true
+}
+
+// positionText returns the text of the token at a position of the token table
+func (t *tokenTable) positionText(iPosition int) string {
+	return t.sTexts[uint32At(t.abOffsets, iPosition):uint32At(t.abOffsets, iPosition+1)]
+}
+
+// text returns the text of a special token, base unit, byte or minted token
+func (t *tokenTable) text(lID int64) (string, bool) {
+	iPosition, tfOK := t.position(lID)
+	if !tfOK {
+		return "", false
+	}
+	return t.positionText(iPosition), true
+}
+
+// mergeRank returns the position of a minted token in the merge order, counting from 1
+func (t *tokenTable) mergeRank(lID int64) (int64, bool) {
+	iPosition, tfOK := t.position(lID)
+	if !tfOK || t.tokenRank(iPosition) == 0 {
+		return 0, false
+	}
+	return t.tokenRank(iPosition), true
+}
+
+// id returns the first id that spells a text
+func (t *tokenTable) id(sText string) (int64, bool) {
+	iEntries := len(t.abIndex) / 4
+	fnPosition := func(iEntry int) int {
+		return int(uint32At(t.abIndex, iEntry))
+	}
+	iLow, iHigh := 0, iEntries
+	for iLow < iHigh {
+		iMiddle := int(uint(iLow+iHigh) >> 1)
+		if t.positionText(fnPosition(iMiddle)) < sText {
+			iLow = iMiddle + 1
+		} else {
+			iHigh = iMiddle
+		}
+	}
+	if iLow == iEntries || t.positionText(fnPosition(iLow)) != sText {
+		return 0, false
+	}
+	return t.lFirstID + int64(fnPosition(iLow)), true
+}
+
+// maxPiece returns the length in bytes of the longest text of a token other than a special token,
+// which stands only for its name
+func (t *tokenTable) maxPiece(mapSpecialTokens map[string]int64) int {
+	iMaxPiece := 0
+	for iEntry := range len(t.abIndex) / 4 {
+		iPosition := int(uint32At(t.abIndex, iEntry))
+		sText := t.positionText(iPosition)
+		if iEntry > 0 && t.positionText(int(uint32At(t.abIndex, iEntry-1))) == sText {
+			continue
+		}
+		if lSpecial, tfOK := mapSpecialTokens[sText]; !tfOK || lSpecial != t.lFirstID+int64(iPosition) {
+			iMaxPiece = max(iMaxPiece, len(sText))
+		}
+	}
+	return iMaxPiece
+}
+
+// check verifies everything lookups rely on, so a corrupt table is refused when it is loaded
+// rather than failing in a lookup
+func (t *tokenTable) check(mapSpecialTokens map[string]int64) error {
+	// texts lie in order within the texts section
+	for iPosition := range t.iTokens {
+		if uint32At(t.abOffsets, iPosition) > uint32At(t.abOffsets, iPosition+1) {
+			return fmt.Errorf("text of id %d ends before it starts", t.lFirstID+int64(iPosition))
+		}
+	}
+	if uint32At(t.abOffsets, t.iTokens) > int64(len(t.sTexts)) {
+		return errors.New("texts run past the texts section")
+	}
+
+	// minted tokens each have their own rank
+	abTokenRanks := make([]bool, t.merges())
+	iSpelled, iMinted := 0, 0
+	for iPosition := range t.iTokens {
+		lRank := t.tokenRank(iPosition)
+		if lRank == lUnspelled {
+			continue
+		}
+		iSpelled++
+		if lRank == 0 {
+			continue
+		}
+		if lRank > int64(t.merges()) || abTokenRanks[lRank-1] {
+			return fmt.Errorf("id %d has rank %d, which is out of range or repeated", t.lFirstID+int64(iPosition), lRank-1)
+		}
+		abTokenRanks[lRank-1] = true
+		iMinted++
+	}
+	if iMinted != t.iMinted {
+		return fmt.Errorf("header counts %d minted tokens, the token table %d", t.iMinted, iMinted)
+	}
+
+	// merges are sorted by pair, mint a token first minted no later, and each has its own rank
+	abRanks := make([]bool, t.merges())
+	for iRecord := range t.merges() {
+		if iRecord > 0 && cmp.Or(cmp.Compare(t.mergeField(iRecord-1, 0), t.mergeField(iRecord, 0)), cmp.Compare(t.mergeField(iRecord-1, 1), t.mergeField(iRecord, 1))) >= 0 {
+			return fmt.Errorf("merge %d is not sorted by pair", iRecord)
+		}
+		iPosition, tfOK := t.position(t.mergeField(iRecord, 2))
+		if !tfOK || t.tokenRank(iPosition) == 0 {
+			return fmt.Errorf("merge %d mints id %d, which has no rank", iRecord, t.mergeField(iRecord, 2))
+		}
+		lRank := t.recordRank(iRecord)
+		if lRank >= int64(t.merges()) || abRanks[lRank] || t.tokenRank(iPosition)-1 > lRank {
+			return fmt.Errorf("merge %d has rank %d, which is out of range, repeated or before its token's", iRecord, lRank)
+		}
+		abRanks[lRank] = true
+	}
+
+	// the index lists every spelled-out token once, sorted by text and then id
+	if len(t.abIndex)/4 != iSpelled {
+		return fmt.Errorf("index has %d entries for %d tokens", len(t.abIndex)/4, iSpelled)
+	}
+	for iEntry := range iSpelled {
+		iPosition := uint32At(t.abIndex, iEntry)
+		if iPosition >= int64(t.iTokens) || t.tokenRank(int(iPosition)) == lUnspelled {
+			return fmt.Errorf("index entry %d points to position %d, where no token is spelled out", iEntry, iPosition)
+		}
+		if iEntry == 0 {
+			continue
+		}
+		iPrevious := uint32At(t.abIndex, iEntry-1)
+		if cmp.Or(strings.Compare(t.positionText(int(iPrevious)), t.positionText(int(iPosition))), cmp.Compare(iPrevious, iPosition)) >= 0 {
+			return fmt.Errorf("index entry %d is not sorted by text", iEntry)
+		}
+	}
+
+	if iMaxPiece := t.maxPiece(mapSpecialTokens); iMaxPiece != t.iMaxPiece {
+		return fmt.Errorf("header gives the longest piece as %d bytes, the tokens %d", t.iMaxPiece, iMaxPiece)
+	}
+	return nil
+}
+
+// newTokenTable lays out the vocabulary of a decoded artifact as a binary artifact stores it
+func newTokenTable(pdArtifact *artifact, mapRanks map[[2]int64]int64, mapDecoder map[int64]string) (*tokenTable, error) {
+	// merges sorted by pair, ranked by the order their pairs first appear in the ordering
+	aalMerges := make([][4]int64, 0, len(pdArtifact.Ordering))
+	mapMergeRanks := make(map[int64]int64, len(pdArtifact.Ordering))
+	mapSeen := make(map[[2]int64]bool, len(pdArtifact.Ordering))
+	pdTable := &tokenTable{iMergeSize: iMergeRecord, iAlphabet: pdArtifact.alphabetSize()}
+	for _, alPair := range pdArtifact.Ordering {
+		if mapSeen[alPair] {
+			continue
+		}
+		mapSeen[alPair] = true
+		lToken := mapRanks[alPair]
+		if _, tfOK := mapMergeRanks[lToken]; tfOK {
+			pdTable.iMergeSize = iRankedMergeRecord
+		} else {
+			mapMergeRanks[lToken] = int64(len(aalMerges)) + 1
+		}
+		aalMerges = append(aalMerges, [4]int64{alPair[0], alPair[1], lToken, int64(len(aalMerges))})
+	}
+	slices.SortFunc(aalMerges, func(alA [4]int64, alB [4]int64) int {
+		return cmp.Or(cmp.Compare(alA[0], alB[0]), cmp.Compare(alA[1], alB[1]))
+	})
+	pdTable.iMinted = len(mapMergeRanks)
+
+	// the token table has a place for every id from the lowest spelled-out one to the highest
+	alIDs := slices.Sorted(maps.Keys(mapDecoder))
+	if len(alIDs) > 0 {
+		if alIDs[0] < 0 || alIDs[len(alIDs)-1] > math.MaxUint32 {
+			return nil, fmt.Errorf("binary artifacts hold ids from 0 to %d, got %d to %d", uint32(math.MaxUint32), alIDs[0], alIDs[len(alIDs)-1])
+		}
+		if lUnused := alIDs[len(alIDs)-1] - alIDs[0] + 1 - int64(len(alIDs)); lUnused > iMaxUnusedIDs {
+			return nil, fmt.Errorf("ids %d to %d leave %d unused ids, more than the %d a token table holds", alIDs[0], alIDs[len(alIDs)-1], lUnused, iMaxUnusedIDs)
+		}
+		pdTable.lFirstID = alIDs[0]
+		pdTable.iTokens = int(alIDs[len(alIDs)-1]-alIDs[0]) + 1
+	}
+	alOffsets := make([]int64, pdTable.iTokens+1)
+	alRanks := make([]int64, pdTable.iTokens)
+	aiPositions := make([]int, 0, len(alIDs))
+	var dTexts strings.Builder
+	for iPosition := range pdTable.iTokens {
+		alOffsets[iPosition] = int64(dTexts.Len())
+		sText, tfOK := mapDecoder[pdTable.lFirstID+int64(iPosition)]
+		if !tfOK {
+			alRanks[iPosition] = lUnspelled
+			continue
+		}
+		dTexts.WriteString(sText)
+		alRanks[iPosition] = mapMergeRanks[pdTable.lFirstID+int64(iPosition)]
+		aiPositions = append(aiPositions, iPosition)
+	}
+	alOffsets[pdTable.iTokens] = int64(dTexts.Len())
+	pdTable.sTexts = dTexts.String()
+	var err error
+	if pdTable.abOffsets, err = packIntegers(alOffsets); err != nil {
+		return nil, err
+	}
+
+	// ranks are left out when every id is spelled out and minted tokens follow each other in merge order
+	tfImplied := pdTable.iMergeSize == iMergeRecord && len(alIDs) == pdTable.iTokens
+	for _, alMerge := range aalMerges {
+		if alMerge[3] == 0 {
+			pdTable.iFirstMinted = int(alMerge[2] - pdTable.lFirstID)
+		}
+	}
+	for _, alMerge := range aalMerges {
+		tfImplied = tfImplied && alMerge[2]-pdTable.lFirstID == int64(pdTable.iFirstMinted)+alMerge[3]
+	}
+	if !tfImplied {
+		pdTable.iFirstMinted = 0
+		if pdTable.abRanks, err = packIntegers(alRanks); err != nil {
+			return nil, err
+		}
+	}
+
+	// the index sorts texts, and equal texts by id since positions follow ids
+	slices.SortFunc(aiPositions, func(iA int, iB int) int {
+		return cmp.Or(strings.Compare(pdTable.positionText(iA), pdTable.positionText(iB)), cmp.Compare(iA, iB))
+	})
+	alIndex := make([]int64, len(aiPositions))
+	for iEntry, iPosition := range aiPositions {
+		alIndex[iEntry] = int64(iPosition)
+	}
+	if pdTable.abIndex, err = packIntegers(alIndex); err != nil {
+		return nil, err
+	}
+	alMerges := make([]int64, 0, pdTable.iMergeSize/4*len(aalMerges))
+	for _, alMerge := range aalMerges {
+		alMerges = append(alMerges, alMerge[:pdTable.iMergeSize/4]...)
+	}
+	if pdTable.abMerges, err = packIntegers(alMerges); err != nil {
+		return nil, err
+	}
+	pdTable.iMaxPiece = pdTable.maxPiece(pdArtifact.SpecialTokens)
+	return pdTable, nil
+}
+
+// packIntegers writes integers as little-endian uint32
+func packIntegers(alValues []int64) ([]byte, error) {
+	abSection := make([]byte, 0, 4*len(alValues))
+	for _, lValue := range alValues {
+		if lValue < 0 || lValue > math.MaxUint32 {
+			return nil, fmt.Errorf("binary artifacts hold ids and offsets up to %d, got %d", uint32(math.MaxUint32), lValue)
+		}
+		abSection = binary.LittleEndian.AppendUint32(abSection, uint32(lValue))
+	}
+	return abSection, nil
+}
+
+// MarshalBinary writes the tokenizer as a binary artifact, which LoadTokenizer memory-maps
+func (t *Tokenizer) MarshalBinary() ([]byte, error) {
+	dataMetadata := *t.pdArtifact
+	dataMetadata.Merges = nil
+	dataMetadata.Ordering = nil
+	abMetadata, err := json.Marshal(&dataMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal artifact metadata: %w", err)
+	}
+
+	// header, then the sections back to back
+	aabSections := [iSections][]byte{abMetadata, t.pdTable.abMerges, t.pdTable.abOffsets, t.pdTable.abRanks, t.pdTable.abIndex, []byte(t.pdTable.sTexts)}
+	iSize := iBinaryHeader + 4
+	for _, abSection := range aabSections {
+		iSize += len(abSection)
+	}
+	abData := make([]byte, 0, iSize)
+	abData = append(abData, sBinaryMagic...)
+	for _, iValue := range []int{iBinaryLayout, t.pdTable.iAlphabet, t.pdTable.iMinted, t.pdTable.iMaxPiece, int(t.pdTable.lFirstID), t.pdTable.iMergeSize, t.pdTable.iFirstMinted} {
+		abData = binary.LittleEndian.AppendUint32(abData, uint32(iValue))
+	}
+	iOffset := iBinaryHeader
+	for _, abSection := range aabSections {
+		abData = binary.LittleEndian.AppendUint32(abData, uint32(iOffset))
+		abData = binary.LittleEndian.AppendUint32(abData, uint32(len(abSection)))
+		iOffset += len(abSection)
+	}
+	abData = append(abData, make([]byte, iBinaryHeader-len(abData))...)
+	for _, abSection := range aabSections {
+		abData = append(abData, abSection...)
+	}
+	if len(abData) > math.MaxUint32 {
+		return nil, fmt.Errorf("binary artifacts hold up to %d bytes, got %d", uint32(math.MaxUint32), len(abData))
+	}
+	return binary.LittleEndian.AppendUint32(abData, crc32.Checksum(abData, pdCastagnoli)), nil
+}
+
+// jsonArtifact returns the artifact with the merges and ordering that binary artifacts keep in
+// their tables
+func (t *Tokenizer) jsonArtifact() *artifact {
+	if t.pdArtifact.Ordering != nil {
+		return t.pdArtifact
+	}
+	pdArtifact := *t.pdArtifact
+	pdArtifact.Ordering = t.pdTable.ordering()
+	pdArtifact.Merges = make(map[string]int64, len(pdArtifact.Ordering))
+	for _, alPair := range pdArtifact.Ordering {
+		dataRule, _ := t.pdTable.rule(alPair[0], alPair[1])
+		pdArtifact.Merges[keyToString(alPair)] = dataRule.lToken
+	}
+	return &pdArtifact
+}
+
+// isBinaryArtifact checks for the magic number of binary artifacts
+func isBinaryArtifact(abData []byte) bool {
+	return len(abData) >= len(sBinaryMagic) && string(abData[:len(sBinaryMagic)]) == sBinaryMagic
+}
+
+// newBinaryTokenizer uses the tables of a binary artifact where they lie; only the texts and the
+// metadata are copied out, so abData must stay unchanged for as long as the tokenizer is used
+func newBinaryTokenizer(abData []byte) (*Tokenizer, error) {
+	if len(abData) < iBinaryHeader+4 {
+		return nil, fmt.Errorf("%w: %d bytes is shorter than the header", ErrCorruptArtifact, len(abData))
+	}
+	fnHeader := func(iField int) int {
+		return int(binary.LittleEndian.Uint32(abData[4+4*iField:]))
+	}
+	if iLayout := fnHeader(0); iLayout != iBinaryLayout {
+		return nil, fmt.Errorf("%w: binary layout is version %d, this reader supports version %d", ErrUnsupportedVersion, iLayout, iBinaryLayout)
+	}
+	iEnd := len(abData) - 4
+	if crc32.Checksum(abData[:iEnd], pdCastagnoli) != binary.LittleEndian.Uint32(abData[iEnd:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptArtifact)
+	}
+
+	// every section has to lie within the file, and tables have to be whole and agree in length
+	var aabSections [iSections][]byte
+	for iSection := range aabSections {
+		iOffset, iLength := fnHeader(7+2*iSection), fnHeader(8+2*iSection)
+		if iOffset < iBinaryHeader || iOffset > iEnd || iLength > iEnd-iOffset {
+			return nil, fmt.Errorf("%w: section %d lies outside the file", ErrCorruptArtifact, iSection)
+		}
+		aabSections[iSection] = abData[iOffset : iOffset+iLength]
+	}
+	iMergeSize := fnHeader(5)
+	if iMergeSize != iMergeRecord && iMergeSize != iRankedMergeRecord {
+		return nil, fmt.Errorf("%w: merge records of %d bytes", ErrCorruptArtifact, iMergeSize)
+	}
+	iTokens := len(aabSections[iSectionOffsets])/4 - 1
+	iRanks := len(aabSections[iSectionRanks])
+	if len(aabSections[iSectionMerges])%iMergeSize != 0 || len(aabSections[iSectionOffsets])%4 != 0 || len(aabSections[iSectionIndex])%4 != 0 || iTokens < 0 || (iRanks != 0 && iRanks != 4*iTokens) {
+		return nil, fmt.Errorf("%w: tables hold partial records", ErrCorruptArtifact)
+	}
+	if len(aabSections[iSectionMerges]) == 0 {
+		return nil, errors.New(`"ordering" map has no merges`)
+	}
+	if iRanks == 0 && (iMergeSize != iMergeRecord || fnHeader(6) > iTokens-len(aabSections[iSectionMerges])/iMergeSize) {
+		return nil, fmt.Errorf("%w: minted tokens lie outside the token table", ErrCorruptArtifact)
+	}
+
+	if err := checkVersion(aabSections[iSectionMetadata]); err != nil {
+		return nil, err
+	}
+	pdArtifact := &artifact{}
+	if err := json.Unmarshal(aabSections[iSectionMetadata], pdArtifact); err != nil {
+		return nil, fmt.Errorf("failed to decode artifact: %w", err)
+	}
+	pdTable := &tokenTable{
+		abMerges:     aabSections[iSectionMerges],
+		iMergeSize:   iMergeSize,
+		abOffsets:    aabSections[iSectionOffsets],
+		abRanks:      aabSections[iSectionRanks],
+		abIndex:      aabSections[iSectionIndex],
+		sTexts:       string(aabSections[iSectionTexts]),
+		lFirstID:     int64(fnHeader(4)),
+		iTokens:      iTokens,
+		iFirstMinted: fnHeader(6),
+		iAlphabet:    fnHeader(1),
+		iMinted:      fnHeader(2),
+		iMaxPiece:    fnHeader(3),
+	}
+	if err := pdTable.check(pdArtifact.SpecialTokens); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptArtifact, err)
+	}
+	return pdArtifact.compile(nil, pdTable)
+}
+
+// loadBinary memory-maps a binary artifact, which is unmapped once the tokenizer is no longer used
+func loadBinary(pdFile *os.File) (*Tokenizer, error) {
+	abData, fnUnmap, err := mapFile(pdFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map artifact: %w", err)
+	}
+	pdTokenizer, err := newBinaryTokenizer(abData)
+	if err != nil {
+		fnUnmap()
+		return nil, err
+	}
+	runtime.AddCleanup(pdTokenizer.pdTable, func(fnUnmap func()) { fnUnmap() }, fnUnmap)
+	return pdTokenizer, nil
+}
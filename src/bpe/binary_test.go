@@ -0,0 +1,297 @@
+package bpe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// newSharedTokenArtifact is an artifact where two merges mint the same token, as imported
+// vocabularies may, so its binary form keeps the rank of every merge and leaves an unused id
+func newSharedTokenArtifact(t *testing.T) []byte {
+	t.Helper()
+	pdArtifact := &artifact{}
+	abData := newTestArtifact(t, nil, []testMerge{{"t", "h"}, {"h", "e"}, {"th", "e"}, {"t", "he"}, {" ", "the"}}, PreTokenizerNone)
+	if err := json.Unmarshal(abData, pdArtifact); err != nil {
+		t.Fatal(err)
+	}
+	pdArtifact.Merges[keyToString(pdArtifact.Ordering[3])] = pdArtifact.Merges[keyToString(pdArtifact.Ordering[2])]
+	abData, err := json.Marshal(pdArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abData
+}
+
+// binaryTokenizers returns tokenizers loaded from JSON artifacts that lay out their binary form in
+// every way: minted tokens in merge order, unused ids, shared tokens, a byte-level import, and the
+// trained artifact
+func binaryTokenizers(t *testing.T) map[string]*Tokenizer {
+	mapTokenizers := map[string]*Tokenizer{
+		"implied ranks": mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, PreTokenizerGPT2)),
+		"unused ids":    mustTokenizer(t, newExportArtifact(t)),
+		"shared tokens": mustTokenizer(t, newSharedTokenArtifact(t)),
+		"gpt2":          importFixtureGPT2(t),
+	}
+	if pdTokenizer, err := LoadTokenizer("../../artifacts/merges.json"); err == nil {
+		mapTokenizers["artifact"] = pdTokenizer
+	}
+	return mapTokenizers
+}
+
+// mustBinary writes a tokenizer as a binary artifact and loads it back
+func mustBinary(t *testing.T, pdTokenizer *Tokenizer) ([]byte, *Tokenizer) {
+	t.Helper()
+	abData, err := pdTokenizer.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abData, mustTokenizer(t, abData)
+}
+
+// TestBinaryLayout checks which columns the binary form of each artifact keeps
+func TestBinaryLayout(t *testing.T) {
+	mapTokenizers := binaryTokenizers(t)
+	for sName, iMergeSize := range map[string]int{"implied ranks": iMergeRecord, "unused ids": iMergeRecord, "shared tokens": iRankedMergeRecord, "gpt2": iMergeRecord} {
+		_, pdBinary := mustBinary(t, mapTokenizers[sName])
+		tfRanks := sName == "unused ids" || sName == "shared tokens"
+		if pdBinary.pdTable.iMergeSize != iMergeSize || (len(pdBinary.pdTable.abRanks) > 0) != tfRanks {
+			t.Errorf("%s: merge records of %d bytes, ranks stored %v", sName, pdBinary.pdTable.iMergeSize, len(pdBinary.pdTable.abRanks) > 0)
+		}
+	}
+}
+
+// TestBinaryRoundTrip checks that a binary artifact converts back to the merges and ordering of
+// the JSON artifact it came from, and that the JSON written from it converts to the same bytes
+func TestBinaryRoundTrip(t *testing.T) {
+	for sName, pdTokenizer := range binaryTokenizers(t) {
+		abData, pdBinary := mustBinary(t, pdTokenizer)
+		pdExpected, pdActual := pdTokenizer.jsonArtifact(), pdBinary.jsonArtifact()
+		if !slices.Equal(pdActual.Ordering, pdExpected.Ordering) || !maps.Equal(pdActual.Merges, pdExpected.Merges) {
+			t.Errorf("%s: merges differ after the round trip", sName)
+		}
+
+		sArtifactPath := filepath.Join(t.TempDir(), "merges.json")
+		if err := pdBinary.WriteArtifact(sArtifactPath); err != nil {
+			t.Fatal(err)
+		}
+		pdReloaded, err := LoadTokenizer(sArtifactPath)
+		if err != nil {
+			t.Fatalf("%s: %v", sName, err)
+		}
+		if abReloaded, err := pdReloaded.MarshalBinary(); err != nil || !bytes.Equal(abReloaded, abData) {
+			t.Errorf("%s: converting the written JSON again gives other bytes (%v)", sName, err)
+		}
+	}
+}
+
+// TestBinaryParity checks that a binary artifact encodes, decodes and looks tokens up exactly like
+// the JSON artifact it came from
+func TestBinaryParity(t *testing.T) {
+	asTexts := append(testTexts(t)[:12], sStreamText, "the thing<|endoftext|> then\r\n\r\nwith them", "<bos> the tab <eos>")
+	for sName, pdTokenizer := range binaryTokenizers(t) {
+		_, pdBinary := mustBinary(t, pdTokenizer)
+		for _, sInput := range asTexts {
+			alExpected := pdTokenizer.Encode(sInput)
+			alTokens := pdBinary.Encode(sInput)
+			if !slices.Equal(alTokens, alExpected) {
+				t.Errorf("%s: %q encodes to %v, want %v", sName, sInput, alTokens, alExpected)
+			}
+			if iCount := pdBinary.Count(sInput); iCount != len(alExpected) {
+				t.Errorf("%s: %q counts %d tokens, want %d", sName, sInput, iCount, len(alExpected))
+			}
+			sExpected, errExpected := pdTokenizer.Decode(alExpected)
+			if sDecoded, err := pdBinary.Decode(alTokens); sDecoded != sExpected || (err == nil) != (errExpected == nil) {
+				t.Errorf("%s: %v decodes to %q, %v, want %q, %v", sName, alTokens, sDecoded, err, sExpected, errExpected)
+			}
+		}
+		aalExpected, errExpected := pdTokenizer.EncodeNBest("the other's abc", 4, SegmentOptions{})
+		if aalNBest, err := pdBinary.EncodeNBest("the other's abc", 4, SegmentOptions{}); !slices.EqualFunc(aalNBest, aalExpected, slices.Equal) || (err == nil) != (errExpected == nil) {
+			t.Errorf("%s: n-best segmentations %v, %v, want %v, %v", sName, aalNBest, err, aalExpected, errExpected)
+		}
+
+		// every spelled-out id, and the ids around them, look up alike
+		pdTable := pdTokenizer.pdTable
+		for lID := pdTable.lFirstID - 2; lID < pdTable.lFirstID+int64(pdTable.iTokens)+2; lID++ {
+			sExpected, tfExpected := pdTokenizer.IDToToken(lID)
+			if sText, tfOK := pdBinary.IDToToken(lID); sText != sExpected || tfOK != tfExpected {
+				t.Fatalf("%s: IDToToken(%d) = %q, %v, want %q, %v", sName, lID, sText, tfOK, sExpected, tfExpected)
+			}
+			if !tfExpected {
+				continue
+			}
+			lExpected, _ := pdTokenizer.TokenToID(sExpected)
+			if lActual, tfOK := pdBinary.TokenToID(sExpected); !tfOK || lActual != lExpected {
+				t.Errorf("%s: TokenToID(%q) = %d, %v, want %d", sName, sExpected, lActual, tfOK, lExpected)
+			}
+		}
+		if pdBinary.VocabSize() != pdTokenizer.VocabSize() {
+			t.Errorf("%s: vocabulary of %d, want %d", sName, pdBinary.VocabSize(), pdTokenizer.VocabSize())
+		}
+	}
+}
+
+// binaryField reads the iField-th integer of a binary artifact after its magic
+func binaryField(abData []byte, iField int) int {
+	return int(binary.LittleEndian.Uint32(abData[4+4*iField:]))
+}
+
+// corruptBinary returns a copy of a binary artifact changed by fnChange, with its checksum fixed so
+// only the change itself can be refused. fnChange gets the copy and the start of every section.
+func corruptBinary(abData []byte, fnChange func(abData []byte, aiSections [iSections]int)) []byte {
+	abCopy := slices.Clone(abData)
+	var aiSections [iSections]int
+	for iSection := range aiSections {
+		aiSections[iSection] = binaryField(abCopy, 7+2*iSection)
+	}
+	fnChange(abCopy, aiSections)
+	iEnd := len(abCopy) - 4
+	binary.LittleEndian.PutUint32(abCopy[iEnd:], crc32.Checksum(abCopy[:iEnd], pdCastagnoli))
+	return abCopy
+}
+
+// putField writes the iIndex-th integer from an offset of a binary artifact
+func putField(abData []byte, iOffset int, iIndex int, lValue uint32) {
+	binary.LittleEndian.PutUint32(abData[iOffset+4*iIndex:], lValue)
+}
+
+// TestBinaryCorrupt checks that truncated, altered and inconsistent binary artifacts are refused
+// with ErrCorruptArtifact rather than loaded
+func TestBinaryCorrupt(t *testing.T) {
+	mapTokenizers := binaryTokenizers(t)
+	abImplied, _ := mustBinary(t, mapTokenizers["implied ranks"])
+	abRanked, _ := mustBinary(t, mapTokenizers["unused ids"])
+	abShared, _ := mustBinary(t, mapTokenizers["shared tokens"])
+
+	abFlipped := slices.Clone(abRanked)
+	abFlipped[len(abFlipped)-10] ^= 1
+	mapCorrupt := map[string][]byte{
+		"truncated":       abRanked[:len(abRanked)/2],
+		"header only":     abRanked[:iBinaryHeader],
+		"checksum":        abFlipped,
+		"section outside": corruptBinary(abRanked, func(ab []byte, _ [iSections]int) { putField(ab, 4, 7+2*iSectionTexts, uint32(len(ab))) }),
+		"partial index":   corruptBinary(abRanked, func(ab []byte, _ [iSections]int) { putField(ab, 4, 8+2*iSectionIndex, 6) }),
+		"merge size":      corruptBinary(abRanked, func(ab []byte, _ [iSections]int) { putField(ab, 4, 5, 20) }),
+		"minted count":    corruptBinary(abRanked, func(ab []byte, _ [iSections]int) { putField(ab, 4, 2, uint32(binaryField(ab, 2)+1)) }),
+		"max piece":       corruptBinary(abRanked, func(ab []byte, _ [iSections]int) { putField(ab, 4, 3, uint32(binaryField(ab, 3)-1)) }),
+		"first minted": corruptBinary(abImplied, func(ab []byte, _ [iSections]int) {
+			putField(ab, 4, 6, 0xFFFFFF)
+		}),
+		"token rank out of range": corruptBinary(abRanked, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionRanks], 0, 0xFFFFFF)
+		}),
+		"token rank repeated": corruptBinary(abRanked, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionRanks], 1, 1)
+		}),
+		"merge rank out of range": corruptBinary(abShared, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionMerges], 3, 0xFFFFFF)
+		}),
+		"merge rank repeated": corruptBinary(abShared, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionMerges], 3, binary.LittleEndian.Uint32(ab[aiSections[iSectionMerges]+iRankedMergeRecord+12:]))
+		}),
+		"merges unsorted": corruptBinary(abImplied, func(ab []byte, aiSections [iSections]int) {
+			abFirst := ab[aiSections[iSectionMerges]:][:iMergeRecord]
+			abSecond := ab[aiSections[iSectionMerges]+iMergeRecord:][:iMergeRecord]
+			abTemp := slices.Clone(abFirst)
+			copy(abFirst, abSecond)
+			copy(abSecond, abTemp)
+		}),
+		"merge of an unused id": corruptBinary(abRanked, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionMerges], 2, 0x110000+50)
+		}),
+		"text offsets": corruptBinary(abRanked, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionOffsets], 1, 0xFFFFFF)
+		}),
+		"index out of range": corruptBinary(abRanked, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionIndex], 0, 0xFFFFFF)
+		}),
+		"index unsorted": corruptBinary(abRanked, func(ab []byte, aiSections [iSections]int) {
+			putField(ab, aiSections[iSectionIndex], 1, binary.LittleEndian.Uint32(ab[aiSections[iSectionIndex]:]))
+		}),
+	}
+	for sName, abData := range mapCorrupt {
+		if _, err := NewTokenizerFromBytes(abData); !errors.Is(err, ErrCorruptArtifact) {
+			t.Errorf("%s: got %v, want ErrCorruptArtifact", sName, err)
+		}
+	}
+
+	abNewer := corruptBinary(abRanked, func(ab []byte, _ [iSections]int) { putField(ab, 4, 0, iBinaryLayout+1) })
+	if _, err := NewTokenizerFromBytes(abNewer); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("newer layout: got %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+// TestBinaryCorruptTables changes every byte of the tables of small binary artifacts in turn: each
+// must be refused, or load into a tokenizer that encodes, exports and converts without panicking
+func TestBinaryCorruptTables(t *testing.T) {
+	mapTokenizers := binaryTokenizers(t)
+	for _, sName := range []string{"implied ranks", "unused ids", "shared tokens"} {
+		abData, _ := mustBinary(t, mapTokenizers[sName])
+		iTables := binaryField(abData, 7+2*iSectionMerges)
+		for iByte := iTables; iByte < len(abData)-4; iByte++ {
+			for _, iMask := range []byte{0x01, 0x80} {
+				abCorrupt := corruptBinary(abData, func(ab []byte, _ [iSections]int) { ab[iByte] ^= iMask })
+				pdTokenizer, err := NewTokenizerFromBytes(abCorrupt)
+				if err != nil {
+					continue
+				}
+				pdTokenizer.Encode(sStreamText)
+				pdTokenizer.TokenToID("the")
+				if _, err := pdTokenizer.MarshalBinary(); err != nil {
+					t.Errorf("%s, byte %d: %v", sName, iByte, err)
+				}
+				if _, err := json.Marshal(pdTokenizer.jsonArtifact()); err != nil {
+					t.Errorf("%s, byte %d: %v", sName, iByte, err)
+				}
+				pdTokenizer.HuggingFaceJSON("", "")
+			}
+		}
+	}
+}
+
+// loadCachedBinary loads a binary artifact and returns only a cached copy of the tokenizer, so the
+// original can be collected
+func loadCachedBinary(t *testing.T, sArtifactPath string) *Tokenizer {
+	t.Helper()
+	pdTokenizer, err := LoadTokenizer(sArtifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pdTokenizer.WithCache(16)
+}
+
+// TestBinaryCleanup checks that the mapping of a binary artifact outlives the tokenizer it was
+// loaded into for as long as a copy made by WithCache is in use
+func TestBinaryCleanup(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, PreTokenizerGPT2))
+	abData, err := pdTokenizer.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sArtifactPath := filepath.Join(t.TempDir(), "merges.bin")
+	if err := os.WriteFile(sArtifactPath, abData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pdCached := loadCachedBinary(t, sArtifactPath)
+	for range 5 {
+		runtime.GC()
+	}
+	alExpected := pdTokenizer.Encode(sStreamText)
+	for range 2 {
+		if alTokens := pdCached.Encode(sStreamText); !slices.Equal(alTokens, alExpected) {
+			t.Errorf("cached copy encodes to %v, want %v", alTokens, alExpected)
+		}
+	}
+	if sText, tfOK := pdCached.IDToToken(alExpected[0]); !tfOK || sText != pdTokenizer.TokenText(alExpected[0]) {
+		t.Errorf("cached copy spells %d as %q, %v", alExpected[0], sText, tfOK)
+	}
+}
@@ -2,23 +2,35 @@ package bpe
 
 import (
 	"fmt"
+	"log"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
 )
 
 // merge implements the byte pair encoding algorithm and returns an error if the merge process fails.
-func merge(dataDataset *dataDataset) error {
-	// Initialize max token value
-	lMintToken := getMaxToken(dataDataset) + 1
+func merge(dataDataset *dataDataset, pdConfig *TrainingConfig) error {
+	// Initialize max token value; minting continues after the reserved ids
+	lMintToken := max(getMaxToken(dataDataset)+1, dataDataset.lNextID)
 
 	// Before vocab size
 	lOldSequenceLength := getTotalSequenceLength(dataDataset)
 
 	// store merges
 	dataMerges := &Merges{
-		mapMerges: make(map[[2]int64]int64),
-		alKeys:    [][2]int64{},
+		mapMerges:        make(map[[2]int64]int64),
+		alKeys:           [][2]int64{},
+		mapSpecialTokens: dataDataset.mapSpecialTokens,
+		mapUnits:         dataDataset.mapUnits,
+		dataHeader:       dataDataset.header(pdConfig),
+		mapTexts:         make(map[int64]string, len(dataDataset.mapSpecialTokens)+len(dataDataset.mapUnits)),
+	}
+	for sSpecialToken, lID := range dataDataset.mapSpecialTokens {
+		dataMerges.mapTexts[lID] = sSpecialToken
+	}
+	for sUnit, lID := range dataDataset.mapUnits {
+		dataMerges.mapTexts[lID] = sUnit
 	}
 
 	// start time
@@ -40,6 +52,11 @@ func merge(dataDataset *dataDataset) error {
 			return fmt.Errorf("failed to generate merge pairs: %w", err)
 		}
 
+		// Nothing left to merge
+		if *pdMergeStatistics.piMaxCount == 0 {
+			break
+		}
+
 		// store merges
 		dataMerges.insertMerge(*pdMergeStatistics.palMaxPair, lMintToken)
 
@@ -51,11 +68,14 @@ func merge(dataDataset *dataDataset) error {
 
 		// calculate compression ratio
 		fCompressionRatio := float64(lOldSequenceLength) / float64(newSequence)
-		fmt.Println(time.Since(mainStart), fCompressionRatio, string(pdMergeStatistics.palMaxPair[0]), string(pdMergeStatistics.palMaxPair[1]))
+		if pdConfig.Verbose {
+			log.Printf("%s merge %d: %q + %q, compression ratio %.4f", time.Since(mainStart), len(dataMerges.alKeys), dataMerges.tokenText(pdMergeStatistics.palMaxPair[0]), dataMerges.tokenText(pdMergeStatistics.palMaxPair[1]), fCompressionRatio)
+		}
 
-		// Write to JSON file if compression ratio increases by 0.1
-		if fCompressionRatio >= fLastRecordedRatio+0.1 {
-			err := WriteMergesMapToJSONFile(dataMerges, "artifacts/merges_"+strconv.Itoa(iIndex)+".json")
+		// Write to JSON file if compression ratio increases by the checkpoint step
+		if pdConfig.Stopping.CheckpointStep > 0 && fCompressionRatio >= fLastRecordedRatio+pdConfig.Stopping.CheckpointStep {
+			sCheckpointPath := filepath.Join(pdConfig.Output.CheckpointDir, "merges_"+strconv.Itoa(iIndex)+".json")
+			err := WriteMergesMapToJSONFile(dataMerges, pdConfig, sCheckpointPath)
 			if err != nil {
 				return fmt.Errorf("failed to write merges to JSON: %w", err)
 			}
@@ -64,13 +84,23 @@ func merge(dataDataset *dataDataset) error {
 		}
 
 		// Break after a certain ratio
-		if fCompressionRatio > 5 {
+		if pdConfig.Stopping.CompressionRatio > 0 && fCompressionRatio > pdConfig.Stopping.CompressionRatio {
+			break
+		}
+
+		// Break after a certain number of merges
+		if pdConfig.Stopping.MaxMerges > 0 && len(dataMerges.alKeys) >= pdConfig.Stopping.MaxMerges {
 			break
 		}
 
 		// next minted token
 		lMintToken += 1
 	}
+
+	// Write the final artifact
+	if err := WriteMergesMapToJSONFile(dataMerges, pdConfig, pdConfig.Output.Artifact); err != nil {
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,122 @@
+package bpe
+
+import (
+	"encoding/json"
+	"normalize"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// trainTestTokenizer trains on a corpus of sentences per language, written to a file source, with a
+// configuration the caller adjusts, and loads the artifact
+func trainTestTokenizer(t *testing.T, mapCorpus map[string][]string, fnConfig func(pdConfig *TrainingConfig)) *Tokenizer {
+	t.Helper()
+	sDirectory := t.TempDir()
+	abCorpus, err := json.Marshal(mapCorpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sCorpusPath := filepath.Join(sDirectory, "corpus.json")
+	if err := os.WriteFile(sCorpusPath, abCorpus, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pdConfig := DefaultTrainingConfig()
+	pdConfig.Data.Sources = []DataSource{{Type: SourceFile, Path: sCorpusPath}}
+	pdConfig.Stopping = StoppingConfig{MaxMerges: 40}
+	pdConfig.Output = OutputConfig{Artifact: filepath.Join(sDirectory, "merges.json")}
+	pdConfig.Verbose = false
+	fnConfig(pdConfig)
+	if err := pdConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Train(pdConfig); err != nil {
+		t.Fatal(err)
+	}
+	pdTokenizer, err := LoadTokenizer(pdConfig.Output.Artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pdTokenizer
+}
+
+// sentences whose decomposed form has clusters of several code points: Vietnamese tone marks,
+// Bengali conjuncts and vowel signs, Thai vowel and tone marks
+var mapClusterCorpus = map[string][]string{
+	"vi": {"Tiếng Việt có dấu", "người Việt nói tiếng Việt", "dấu hỏi dấu ngã"},
+	"bn": {"ক্ষমা করো", "বাংলা ভাষা ক্ষেত্র", "কোথায় যাবে"},
+	"th": {"ที่นี่ที่ไหน", "น้ำใจไมตรี", "ภาษาไทย ที่นี่"},
+}
+
+// TestTrainGraphemeUnits checks that with grapheme base units no token boundary falls inside a
+// cluster in the encoding of the corpus, where code point units do split clusters
+func TestTrainGraphemeUnits(t *testing.T) {
+	fnTrain := func(sBaseUnits string) *Tokenizer {
+		return trainTestTokenizer(t, mapClusterCorpus, func(pdConfig *TrainingConfig) {
+			pdConfig.Normalizer = normalize.Config{Form: normalize.FormNFD, Whitespace: normalize.WhitespacePreserve}
+			pdConfig.BaseUnits = sBaseUnits
+		})
+	}
+
+	// every token boundary has to be a cluster boundary of the normalized sentence
+	fnSplitsCluster := func(pdTokenizer *Tokenizer, sSentence string) bool {
+		mapBoundaries := map[int]bool{0: true}
+		iEnd := 0
+		for sCluster := range normalize.Graphemes(pdTokenizer.Normalizer().Normalize(sSentence)) {
+			iEnd += len(sCluster)
+			mapBoundaries[iEnd] = true
+		}
+		iEnd = 0
+		for _, sToken := range pdTokenizer.TokenTexts(pdTokenizer.Encode(sSentence)) {
+			iEnd += len(sToken)
+			if !mapBoundaries[iEnd] {
+				return true
+			}
+		}
+		return false
+	}
+
+	pdGraphemes, pdCodePoints := fnTrain(BaseUnitsGraphemes), fnTrain(BaseUnitsCodePoints)
+	tfSplit := false
+	for _, asSentences := range mapClusterCorpus {
+		for _, sSentence := range asSentences {
+			if fnSplitsCluster(pdGraphemes, sSentence) {
+				t.Errorf("grapheme units: %q encodes to %q", sSentence, pdGraphemes.TokenTexts(pdGraphemes.Encode(sSentence)))
+			}
+			tfSplit = tfSplit || fnSplitsCluster(pdCodePoints, sSentence)
+		}
+	}
+	if !tfSplit {
+		t.Error("code point units never split a cluster, so the corpus tests nothing")
+	}
+	if iUnits := pdGraphemes.Metadata().Units; iUnits == 0 {
+		t.Error("grapheme units reserved no multi-rune units")
+	}
+}
+
+// TestBaseUnitsConfig checks the configurations that base units reject
+func TestBaseUnitsConfig(t *testing.T) {
+	for _, dataCase := range []struct {
+		sBaseUnits string
+		tfHangul   bool
+		sError     string
+	}{
+		{"bytes", false, `base_units: unknown base units "bytes"`},
+		{BaseUnitsGraphemes, true, "base_units: graphemes would turn decomposed Hangul syllables back into single units"},
+	} {
+		pdConfig := DefaultTrainingConfig()
+		pdConfig.BaseUnits = dataCase.sBaseUnits
+		pdConfig.Normalizer.HangulJamo = dataCase.tfHangul
+		if err := pdConfig.Validate(); err == nil || !strings.Contains(err.Error(), dataCase.sError) {
+			t.Errorf("%s: got %v, want %q", dataCase.sBaseUnits, err, dataCase.sError)
+		}
+	}
+	for _, sBaseUnits := range []string{"", BaseUnitsCodePoints, BaseUnitsGraphemes} {
+		pdConfig := DefaultTrainingConfig()
+		pdConfig.BaseUnits = sBaseUnits
+		if err := pdConfig.Validate(); err != nil {
+			t.Errorf("%q: %v", sBaseUnits, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package bpe
+
+import (
+	"container/list"
+	"sync"
+)
+
+// chunks longer than this are encoded every time so a few large inputs cannot fill the cache
+const iMaxCachedChunk = 1024
+
+// CacheStats reports how the chunk cache of a Tokenizer performed
+type CacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Entries  int    `json:"entries"`
+	Capacity int    `json:"capacity"`
+}
+
+// chunkCache is a bounded, concurrency-safe LRU cache from a pre-tokenized chunk to its token ids
+type chunkCache struct {
+	pdMutex    sync.Mutex
+	iCapacity  int
+	pdList     *list.List
+	mapEntries map[string]*list.Element
+	lHits      uint64
+	lMisses    uint64
+}
+
+// cacheEntry is a chunk and its encoding, stored in the recency list
+type cacheEntry struct {
+	sChunk   string
+	alTokens []int64
+}
+
+// newChunkCache creates a cache holding at most iCapacity chunks
+func newChunkCache(iCapacity int) *chunkCache {
+	return &chunkCache{
+		iCapacity:  iCapacity,
+		pdList:     list.New(),
+		mapEntries: make(map[string]*list.Element, iCapacity),
+	}
+}
+
+// get returns the cached encoding of a chunk; callers must not modify it
+func (c *chunkCache) get(sChunk string) ([]int64, bool) {
+	c.pdMutex.Lock()
+	defer c.pdMutex.Unlock()
+	pdElement, tfOK := c.mapEntries[sChunk]
+	if !tfOK {
+		c.lMisses++
+		return nil, false
+	}
+	c.lHits++
+	c.pdList.MoveToFront(pdElement)
+	return pdElement.Value.(*cacheEntry).alTokens, true
+}
+
+// put stores the encoding of a chunk, evicting the least recently used one when full
+func (c *chunkCache) put(sChunk string, alTokens []int64) {
+	if len(sChunk) > iMaxCachedChunk {
+		return
+	}
+	c.pdMutex.Lock()
+	defer c.pdMutex.Unlock()
+	if pdElement, tfOK := c.mapEntries[sChunk]; tfOK {
+		c.pdList.MoveToFront(pdElement)
+		return
+	}
+	if c.pdList.Len() >= c.iCapacity {
+		pdOldest := c.pdList.Back()
+		c.pdList.Remove(pdOldest)
+		delete(c.mapEntries, pdOldest.Value.(*cacheEntry).sChunk)
+	}
+	c.mapEntries[sChunk] = c.pdList.PushFront(&cacheEntry{sChunk: sChunk, alTokens: alTokens})
+}
+
+// stats returns a snapshot of the counters
+func (c *chunkCache) stats() CacheStats {
+	c.pdMutex.Lock()
+	defer c.pdMutex.Unlock()
+	return CacheStats{Hits: c.lHits, Misses: c.lMisses, Entries: c.pdList.Len(), Capacity: c.iCapacity}
+}
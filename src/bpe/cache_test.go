@@ -0,0 +1,92 @@
+package bpe
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestChunkCache runs a sequence of lookups and stores against a cache of two chunks: the least
+// recently used chunk is evicted, and chunks too long to cache are never stored
+func TestChunkCache(t *testing.T) {
+	pdCache := newChunkCache(2)
+	sLong := strings.Repeat("a", iMaxCachedChunk+1)
+	for iStep, dataStep := range []struct {
+		sChunk string
+		tfPut  bool
+		tfHit  bool
+	}{
+		{"a", false, false},
+		{"a", true, false},
+		{"b", true, false},
+		{"a", false, true},
+		{"c", true, false},
+		{"b", false, false},
+		{"a", false, true},
+		{"c", false, true},
+		{sLong, true, false},
+		{sLong, false, false},
+		{"a", true, false},
+		{"a", false, true},
+	} {
+		if dataStep.tfPut {
+			pdCache.put(dataStep.sChunk, []int64{int64(len(dataStep.sChunk))})
+			continue
+		}
+		alTokens, tfHit := pdCache.get(dataStep.sChunk)
+		if tfHit != dataStep.tfHit || (tfHit && !slices.Equal(alTokens, []int64{int64(len(dataStep.sChunk))})) {
+			t.Errorf("step %d: %.8q gives %v, %v", iStep, dataStep.sChunk, alTokens, tfHit)
+		}
+	}
+	if dataStats := pdCache.stats(); dataStats != (CacheStats{Hits: 4, Misses: 3, Entries: 2, Capacity: 2}) {
+		t.Errorf("stats: %+v", dataStats)
+	}
+}
+
+// TestTokenizerCache checks that a cached tokenizer encodes like the uncached one, also from several
+// goroutines, counts its hits and misses, and leaves the tokenizer it was made from without a cache
+func TestTokenizerCache(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, PreTokenizerWhitespace))
+	pdCached := pdTokenizer.WithCache(8)
+	sInput := "the other the other abc"
+	alExpected := pdTokenizer.Encode(sInput)
+	if alTokens := pdCached.Encode(sInput); !slices.Equal(alTokens, alExpected) {
+		t.Errorf("cached encoding %v, want %v", alTokens, alExpected)
+	}
+
+	// chunks are the words with the whitespace before them, and only " other" repeats
+	if dataStats := pdCached.CacheStats(); dataStats != (CacheStats{Hits: 1, Misses: 4, Entries: 4, Capacity: 8}) {
+		t.Errorf("stats after one encoding: %+v", dataStats)
+	}
+	pdCached.Encode(sInput)
+	if dataStats := pdCached.CacheStats(); dataStats.Hits != 6 || dataStats.Misses != 4 {
+		t.Errorf("stats after the same encoding: %+v", dataStats)
+	}
+
+	var dWg sync.WaitGroup
+	for iWorker := range 8 {
+		dWg.Add(1)
+		go func() {
+			defer dWg.Done()
+			for iIndex := range 200 {
+				sText := strings.Repeat("ab ", (iWorker+iIndex)%20) + sStreamText
+				if !slices.Equal(pdCached.Encode(sText), pdTokenizer.Encode(sText)) {
+					t.Errorf("worker %d: cached encoding of %q differs", iWorker, sText)
+					return
+				}
+			}
+		}()
+	}
+	dWg.Wait()
+	if dataStats := pdCached.CacheStats(); dataStats.Entries > 8 {
+		t.Errorf("cache holds %d entries, more than its capacity", dataStats.Entries)
+	}
+
+	for sName, pdUncached := range map[string]*Tokenizer{"original": pdTokenizer, "zero capacity": pdCached.WithCache(0)} {
+		pdUncached.Encode(sInput)
+		if dataStats := pdUncached.CacheStats(); dataStats != (CacheStats{}) {
+			t.Errorf("%s: stats without a cache: %+v", sName, dataStats)
+		}
+	}
+}
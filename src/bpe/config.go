@@ -0,0 +1,249 @@
+package bpe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"normalize"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TrainingConfig declares everything a training run needs: where the data lives, how it is
+// prepared, when to stop and where the artifacts go.
+type TrainingConfig struct {
+	Data          DataConfig          `json:"data"`
+	Normalizer    normalize.Config    `json:"normalizer"`
+	PreTokenizer  string              `json:"pre_tokenizer"`
+	BaseUnits     string              `json:"base_units,omitempty"`
+	Algorithm     string              `json:"algorithm"`
+	Stopping      StoppingConfig      `json:"stopping"`
+	SpecialTokens []string            `json:"special_tokens,omitempty"`
+	Templates     map[string]Template `json:"templates,omitempty"`
+	Output        OutputConfig        `json:"output"`
+	Verbose       bool                `json:"verbose,omitempty"`
+}
+
+// DataConfig lists the corpus sources, the per-language sampling weights and the seed sampling
+// shuffles sentences with
+type DataConfig struct {
+	Sources         []DataSource       `json:"sources"`
+	LanguageWeights map[string]float64 `json:"language_weights,omitempty"`
+	Seed            uint64             `json:"seed,omitempty"`
+}
+
+// DataSource is a single location of JSON files mapping a language to a list of sentences
+type DataSource struct {
+	Type   string `json:"type"`
+	Bucket string `json:"bucket,omitempty"`
+	Region string `json:"region,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// StoppingConfig decides when the merge loop ends and how often checkpoints are written
+type StoppingConfig struct {
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+	MaxMerges        int     `json:"max_merges,omitempty"`
+	CheckpointStep   float64 `json:"checkpoint_step,omitempty"`
+}
+
+// OutputConfig holds the paths the trainer writes to
+type OutputConfig struct {
+	Artifact      string `json:"artifact"`
+	CheckpointDir string `json:"checkpoint_dir,omitempty"`
+}
+
+// Supported values for the enumerated configuration fields
+const (
+	SourceS3   = "s3"
+	SourceFile = "file"
+
+	PreTokenizerNone       = "none"
+	PreTokenizerWhitespace = "whitespace"
+
+	BaseUnitsCodePoints = "code_points"
+	BaseUnitsGraphemes  = "graphemes"
+
+	AlgorithmBPE = "bpe"
+)
+
+// DefaultTrainingConfig returns the configuration that reproduces the original hard-coded training run
+func DefaultTrainingConfig() *TrainingConfig {
+	return &TrainingConfig{
+		Data: DataConfig{
+			Sources: []DataSource{{Type: SourceS3, Bucket: "tknzr", Region: "us-east-1"}},
+		},
+		Normalizer:   normalize.DefaultConfig(),
+		PreTokenizer: PreTokenizerNone,
+		BaseUnits:    BaseUnitsCodePoints,
+		Algorithm:    AlgorithmBPE,
+		Stopping: StoppingConfig{
+			CompressionRatio: 5,
+			CheckpointStep:   0.1,
+		},
+		Output: OutputConfig{
+			Artifact:      "artifacts/merges.json",
+			CheckpointDir: "artifacts",
+		},
+		Verbose: true,
+	}
+}
+
+// LoadTrainingConfig reads a JSON or YAML training configuration and validates it
+func LoadTrainingConfig(sFilePath string) (*TrainingConfig, error) {
+	abData, err := os.ReadFile(sFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// YAML is converted to JSON so both formats share the same field names and strictness
+	if sExtension := strings.ToLower(filepath.Ext(sFilePath)); sExtension == ".yaml" || sExtension == ".yml" {
+		var dataDocument interface{}
+		if err := yaml.Unmarshal(abData, &dataDocument); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config %s: %w", sFilePath, err)
+		}
+		abData, err = json.Marshal(dataDocument)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert YAML config %s: %w", sFilePath, err)
+		}
+	}
+
+	// decode on top of an empty config so every field has to be spelled correctly
+	pdConfig := &TrainingConfig{}
+	pdDecoder := json.NewDecoder(bytes.NewReader(abData))
+	pdDecoder.DisallowUnknownFields()
+	if err := pdDecoder.Decode(pdConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", sFilePath, err)
+	}
+
+	// validate before any data is fetched
+	if err := pdConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", sFilePath, err)
+	}
+
+	return pdConfig, nil
+}
+
+// Validate checks the configuration and reports every problem it finds at once
+func (c *TrainingConfig) Validate() error {
+	var aErrors []error
+
+	// data sources
+	if len(c.Data.Sources) == 0 {
+		aErrors = append(aErrors, errors.New("data.sources: at least one source is required"))
+	}
+	for iIndex, dataSource := range c.Data.Sources {
+		sField := fmt.Sprintf("data.sources[%d]", iIndex)
+		switch dataSource.Type {
+		case SourceS3:
+			if dataSource.Bucket == "" {
+				aErrors = append(aErrors, fmt.Errorf("%s: bucket is required for an s3 source", sField))
+			}
+			if dataSource.Region == "" {
+				aErrors = append(aErrors, fmt.Errorf("%s: region is required for an s3 source", sField))
+			}
+		case SourceFile:
+			if dataSource.Path == "" {
+				aErrors = append(aErrors, fmt.Errorf("%s: path is required for a file source", sField))
+			}
+		default:
+			aErrors = append(aErrors, fmt.Errorf("%s: unknown type %q (expected %q or %q)", sField, dataSource.Type, SourceS3, SourceFile))
+		}
+	}
+	for sLanguage, fWeight := range c.Data.LanguageWeights {
+		if fWeight < 0 {
+			aErrors = append(aErrors, fmt.Errorf("data.language_weights.%s: weight must not be negative, got %v", sLanguage, fWeight))
+		}
+	}
+
+	// processing stages
+	aErrors = append(aErrors, prefixErrors("normalizer", c.Normalizer.Validate())...)
+	if c.PreTokenizer != PreTokenizerNone && c.PreTokenizer != PreTokenizerWhitespace {
+		aErrors = append(aErrors, fmt.Errorf("pre_tokenizer: unknown pre-tokenizer %q (expected %q or %q)", c.PreTokenizer, PreTokenizerNone, PreTokenizerWhitespace))
+	}
+	if c.BaseUnits != "" && c.BaseUnits != BaseUnitsCodePoints && c.BaseUnits != BaseUnitsGraphemes {
+		aErrors = append(aErrors, fmt.Errorf("base_units: unknown base units %q (expected %q or %q)", c.BaseUnits, BaseUnitsCodePoints, BaseUnitsGraphemes))
+	}
+	if c.BaseUnits == BaseUnitsGraphemes && c.Normalizer.HangulJamo {
+		aErrors = append(aErrors, errors.New("base_units: graphemes would turn decomposed Hangul syllables back into single units; disable normalizer.hangul_jamo or use code_points"))
+	}
+	if c.Algorithm != AlgorithmBPE {
+		aErrors = append(aErrors, fmt.Errorf("algorithm: unknown algorithm %q (expected %q)", c.Algorithm, AlgorithmBPE))
+	}
+
+	// stopping criteria
+	if c.Stopping.CompressionRatio == 0 && c.Stopping.MaxMerges == 0 {
+		aErrors = append(aErrors, errors.New("stopping: compression_ratio or max_merges must be set"))
+	}
+	if c.Stopping.CompressionRatio != 0 && c.Stopping.CompressionRatio <= 1 {
+		aErrors = append(aErrors, fmt.Errorf("stopping.compression_ratio: must be greater than 1, got %v", c.Stopping.CompressionRatio))
+	}
+	if c.Stopping.MaxMerges < 0 {
+		aErrors = append(aErrors, fmt.Errorf("stopping.max_merges: must not be negative, got %d", c.Stopping.MaxMerges))
+	}
+	if c.Stopping.CheckpointStep < 0 {
+		aErrors = append(aErrors, fmt.Errorf("stopping.checkpoint_step: must not be negative, got %v", c.Stopping.CheckpointStep))
+	}
+
+	// special tokens
+	mapSeen := make(map[string]bool)
+	for iIndex, sToken := range c.SpecialTokens {
+		if sToken == "" {
+			aErrors = append(aErrors, fmt.Errorf("special_tokens[%d]: token must not be empty", iIndex))
+		} else if mapSeen[sToken] {
+			aErrors = append(aErrors, fmt.Errorf("special_tokens[%d]: duplicate token %q", iIndex, sToken))
+		}
+		mapSeen[sToken] = true
+	}
+
+	// templates may only use the special tokens above
+	mapSpecialTokens := make(map[string]int64, len(c.SpecialTokens))
+	for _, sToken := range c.SpecialTokens {
+		mapSpecialTokens[sToken] = 0
+	}
+	for sName, dataTemplate := range c.Templates {
+		if _, err := compileTemplate(dataTemplate, mapSpecialTokens); err != nil {
+			aErrors = append(aErrors, fmt.Errorf("templates.%s.%w", sName, err))
+		}
+	}
+
+	// outputs
+	if c.Output.Artifact == "" {
+		aErrors = append(aErrors, errors.New("output.artifact: path is required"))
+	}
+	if c.Stopping.CheckpointStep > 0 && c.Output.CheckpointDir == "" {
+		aErrors = append(aErrors, errors.New("output.checkpoint_dir: required when stopping.checkpoint_step is set"))
+	}
+
+	return errors.Join(aErrors...)
+}
+
+// prefixErrors qualifies every error of a (possibly joined) error with the name of the section it came from
+func prefixErrors(sSection string, err error) []error {
+	if err == nil {
+		return nil
+	}
+	aInner := []error{err}
+	if pdJoined, tfOK := err.(interface{ Unwrap() []error }); tfOK {
+		aInner = pdJoined.Unwrap()
+	}
+	aErrors := make([]error, 0, len(aInner))
+	for _, errInner := range aInner {
+		aErrors = append(aErrors, fmt.Errorf("%s.%w", sSection, errInner))
+	}
+	return aErrors
+}
+
+// languageWeight returns the sampling weight for a language, defaulting to 1
+func (c *TrainingConfig) languageWeight(sLanguage string) float64 {
+	fWeight, tfOK := c.Data.LanguageWeights[sLanguage]
+	if !tfOK {
+		return 1
+	}
+	return fWeight
+}
@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"math"
+	"math/rand/v2"
+	"normalize"
 	"os"
 	"sync"
 
@@ -40,8 +44,8 @@ func CreateAWSConfigFromEnv(region string) (aws.Config, error) {
 	return pdConfiguration, nil
 }
 
-// listS3Keys retrieves all keys in an S3 bucket
-func listS3Keys(sBucket string, sRegion string) ([]string, error) {
+// listS3Keys retrieves all keys in an S3 bucket that start with the given prefix
+func listS3Keys(sBucket string, sRegion string, sPrefix string) ([]string, error) {
 	// Get configuration
 	pdConfiguration, err := CreateAWSConfigFromEnv(sRegion)
 	if err != nil {
@@ -58,6 +62,7 @@ func listS3Keys(sBucket string, sRegion string) ([]string, error) {
 		// Service call
 		pdResponse, err := dataClient.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
 			Bucket:            aws.String(sBucket),
+			Prefix:            aws.String(sPrefix),
 			ContinuationToken: pdContinuationToken,
 		})
 		if err != nil {
@@ -79,13 +84,10 @@ func listS3Keys(sBucket string, sRegion string) ([]string, error) {
 }
 
 // fetchJSONFromS3 retrieves a JSON object from S3 and unmarshals it into a map
-func fetchJSONFromS3(sBucket string, sKey string) (map[string]interface{}, error) {
+func fetchJSONFromS3(sBucket string, sRegion string, sKey string) (map[string]interface{}, error) {
 	// Context
 	dataContext := context.Background()
 
-	// State
-	sRegion := "us-east-1"
-
 	// Read credentials from environment variables
 	sAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
 	sSecretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
@@ -134,27 +136,107 @@ func fetchJSONFromS3(sBucket string, sKey string) (map[string]interface{}, error
 	return mapResult, nil
 }
 
-// getData retrieves all sentences from S3
-func getData() (*dataDataset, error) {
-	dataDataset := &dataDataset{pdMutex: &sync.Mutex{}}
+// fetchJSONFromFile reads a local JSON file and unmarshals it into a map
+func fetchJSONFromFile(sFilePath string) (map[string]interface{}, error) {
+	abBody, err := os.ReadFile(sFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sFilePath, err)
+	}
+
+	// unmarshal into map
+	var mapResult map[string]interface{}
+	if err := json.Unmarshal(abBody, &mapResult); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON in %s: %w", sFilePath, err)
+	}
+
+	return mapResult, nil
+}
+
+// sourceFile identifies one JSON file of a configured data source
+type sourceFile struct {
+	dataSource DataSource
+	sKey       string
+}
+
+// listSourceFiles expands the configured data sources into the individual JSON files to read
+func listSourceFiles(pdConfig *TrainingConfig) ([]sourceFile, error) {
+	var adataFiles []sourceFile
+	for _, dataSource := range pdConfig.Data.Sources {
+		switch dataSource.Type {
+		case SourceS3:
+			asKeys, err := listS3Keys(dataSource.Bucket, dataSource.Region, dataSource.Prefix)
+			if err != nil {
+				return nil, fmt.Errorf("unable to pull s3 files from %s: %w", dataSource.Bucket, err)
+			}
+			for _, sKey := range asKeys {
+				adataFiles = append(adataFiles, sourceFile{dataSource: dataSource, sKey: sKey})
+			}
+		case SourceFile:
+			adataFiles = append(adataFiles, sourceFile{dataSource: dataSource, sKey: dataSource.Path})
+		}
+	}
+	return adataFiles, nil
+}
+
+// fetchSourceFile retrieves the contents of one source file
+func fetchSourceFile(dataFile sourceFile) (map[string]interface{}, error) {
+	if dataFile.dataSource.Type == SourceS3 {
+		return fetchJSONFromS3(dataFile.dataSource.Bucket, dataFile.dataSource.Region, dataFile.sKey)
+	}
+	return fetchJSONFromFile(dataFile.sKey)
+}
+
+// sampleByWeight scales a sentence list by a language weight. The sentences are shuffled first, so
+// a weight below 1 keeps a random part of them and a weight above 1 repeats them whole before
+// adding a random part; a weight of 1 keeps the list as it is.
+func sampleByWeight(adataSentences []interface{}, fWeight float64, pdRand *rand.Rand) []interface{} {
+	if fWeight == 1 || len(adataSentences) == 0 {
+		return adataSentences
+	}
+	aiOrder := pdRand.Perm(len(adataSentences))
+	iCount := int(math.Round(fWeight * float64(len(adataSentences))))
+	adataSampled := make([]interface{}, iCount)
+	for iIndex := range adataSampled {
+		adataSampled[iIndex] = adataSentences[aiOrder[iIndex%len(adataSentences)]]
+	}
+	return adataSampled
+}
+
+// sampleRand returns the random source that samples a language of a file, seeded by the training
+// configuration so runs with the same seed train on the same sentences
+func sampleRand(uSeed uint64, sKey string, sLanguage string) *rand.Rand {
+	pdHash := fnv.New64a()
+	pdHash.Write([]byte(sKey + "\x00" + sLanguage))
+	return rand.New(rand.NewPCG(uSeed, pdHash.Sum64()))
+}
+
+// getData retrieves all sentences from the configured sources
+func getData(pdConfig *TrainingConfig) (*dataDataset, error) {
+	dataDataset := newDataset(pdConfig.SpecialTokens, pdConfig.BaseUnits, !pdConfig.Normalizer.EmojiRanges)
+
+	// Build the normalizer shared by all files
+	pdNormalizer, err := normalize.New(pdConfig.Normalizer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalizer: %w", err)
+	}
 
 	// Get files
-	asJSONFiles, err := listS3Keys("tknzr", "us-east-1")
+	adataFiles, err := listSourceFiles(pdConfig)
 	if err != nil {
-		return nil, fmt.Errorf("unable to pull s3 files: %w", err)
+		return nil, err
 	}
 
 	// Get training dataset - we can populate map in parallel by maintaining a mutex
 	var dWg sync.WaitGroup
 	ch := make(chan error)
-	for _, sJSONFile := range asJSONFiles {
+	for _, dataFile := range adataFiles {
 		dWg.Add(1)
-		go func(qsFileName string) {
+		go func(qdataFile sourceFile) {
 			// Defer completion of routine
 			defer dWg.Done()
 
 			// Get the file contents
-			mapLanguageToSentence, err := fetchJSONFromS3("tknzr", qsFileName)
+			mapLanguageToSentence, err := fetchSourceFile(qdataFile)
 			if err != nil {
 				ch <- err
 				return
@@ -166,12 +248,15 @@ func getData() (*dataDataset, error) {
 				dLanguages, valid := mapLanguageToSentence[sLanguage].([]interface{})
 				if !valid {
 					ch <- errors.New("Unable to parse JSON for " + sLanguage + " into a string array")
+					return
 				}
 
 				// Add to list
-				dataDataset.AddList(dLanguages)
+				adataSampled := sampleByWeight(dLanguages, pdConfig.languageWeight(sLanguage), sampleRand(pdConfig.Data.Seed, qdataFile.sKey, sLanguage))
+				dataDataset.AddList(adataSampled, pdNormalizer, pdConfig.PreTokenizer)
+				dataDataset.countSentences(sLanguage, len(adataSampled))
 			}
-		}(sJSONFile)
+		}(dataFile)
 	}
 	go func() {
 		dWg.Wait()
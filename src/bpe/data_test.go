@@ -0,0 +1,55 @@
+package bpe
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestSampleByWeight checks that weights keep a random part of the sentences or repeat them whole,
+// the same way for the same seed
+func TestSampleByWeight(t *testing.T) {
+	adataSentences := make([]interface{}, 100)
+	for iIndex := range adataSentences {
+		adataSentences[iIndex] = iIndex
+	}
+	fnCounts := func(adataSampled []interface{}) []int {
+		aiCounts := make([]int, len(adataSentences))
+		for _, dataSentence := range adataSampled {
+			aiCounts[dataSentence.(int)]++
+		}
+		return aiCounts
+	}
+
+	if adataSampled := sampleByWeight(adataSentences, 1, sampleRand(0, "a.json", "en")); !slices.Equal(adataSampled, adataSentences) {
+		t.Errorf("a weight of 1 changed the sentences to %v", adataSampled)
+	}
+	for _, fWeight := range []float64{0, 0.3, 2, 2.5} {
+		adataSampled := sampleByWeight(adataSentences, fWeight, sampleRand(7, "a.json", "en"))
+		if len(adataSampled) != int(fWeight*100) {
+			t.Errorf("weight %v kept %d sentences", fWeight, len(adataSampled))
+		}
+		for iIndex, iCount := range fnCounts(adataSampled) {
+			if iCount < int(fWeight) || iCount > int(fWeight)+1 {
+				t.Errorf("weight %v uses sentence %d %d times", fWeight, iIndex, iCount)
+			}
+		}
+		if fWeight > 0 && slices.Equal(adataSampled[:len(adataSampled)/2], append(adataSentences, adataSentences...)[:len(adataSampled)/2]) {
+			t.Errorf("weight %v kept the sentences in file order", fWeight)
+		}
+		if !slices.Equal(adataSampled, sampleByWeight(adataSentences, fWeight, sampleRand(7, "a.json", "en"))) {
+			t.Errorf("weight %v sampled differently with the same seed", fWeight)
+		}
+	}
+
+	// other seeds, files and languages sample other sentences
+	adataSampled := sampleByWeight(adataSentences, 0.5, sampleRand(7, "a.json", "en"))
+	for sName, adataOther := range map[string][]interface{}{
+		"seed":     sampleByWeight(adataSentences, 0.5, sampleRand(8, "a.json", "en")),
+		"file":     sampleByWeight(adataSentences, 0.5, sampleRand(7, "b.json", "en")),
+		"language": sampleByWeight(adataSentences, 0.5, sampleRand(7, "a.json", "fr")),
+	} {
+		if slices.Equal(adataOther, adataSampled) {
+			t.Errorf("another %s sampled the same sentences", sName)
+		}
+	}
+}
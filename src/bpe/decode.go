@@ -0,0 +1,136 @@
+package bpe
+
+import (
+	"fmt"
+	"normalize"
+	"strings"
+	"unicode/utf8"
+)
+
+// Decoding modes for token ids outside the vocabulary
+const (
+	DecodeLenient = "lenient"
+	DecodeStrict  = "strict"
+)
+
+// invalid ids listed in an InvalidTokensError message before the rest are only counted
+const iMaxListedTokens = 10
+
+// DecodeOptions chooses how invalid token ids are decoded. Strict decoding fails on any of them;
+// lenient decoding, the default, substitutes Replacement, or U+FFFD when it is empty.
+type DecodeOptions struct {
+	Mode        string `json:"mode,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// Validate checks the decoding mode
+func (o DecodeOptions) Validate() error {
+	if o.Mode != "" && o.Mode != DecodeLenient && o.Mode != DecodeStrict {
+		return fmt.Errorf("mode: unknown decoding mode %q (expected %q or %q)", o.Mode, DecodeLenient, DecodeStrict)
+	}
+	return nil
+}
+
+// replacement returns the text lenient decoding substitutes for invalid ids
+func (o DecodeOptions) replacement() string {
+	if o.Replacement == "" {
+		return "\uFFFD"
+	}
+	return o.Replacement
+}
+
+// InvalidTokensError lists the token ids that are not in the vocabulary and where they appear
+type InvalidTokensError struct {
+	Positions []int
+	Tokens    []int64
+}
+
+func (e *InvalidTokensError) Error() string {
+	var asInvalid []string
+	for iIndex := range min(len(e.Tokens), iMaxListedTokens) {
+		asInvalid = append(asInvalid, fmt.Sprintf("%d at position %d", e.Tokens[iIndex], e.Positions[iIndex]))
+	}
+	if len(e.Tokens) > iMaxListedTokens {
+		asInvalid = append(asInvalid, fmt.Sprintf("and %d more", len(e.Tokens)-iMaxListedTokens))
+	}
+	return "token ids outside the vocabulary: " + strings.Join(asInvalid, ", ")
+}
+
+// DecodeWithOptions converts token ids back to text like Decode, treating ids outside the
+// vocabulary as the options say. Ids in the vocabulary are those of the artifact plus every valid
+// code point, since characters never seen in training encode as their code points; byte-level
+// artifacts have an id for every byte and no others.
+func (t *Tokenizer) DecodeWithOptions(alTokens []int64, dataOptions DecodeOptions) (string, error) {
+	if err := dataOptions.Validate(); err != nil {
+		return "", err
+	}
+	var dBuilder strings.Builder
+	pdInvalid := &InvalidTokensError{}
+	for iIndex, lToken := range alTokens {
+		sText, tfOK := t.IDToToken(lToken)
+		if !tfOK {
+			pdInvalid.Positions = append(pdInvalid.Positions, iIndex)
+			pdInvalid.Tokens = append(pdInvalid.Tokens, lToken)
+			sText = dataOptions.replacement()
+		}
+		dBuilder.WriteString(sText)
+	}
+	if dataOptions.Mode == DecodeStrict && len(pdInvalid.Tokens) > 0 {
+		return "", pdInvalid
+	}
+	return t.pdNormalizer.Denormalize(dBuilder.String()), nil
+}
+
+// IncrementalDecoder decodes tokens one at a time as they are generated. Each call returns only the
+// text completed by its token: incomplete UTF-8 sequences, pending case markers and Jamo that may
+// still form a syllable are held back until a later token or Flush completes them.
+type IncrementalDecoder struct {
+	pdTokenizer    *Tokenizer
+	dataOptions    DecodeOptions
+	pdDenormalizer *normalize.Denormalizer
+	abPending      []byte
+	iPosition      int
+}
+
+// NewIncrementalDecoder starts decoding a token stream, treating invalid ids as the options say
+func (t *Tokenizer) NewIncrementalDecoder(dataOptions DecodeOptions) (*IncrementalDecoder, error) {
+	if err := dataOptions.Validate(); err != nil {
+		return nil, err
+	}
+	return &IncrementalDecoder{pdTokenizer: t, dataOptions: dataOptions, pdDenormalizer: t.pdNormalizer.NewDenormalizer()}, nil
+}
+
+// Decode adds the next token and returns the text it completes, which may be empty. In strict mode
+// an invalid id fails with an InvalidTokensError and leaves the decoder as it was.
+func (d *IncrementalDecoder) Decode(lToken int64) (string, error) {
+	sText, tfOK := d.pdTokenizer.IDToToken(lToken)
+	if !tfOK {
+		if d.dataOptions.Mode == DecodeStrict {
+			return "", &InvalidTokensError{Positions: []int{d.iPosition}, Tokens: []int64{lToken}}
+		}
+		sText = d.dataOptions.replacement()
+	}
+	d.iPosition++
+
+	// hold back a trailing incomplete UTF-8 sequence
+	d.abPending = append(d.abPending, sText...)
+	iComplete := len(d.abPending)
+	for iIndex := len(d.abPending) - 1; iIndex >= 0 && iIndex >= len(d.abPending)-utf8.UTFMax; iIndex-- {
+		if utf8.RuneStart(d.abPending[iIndex]) {
+			if !utf8.FullRune(d.abPending[iIndex:]) {
+				iComplete = iIndex
+			}
+			break
+		}
+	}
+	sOutput := d.pdDenormalizer.Write(string(d.abPending[:iComplete]))
+	d.abPending = d.abPending[:copy(d.abPending, d.abPending[iComplete:])]
+	return sOutput, nil
+}
+
+// Flush ends the stream and returns the text still held back
+func (d *IncrementalDecoder) Flush() string {
+	sOutput := d.pdDenormalizer.Write(string(d.abPending)) + d.pdDenormalizer.Flush()
+	d.abPending = d.abPending[:0]
+	return sOutput
+}
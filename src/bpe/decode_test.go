@@ -0,0 +1,210 @@
+package bpe
+
+import (
+	"errors"
+	"normalize"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TestDecodeCaseMarkers checks that an artifact with case markers decodes to the original casing,
+// with markers merged into tokens or on their own, where a lowercasing artifact folds it
+func TestDecodeCaseMarkers(t *testing.T) {
+	abData := newTestArtifact(t, nil, []testMerge{{"\ue000", "p"}, {"\ue000p", "a"}, {"r", "i"}, {"\ue001", "n"}, {"a", "s"}}, PreTokenizerWhitespace)
+	pdMarkers := mustTokenizer(t, editTestArtifact(t, abData, func(pdArtifact *artifact) {
+		pdArtifact.Normalizer = &normalize.Config{Form: normalize.FormNFC, CaseMarkers: true, Whitespace: normalize.WhitespacePreserve}
+	}))
+	pdLowercase := mustTokenizer(t, editTestArtifact(t, abData, func(pdArtifact *artifact) {
+		pdArtifact.Normalizer = &normalize.Config{Form: normalize.FormNFC, Lowercase: true, Whitespace: normalize.WhitespacePreserve}
+	}))
+	for _, sInput := range []string{"Paris", "NASA paris PaRIS", "iPhone X", "ÉCOLE Élan", "İ ß 123", ""} {
+		sDecoded, err := pdMarkers.Decode(pdMarkers.Encode(sInput))
+		if err != nil || sDecoded != sInput {
+			t.Errorf("%q decodes to %q, %v", sInput, sDecoded, err)
+		}
+	}
+	if alTokens := pdMarkers.Encode("Paris"); len(alTokens) != 3 {
+		t.Errorf("Paris encodes to %q, want the shift marker merged with pa", pdMarkers.TokenTexts(alTokens))
+	}
+	if sDecoded, _ := pdLowercase.Decode(pdLowercase.Encode("Paris")); sDecoded != "paris" {
+		t.Errorf("lowercasing artifact decodes Paris to %q", sDecoded)
+	}
+}
+
+// TestDecodeHangulJamo checks that an artifact in the Jamo mode merges Jamo shared across
+// syllables and decodes them back into syllables
+func TestDecodeHangulJamo(t *testing.T) {
+	abData := newTestArtifact(t, nil, []testMerge{{"\u1100", "\u1161"}, {"\u1112", "\u1161"}, {"\u1161", "\u11ab"}}, PreTokenizerWhitespace)
+	pdTokenizer := mustTokenizer(t, editTestArtifact(t, abData, func(pdArtifact *artifact) {
+		pdArtifact.Normalizer = &normalize.Config{Form: normalize.FormNFC, Whitespace: normalize.WhitespacePreserve, HangulJamo: true}
+	}))
+	if asTokens := pdTokenizer.TokenTexts(pdTokenizer.Encode("가각한")); !slices.Equal(asTokens, []string{"\u1100\u1161", "\u1100\u1161", "\u11a8", "\u1112\u1161", "\u11ab"}) {
+		t.Errorf("syllables encode to %q", asTokens)
+	}
+	for _, sInput := range []string{"가각한", "한국어 텍스트 입니다", "ㄱㅏ 가", ""} {
+		if sDecoded, err := pdTokenizer.Decode(pdTokenizer.Encode(sInput)); err != nil || sDecoded != sInput {
+			t.Errorf("%q decodes to %q, %v", sInput, sDecoded, err)
+		}
+	}
+}
+
+// TestDecodeOptions checks which ids strict decoding rejects and where, what lenient decoding
+// substitutes for them, and the options it refuses
+func TestDecodeOptions(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, nil, []testMerge{{"a", "b"}}, PreTokenizerNone))
+	lMinted := int64(unicode.MaxRune + 1)
+	for _, dataCase := range []struct {
+		sName       string
+		alTokens    []int64
+		sLenient    string
+		aiPositions []int
+	}{
+		{"valid", []int64{lMinted, 'c', 'é', '日'}, "abcé日", nil},
+		{"negative", []int64{'a', -1}, "a?", []int{1}},
+		{"surrogate", []int64{0xD800, 'a'}, "?a", []int{0}},
+		{"unused id past the vocabulary", []int64{lMinted, lMinted + 1, 1 << 40}, "ab??", []int{1, 2}},
+	} {
+		sText, err := pdTokenizer.DecodeWithOptions(dataCase.alTokens, DecodeOptions{Mode: DecodeLenient, Replacement: "?"})
+		if err != nil || sText != dataCase.sLenient {
+			t.Errorf("%s: lenient decoding gives %q, %v, want %q", dataCase.sName, sText, err, dataCase.sLenient)
+		}
+		sText, err = pdTokenizer.DecodeWithOptions(dataCase.alTokens, DecodeOptions{Mode: DecodeStrict})
+		var pdInvalid *InvalidTokensError
+		if dataCase.aiPositions == nil {
+			if err != nil {
+				t.Errorf("%s: strict decoding fails with %v", dataCase.sName, err)
+			}
+		} else if !errors.As(err, &pdInvalid) || !slices.Equal(pdInvalid.Positions, dataCase.aiPositions) || sText != "" {
+			t.Errorf("%s: strict decoding gives %q, %v, want invalid positions %v", dataCase.sName, sText, err, dataCase.aiPositions)
+		}
+	}
+
+	// U+FFFD stands in by default, and Decode is lenient
+	for _, dataOptions := range []DecodeOptions{{}, {Mode: DecodeLenient}} {
+		if sText, err := pdTokenizer.DecodeWithOptions([]int64{'a', -5}, dataOptions); err != nil || sText != "a�" {
+			t.Errorf("%+v: got %q, %v", dataOptions, sText, err)
+		}
+	}
+	if sText, err := pdTokenizer.Decode([]int64{-5}); err != nil || sText != "�" {
+		t.Errorf("Decode: got %q, %v", sText, err)
+	}
+
+	// byte-level vocabularies have no ids for code points outside them
+	pdByteLevel := importFixtureGPT2(t)
+	if _, err := pdByteLevel.DecodeWithOptions([]int64{'a', 0x4E00}, DecodeOptions{Mode: DecodeStrict}); err == nil {
+		t.Error("byte-level vocabulary decodes a code point it does not have")
+	}
+
+	// the message lists the first ids and counts the rest
+	alInvalid := make([]int64, iMaxListedTokens+3)
+	for iIndex := range alInvalid {
+		alInvalid[iIndex] = -int64(iIndex) - 1
+	}
+	_, err := pdTokenizer.DecodeWithOptions(alInvalid, DecodeOptions{Mode: DecodeStrict})
+	if err == nil || !strings.HasPrefix(err.Error(), "token ids outside the vocabulary: -1 at position 0, -2 at position 1,") || !strings.HasSuffix(err.Error(), ", and 3 more") {
+		t.Errorf("long error: %v", err)
+	}
+
+	if _, err := pdTokenizer.DecodeWithOptions([]int64{'a'}, DecodeOptions{Mode: "loose"}); err == nil || !strings.Contains(err.Error(), `unknown decoding mode "loose"`) {
+		t.Errorf("unknown mode: got %v", err)
+	}
+}
+
+// TestIncrementalDecoder checks that decoding one token at a time gives the text of Decode in
+// complete runes, holding back split UTF-8, case markers and Jamo, and that a strict decoder
+// rejects an invalid id without losing what it holds
+func TestIncrementalDecoder(t *testing.T) {
+	pdByteLevel := importFixtureGPT2(t)
+	alBytes := pdByteLevel.pdArtifact.Bytes
+	abData := newTestArtifact(t, nil, []testMerge{{"\ue000", "p"}, {"\u1100", "\u1161"}}, PreTokenizerWhitespace)
+	pdMarkers := mustTokenizer(t, editTestArtifact(t, abData, func(pdArtifact *artifact) {
+		pdArtifact.Normalizer = &normalize.Config{Form: normalize.FormNFC, CaseMarkers: true, Whitespace: normalize.WhitespacePreserve}
+	}))
+	pdJamo := mustTokenizer(t, editTestArtifact(t, abData, func(pdArtifact *artifact) {
+		pdArtifact.Normalizer = &normalize.Config{Form: normalize.FormNFC, Whitespace: normalize.WhitespacePreserve, HangulJamo: true}
+	}))
+	for _, dataCase := range []struct {
+		sName       string
+		pdTokenizer *Tokenizer
+		alTokens    []int64
+		asPieces    []string
+	}{
+		{"split rune", pdByteLevel, []int64{alBytes['a'], alBytes[0xE6], alBytes[0x97], alBytes[0xA5], alBytes['b']}, []string{"a", "", "", "日", "b"}},
+		{"split emoji", pdByteLevel, []int64{alBytes[0xF0], alBytes[0x9F], alBytes[0x91], alBytes[0x8D]}, []string{"", "", "", "👍"}},
+		{"truncated rune", pdByteLevel, []int64{alBytes[0xE6], alBytes[0x97]}, []string{"", ""}},
+		{"case marker", pdMarkers, pdMarkers.Encode("Paris NASA"), nil},
+		{"jamo", pdJamo, pdJamo.Encode("가각 한국어"), nil},
+		{"invalid id", pdMarkers, []int64{'a', -1, 'b'}, []string{"a", "�", "b"}},
+	} {
+		sExpected, err := dataCase.pdTokenizer.Decode(dataCase.alTokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pdDecoder, err := dataCase.pdTokenizer.NewIncrementalDecoder(DecodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var asPieces []string
+		for _, lToken := range dataCase.alTokens {
+			sPiece, err := pdDecoder.Decode(lToken)
+			if err != nil || !utf8.ValidString(sPiece) {
+				t.Errorf("%s: token %d gives %q, %v", dataCase.sName, lToken, sPiece, err)
+			}
+			asPieces = append(asPieces, sPiece)
+		}
+		if sText := strings.Join(asPieces, "") + pdDecoder.Flush(); sText != sExpected {
+			t.Errorf("%s: pieces %q and the flush give %q, want %q", dataCase.sName, asPieces, sText, sExpected)
+		}
+		if dataCase.asPieces != nil && !slices.Equal(asPieces, dataCase.asPieces) {
+			t.Errorf("%s: pieces %q, want %q", dataCase.sName, asPieces, dataCase.asPieces)
+		}
+	}
+
+	// a marker or a leading consonant is only written once the next token shows what it becomes
+	for _, dataCase := range []struct {
+		pdTokenizer *Tokenizer
+		alTokens    []int64
+		asPieces    []string
+	}{
+		{pdMarkers, []int64{0xE000, 'p', 'a'}, []string{"", "P", "a"}},
+		{pdJamo, []int64{0x1100, 0x1161, ' '}, []string{"", "", "가 "}},
+	} {
+		pdDecoder, _ := dataCase.pdTokenizer.NewIncrementalDecoder(DecodeOptions{})
+		var asPieces []string
+		for _, lToken := range dataCase.alTokens {
+			sPiece, _ := pdDecoder.Decode(lToken)
+			asPieces = append(asPieces, sPiece)
+		}
+		if !slices.Equal(asPieces, dataCase.asPieces) {
+			t.Errorf("%v: pieces %q, want %q", dataCase.alTokens, asPieces, dataCase.asPieces)
+		}
+	}
+
+	// strict decoders keep the bytes they hold back across a rejected id, which has its position
+	pdDecoder, err := pdByteLevel.NewIncrementalDecoder(DecodeOptions{Mode: DecodeStrict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asPieces []string
+	for _, lToken := range []int64{alBytes['a'], alBytes[0xE6], -7, alBytes[0x97], 1 << 40, alBytes[0xA5]} {
+		sPiece, err := pdDecoder.Decode(lToken)
+		var pdInvalid *InvalidTokensError
+		if lToken < 0 || lToken > unicode.MaxRune {
+			if !errors.As(err, &pdInvalid) || !slices.Equal(pdInvalid.Tokens, []int64{lToken}) || !slices.Equal(pdInvalid.Positions, []int{len(asPieces)}) {
+				t.Errorf("invalid id %d: got %q, %v", lToken, sPiece, err)
+			}
+			continue
+		}
+		asPieces = append(asPieces, sPiece)
+	}
+	if sText := strings.Join(asPieces, "") + pdDecoder.Flush(); sText != "a日" {
+		t.Errorf("strict decoder gives %q", sText)
+	}
+
+	if _, err := pdByteLevel.NewIncrementalDecoder(DecodeOptions{Mode: "best effort"}); err == nil || !strings.Contains(err.Error(), `unknown decoding mode "best effort"`) {
+		t.Errorf("unknown mode: got %v", err)
+	}
+}
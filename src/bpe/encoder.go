@@ -0,0 +1,238 @@
+package bpe
+
+import (
+	"normalize"
+)
+
+// Encoder applies the merges of an artifact. Merges are compiled once into a table from a pair of
+// token ids to the id it merges into and the rank of the merge, its position in the ordering;
+// binary artifacts are searched in place instead.
+// Trained artifacts mint ids in that order, imported vocabularies number their tokens as they like.
+// Input is split into the chunks used in training, which merges never cross, and the encoding of
+// every chunk can be cached.
+type Encoder struct {
+	mapRules      map[[2]int64]mergeRule
+	pdTable       *tokenTable
+	alBytes       []int64
+	mapUnits      map[string]int64
+	sPreTokenizer string
+	pdCache       *chunkCache
+}
+
+// mergeRule is the token a pair of tokens merges into and the rank of that merge
+type mergeRule struct {
+	lRank  int64
+	lToken int64
+}
+
+// NewEncoder compiles the merges and base units of an artifact
+func NewEncoder(mapTokenizer map[string]interface{}) (*Encoder, error) {
+	pdArtifact, err := parseArtifact(mapTokenizer)
+	if err != nil {
+		return nil, err
+	}
+	mapRanks, err := pdArtifact.ranks()
+	if err != nil {
+		return nil, err
+	}
+	return pdArtifact.encoder(mapRanks, nil)
+}
+
+// Encode converts a string to a token list after applying the given normalizer
+func (e *Encoder) Encode(pdNormalizer *normalize.Normalizer, sInput string) []int64 {
+	return e.encode(pdNormalizer.Normalize(sInput))
+}
+
+// unitID looks up the id of a multi-rune base unit
+func (e *Encoder) unitID(sCluster string) (int64, bool) {
+	lUnit, tfOK := e.mapUnits[sCluster]
+	return lUnit, tfOK
+}
+
+// units converts a chunk to its base units; byte-level vocabularies start from the bytes of the
+// chunk rather than its code points
+func (e *Encoder) units(sChunk string) []int64 {
+	if e.alBytes == nil {
+		return toUnits(sChunk, e.unitID)
+	}
+	alUnits := make([]int64, len(sChunk))
+	for iIndex := range len(sChunk) {
+		alUnits[iIndex] = e.alBytes[sChunk[iIndex]]
+	}
+	return alUnits
+}
+
+// mergeCandidate is an adjacent pair of symbols that a merge applies to
+type mergeCandidate struct {
+	lRank  int64
+	lToken int64
+	iLeft  int
+	iRight int
+	lLeft  int64
+	lRight int64
+}
+
+// mergeQueue is a min-heap of candidates ordered by rank, then by position. It is typed rather than
+// built on container/heap so candidates are not boxed into interfaces.
+type mergeQueue []mergeCandidate
+
+// less orders two candidates of the queue
+func (q mergeQueue) less(i int, j int) bool {
+	if q[i].lRank != q[j].lRank {
+		return q[i].lRank < q[j].lRank
+	}
+	return q[i].iLeft < q[j].iLeft
+}
+
+// push adds a candidate and moves it up to its place
+func (q *mergeQueue) push(dataCandidate mergeCandidate) {
+	*q = append(*q, dataCandidate)
+	for iChild := len(*q) - 1; iChild > 0; {
+		iParent := (iChild - 1) / 2
+		if !q.less(iChild, iParent) {
+			break
+		}
+		(*q)[iChild], (*q)[iParent] = (*q)[iParent], (*q)[iChild]
+		iChild = iParent
+	}
+}
+
+// pop removes the smallest candidate, moving the last one down from the top to its place
+func (q *mergeQueue) pop() mergeCandidate {
+	dataCandidate := (*q)[0]
+	iLast := len(*q) - 1
+	(*q)[0] = (*q)[iLast]
+	*q = (*q)[:iLast]
+	for iParent := 0; ; {
+		iSmallest := iParent
+		for _, iChild := range [2]int{2*iParent + 1, 2*iParent + 2} {
+			if iChild < iLast && q.less(iChild, iSmallest) {
+				iSmallest = iChild
+			}
+		}
+		if iSmallest == iParent {
+			break
+		}
+		(*q)[iParent], (*q)[iSmallest] = (*q)[iSmallest], (*q)[iParent]
+		iParent = iSmallest
+	}
+	return dataCandidate
+}
+
+// encode converts a normalized string chunk by chunk, reusing cached chunk encodings
+func (e *Encoder) encode(sInput string) []int64 {
+	alResult := make([]int64, 0, len(sInput))
+	for sChunk := range preTokenize(e.sPreTokenizer, sInput) {
+		alResult = append(alResult, e.encodeChunk(sChunk)...)
+	}
+	return alResult
+}
+
+// encodeChunk merges a single pre-tokenized chunk, through the cache if there is one
+func (e *Encoder) encodeChunk(sChunk string) []int64 {
+	if e.pdCache == nil || len(sChunk) > iMaxCachedChunk {
+		return e.mergeChunk(sChunk)
+	}
+	alTokens, tfOK := e.pdCache.get(sChunk)
+	if !tfOK {
+		alTokens = e.mergeChunk(sChunk)
+		e.pdCache.put(sChunk, alTokens)
+	}
+	return alTokens
+}
+
+// count returns the number of tokens encode produces for a normalized string without building them
+func (e *Encoder) count(sInput string) int {
+	iCount := 0
+	for sChunk := range preTokenize(e.sPreTokenizer, sInput) {
+		if e.pdCache != nil && len(sChunk) <= iMaxCachedChunk {
+			alTokens, tfOK := e.pdCache.get(sChunk)
+			if !tfOK {
+				alTokens = e.mergeChunk(sChunk)
+				e.pdCache.put(sChunk, alTokens)
+			}
+			iCount += len(alTokens)
+			continue
+		}
+		alTokens, aiNext := e.mergeSymbols(sChunk)
+		for iIndex := 0; iIndex >= 0 && len(alTokens) > 0; iIndex = aiNext[iIndex] {
+			iCount++
+		}
+	}
+	return iCount
+}
+
+// mergeChunk merges a single chunk and collects its tokens
+func (e *Encoder) mergeChunk(sInput string) []int64 {
+	alTokens, aiNext := e.mergeSymbols(sInput)
+	alResult := make([]int64, 0, len(alTokens))
+	for iIndex := 0; iIndex >= 0 && len(alTokens) > 0; iIndex = aiNext[iIndex] {
+		alResult = append(alResult, alTokens[iIndex])
+	}
+	return alResult
+}
+
+// mergeSymbols merges the base units of a chunk. Symbols form a linked list over their original
+// positions and the lowest-ranked adjacent pair is merged first, leftmost first among equal ranks.
+// This applies every merge to all of its occurrences left to right before any later merge, like
+// training did. The tokens left are those reached from the first symbol through aiNext.
+func (e *Encoder) mergeSymbols(sInput string) ([]int64, []int) {
+	alTokens := e.units(sInput)
+
+	// doubly linked list of symbols; merged-away symbols are marked with -1
+	aiPrevious := make([]int, len(alTokens))
+	aiNext := make([]int, len(alTokens))
+	for iIndex := range alTokens {
+		aiPrevious[iIndex] = iIndex - 1
+		aiNext[iIndex] = iIndex + 1
+	}
+	if len(alTokens) > 0 {
+		aiNext[len(alTokens)-1] = -1
+	}
+
+	// queue every pair that has a merge
+	dataQueue := make(mergeQueue, 0, len(alTokens))
+	fnPush := func(iLeft int, iRight int) {
+		if iLeft < 0 || iRight < 0 {
+			return
+		}
+		if dataRule, tfOK := e.rule(alTokens[iLeft], alTokens[iRight]); tfOK {
+			dataQueue.push(mergeCandidate{lRank: dataRule.lRank, lToken: dataRule.lToken, iLeft: iLeft, iRight: iRight, lLeft: alTokens[iLeft], lRight: alTokens[iRight]})
+		}
+	}
+	for iIndex := 0; iIndex+1 < len(alTokens); iIndex++ {
+		fnPush(iIndex, iIndex+1)
+	}
+
+	// merge until no pair is left, skipping candidates an earlier merge made stale
+	for len(dataQueue) > 0 {
+		dataCandidate := dataQueue.pop()
+		iLeft, iRight := dataCandidate.iLeft, dataCandidate.iRight
+		if alTokens[iLeft] != dataCandidate.lLeft || alTokens[iRight] != dataCandidate.lRight || aiNext[iLeft] != iRight {
+			continue
+		}
+
+		// the left symbol takes the merged token and the right one leaves the list
+		alTokens[iLeft] = dataCandidate.lToken
+		alTokens[iRight] = -1
+		aiNext[iLeft] = aiNext[iRight]
+		if aiNext[iRight] >= 0 {
+			aiPrevious[aiNext[iRight]] = iLeft
+		}
+
+		// the merged symbol forms new pairs with its neighbours
+		fnPush(aiPrevious[iLeft], iLeft)
+		fnPush(iLeft, aiNext[iLeft])
+	}
+
+	return alTokens, aiNext
+}
+
+// rule finds the merge of a pair of tokens in the compiled table, or in the binary artifact
+func (e *Encoder) rule(lLeft int64, lRight int64) (mergeRule, bool) {
+	if e.mapRules != nil {
+		dataRule, tfOK := e.mapRules[[2]int64{lLeft, lRight}]
+		return dataRule, tfOK
+	}
+	return e.pdTable.rule(lLeft, lRight)
+}
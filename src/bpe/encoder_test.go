@@ -0,0 +1,271 @@
+package bpe
+
+import (
+	"encoding/json"
+	"normalize"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// testMerge is a merge spelled by the texts of the two tokens it joins
+type testMerge [2]string
+
+// newTestArtifact writes a trained artifact without a header: base units get ids after the code
+// points and every merge mints the next id, as training does. Tokens are looked up by their text.
+func newTestArtifact(t testing.TB, asUnits []string, aMerges []testMerge, sPreTokenizer string) []byte {
+	t.Helper()
+	pdArtifact := &artifact{
+		Merges:       make(map[string]int64),
+		Units:        make(map[string]int64),
+		PreTokenizer: sPreTokenizer,
+		Normalizer:   &normalize.Config{Form: normalize.FormNone, Whitespace: normalize.WhitespacePreserve},
+	}
+	mapIDs := make(map[string]int64)
+	lNext := int64(unicode.MaxRune + 1)
+	for _, sUnit := range asUnits {
+		pdArtifact.Units[sUnit] = lNext
+		mapIDs[sUnit] = lNext
+		lNext++
+	}
+	fnID := func(sToken string) int64 {
+		if lID, tfOK := mapIDs[sToken]; tfOK {
+			return lID
+		}
+		r, iSize := utf8.DecodeRuneInString(sToken)
+		if iSize != len(sToken) {
+			t.Fatalf("token %q is neither a code point nor an earlier merge", sToken)
+		}
+		return int64(r)
+	}
+	for _, dataMerge := range aMerges {
+		alPair := [2]int64{fnID(dataMerge[0]), fnID(dataMerge[1])}
+		pdArtifact.Merges[keyToString(alPair)] = lNext
+		pdArtifact.Ordering = append(pdArtifact.Ordering, alPair)
+		if _, tfOK := mapIDs[dataMerge[0]+dataMerge[1]]; !tfOK {
+			mapIDs[dataMerge[0]+dataMerge[1]] = lNext
+		}
+		lNext++
+	}
+	abData, err := json.Marshal(pdArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abData
+}
+
+// editTestArtifact changes the decoded form of an artifact and writes it again
+func editTestArtifact(t testing.TB, abData []byte, fnEdit func(pdArtifact *artifact)) []byte {
+	t.Helper()
+	pdArtifact := &artifact{}
+	if err := json.Unmarshal(abData, pdArtifact); err != nil {
+		t.Fatal(err)
+	}
+	fnEdit(pdArtifact)
+	abData, err := json.Marshal(pdArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abData
+}
+
+// mustTokenizer loads a tokenizer from artifact contents or fails the test
+func mustTokenizer(t testing.TB, abData []byte) *Tokenizer {
+	t.Helper()
+	pdTokenizer, err := NewTokenizerFromBytes(abData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pdTokenizer
+}
+
+// referenceMerge is the original merge loop: the pair with the lowest rank anywhere in the symbols
+// is replaced at all of its occurrences left to right, until no adjacent pair has a merge
+func referenceMerge(e *Encoder, alTokens []int64) []int64 {
+	for {
+		var alBest [2]int64
+		var dataBest mergeRule
+		tfFound := false
+		for iIndex := 0; iIndex+1 < len(alTokens); iIndex++ {
+			dataRule, tfOK := e.rule(alTokens[iIndex], alTokens[iIndex+1])
+			if tfOK && (!tfFound || dataRule.lRank < dataBest.lRank) {
+				alBest, dataBest, tfFound = [2]int64{alTokens[iIndex], alTokens[iIndex+1]}, dataRule, true
+			}
+		}
+		if !tfFound {
+			return alTokens
+		}
+		alMerged := make([]int64, 0, len(alTokens))
+		for iIndex := 0; iIndex < len(alTokens); {
+			if iIndex+1 < len(alTokens) && alTokens[iIndex] == alBest[0] && alTokens[iIndex+1] == alBest[1] {
+				alMerged = append(alMerged, dataBest.lToken)
+				iIndex += 2
+				continue
+			}
+			alMerged = append(alMerged, alTokens[iIndex])
+			iIndex++
+		}
+		alTokens = alMerged
+	}
+}
+
+// referenceEncode normalizes and pre-tokenizes like the tokenizer and merges every chunk with the original loop
+func referenceEncode(pdTokenizer *Tokenizer, sInput string) []int64 {
+	alResult := []int64{}
+	pdEncoder := pdTokenizer.pdEncoder
+	for sChunk := range preTokenize(pdEncoder.sPreTokenizer, pdTokenizer.pdNormalizer.Normalize(sInput)) {
+		alResult = append(alResult, referenceMerge(pdEncoder, pdEncoder.units(sChunk))...)
+	}
+	return alResult
+}
+
+// merge tables with the cases the heap has to get right, and inputs for each
+var aEncoderCases = []struct {
+	sName   string
+	asUnits []string
+	aMerges []testMerge
+	asInput []string
+}{
+	{
+		sName:   "empty",
+		aMerges: []testMerge{{"a", "b"}},
+		asInput: []string{"", "a", "b", "c"},
+	},
+	{
+		sName:   "overlapping pairs",
+		aMerges: []testMerge{{"a", "a"}},
+		asInput: []string{"aa", "aaa", "aaaa", "aaaaa", "baaab"},
+	},
+	{
+		sName:   "overlapping merges of merges",
+		aMerges: []testMerge{{"a", "a"}, {"aa", "a"}, {"aa", "aa"}},
+		asInput: []string{"aaa", "aaaa", "aaaaa", "aaaaaaa", "aaaaaaaaaaa"},
+	},
+	{
+		sName:   "ties between occurrences of equal rank",
+		aMerges: []testMerge{{"a", "b"}, {"b", "a"}, {"ab", "ab"}, {"ba", "b"}},
+		asInput: []string{"abab", "baba", "ababab", "bababab", "abba", "babbab"},
+	},
+	{
+		sName:   "merges that make an earlier pair",
+		aMerges: []testMerge{{"b", "c"}, {"c", "a"}, {"a", "bc"}, {"abc", "a"}},
+		asInput: []string{"abc", "abca", "abcabc", "bcabc", "cabca"},
+	},
+	{
+		sName:   "multi-byte code points",
+		aMerges: []testMerge{{"é", "é"}, {"日", "本"}, {"éé", "日本"}},
+		asInput: []string{"éé日本", "ééé日本日本", "日本é"},
+	},
+	{
+		sName:   "emoji units",
+		asUnits: []string{"👍🏽", "👨‍👩‍👧", "🇫🇷"},
+		aMerges: []testMerge{{"👍🏽", "👍🏽"}, {"a", "👍🏽"}, {"👨‍👩‍👧", "🇫🇷"}, {"👍", "!"}},
+		asInput: []string{"👍🏽👍🏽👍🏽", "a👍🏽👍🏽", "👨‍👩‍👧🇫🇷", "👍!👍🏽!", "👨‍👩👍🏽🇫🇷"},
+	},
+}
+
+// TestMergeSymbolsReference compares the heap against the original loop on small merge tables
+func TestMergeSymbolsReference(t *testing.T) {
+	for _, dataCase := range aEncoderCases {
+		pdTokenizer := mustTokenizer(t, newTestArtifact(t, dataCase.asUnits, dataCase.aMerges, PreTokenizerNone))
+		for _, sInput := range dataCase.asInput {
+			alExpected := referenceEncode(pdTokenizer, sInput)
+			if alActual := pdTokenizer.Encode(sInput); !slices.Equal(alActual, alExpected) {
+				t.Errorf("%s: %q encodes to %v, want %v", dataCase.sName, sInput, alActual, alExpected)
+			}
+		}
+	}
+}
+
+// TestMergeSymbolsArtifact compares the heap against the original loop with the trained artifact
+func TestMergeSymbolsArtifact(t *testing.T) {
+	pdTokenizer, err := LoadTokenizer("../../artifacts/merges.json")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, sInput := range testTexts(t) {
+		alExpected := referenceEncode(pdTokenizer, sInput)
+		if alActual := pdTokenizer.Encode(sInput); !slices.Equal(alActual, alExpected) {
+			t.Errorf("%q encodes to %v, want %v", sInput, alActual, alExpected)
+		}
+	}
+}
+
+// TestCountMatchesEncode checks Count against Encode with and without a cache and pre-tokenizer,
+// including chunks too long to be cached
+func TestCountMatchesEncode(t *testing.T) {
+	asInputs := append(testTexts(t), strings.Repeat("ab", iMaxCachedChunk), strings.Repeat("a", iMaxCachedChunk+1)+" b")
+	for _, dataCase := range aEncoderCases {
+		asInputs = append(asInputs, dataCase.asInput...)
+	}
+	for _, sPreTokenizer := range []string{PreTokenizerNone, PreTokenizerWhitespace} {
+		for _, dataCase := range aEncoderCases {
+			pdTokenizer := mustTokenizer(t, newTestArtifact(t, dataCase.asUnits, dataCase.aMerges, sPreTokenizer))
+			for _, pdVariant := range []*Tokenizer{pdTokenizer, pdTokenizer.WithCache(64)} {
+				for _, sInput := range asInputs {
+					if iCount, iLength := pdVariant.Count(sInput), len(pdVariant.Encode(sInput)); iCount != iLength {
+						t.Errorf("%s, %s: Count(%q) = %d, Encode gives %d tokens", dataCase.sName, sPreTokenizer, sInput, iCount, iLength)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestArtifactNormalizer checks that Encode applies the normalizer recorded in the artifact, the
+// default pipeline for artifacts without one, and that an invalid one fails to load
+func TestArtifactNormalizer(t *testing.T) {
+	abData := newTestArtifact(t, nil, []testMerge{{"A", "B"}, {"a", "b"}}, PreTokenizerNone)
+	for _, dataCase := range []struct {
+		sName      string
+		pdConfig   *normalize.Config
+		sInput     string
+		asExpected []string
+	}{
+		{"recorded pipeline keeps case", &normalize.Config{Form: normalize.FormNone, Whitespace: normalize.WhitespacePreserve}, "ABab", []string{"AB", "ab"}},
+		{"recorded pipeline lowercases", &normalize.Config{Form: normalize.FormNFKC, Lowercase: true, Whitespace: normalize.WhitespacePreserve}, "ＡＢ", []string{"ab"}},
+		{"default pipeline without one", nil, "AB 👍", []string{"ab", " "}},
+	} {
+		pdTokenizer := mustTokenizer(t, editTestArtifact(t, abData, func(pdArtifact *artifact) {
+			pdArtifact.Normalizer = dataCase.pdConfig
+		}))
+		if asTokens := pdTokenizer.TokenTexts(pdTokenizer.Encode(dataCase.sInput)); !slices.Equal(asTokens, dataCase.asExpected) {
+			t.Errorf("%s: %q encodes to %q, want %q", dataCase.sName, dataCase.sInput, asTokens, dataCase.asExpected)
+		}
+		dataExpected := normalize.DefaultConfig()
+		if dataCase.pdConfig != nil {
+			dataExpected = *dataCase.pdConfig
+		}
+		if dataConfig := pdTokenizer.Metadata().Normalizer; !reflect.DeepEqual(dataConfig, dataExpected) {
+			t.Errorf("%s: metadata reports normalizer %+v, want %+v", dataCase.sName, dataConfig, dataExpected)
+		}
+	}
+
+	_, err := NewTokenizerFromBytes(editTestArtifact(t, abData, func(pdArtifact *artifact) {
+		pdArtifact.Normalizer = &normalize.Config{Form: "nfx", Whitespace: normalize.WhitespacePreserve}
+	}))
+	if err == nil || !strings.Contains(err.Error(), "invalid normalizer in artifact: form:") {
+		t.Errorf("invalid normalizer: got %v", err)
+	}
+}
+
+// testTexts returns the paragraphs of the README, cut to a length the reference loop gets through quickly
+func testTexts(t testing.TB) []string {
+	t.Helper()
+	abData, err := os.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asTexts []string
+	for _, sParagraph := range strings.Split(string(abData), "\n\n") {
+		if aRunes := []rune(sParagraph); len(aRunes) > 400 {
+			sParagraph = string(aRunes[:400])
+		}
+		asTexts = append(asTexts, sParagraph)
+	}
+	return append(asTexts, "Emoji 👍🏽 and 👨‍👩‍👧 with ©️ and ÉCOLE ｆｕｌｌ")
+}
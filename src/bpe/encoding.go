@@ -0,0 +1,252 @@
+package bpe
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sides truncation removes tokens from
+const (
+	TruncateRight = "right"
+	TruncateLeft  = "left"
+)
+
+// Padding modes
+const (
+	PadNone      = "none"
+	PadMaxLength = "max_length"
+)
+
+// EncodeOptions shapes an encoding into fixed-length model input. Without a max length the input
+// is neither truncated nor split into windows.
+type EncodeOptions struct {
+	// longest encoding to return; tokens beyond it are truncated or moved to overflowing windows
+	MaxLength  int    `json:"max_length,omitempty"`
+	Truncation string `json:"truncation,omitempty"`
+
+	// return every window of max length tokens instead of only the first, each window repeating
+	// the last Stride tokens of the one before it
+	Overflow bool `json:"overflow,omitempty"`
+	Stride   int  `json:"stride,omitempty"`
+
+	// name of the template in the artifact that wraps the sequences in special tokens
+	Template string `json:"template,omitempty"`
+
+	// pad to max length and/or up to a multiple of a length with a special token
+	Padding         string `json:"padding,omitempty"`
+	PadToMultipleOf int    `json:"pad_to_multiple_of,omitempty"`
+	PadToken        string `json:"pad_token,omitempty"`
+}
+
+// Validate checks the options and reports every problem it finds at once
+func (o EncodeOptions) Validate() error {
+	var aErrors []error
+	if o.MaxLength < 0 {
+		aErrors = append(aErrors, fmt.Errorf("max_length: must not be negative, got %d", o.MaxLength))
+	}
+	if o.Truncation != "" && o.Truncation != TruncateRight && o.Truncation != TruncateLeft {
+		aErrors = append(aErrors, fmt.Errorf("truncation: unknown side %q (expected %q or %q)", o.Truncation, TruncateRight, TruncateLeft))
+	}
+	if o.Overflow && o.MaxLength == 0 {
+		aErrors = append(aErrors, errors.New("overflow: requires max_length"))
+	}
+	if o.Stride < 0 || (o.Stride > 0 && o.Stride >= o.MaxLength) {
+		aErrors = append(aErrors, fmt.Errorf("stride: must be between 0 and max_length - 1, got %d", o.Stride))
+	}
+	if o.Padding != "" && o.Padding != PadNone && o.Padding != PadMaxLength {
+		aErrors = append(aErrors, fmt.Errorf("padding: unknown mode %q (expected %q or %q)", o.Padding, PadNone, PadMaxLength))
+	}
+	if o.Padding == PadMaxLength && o.MaxLength == 0 {
+		aErrors = append(aErrors, errors.New("padding: max_length padding requires max_length"))
+	}
+	if o.PadToMultipleOf < 0 {
+		aErrors = append(aErrors, fmt.Errorf("pad_to_multiple_of: must not be negative, got %d", o.PadToMultipleOf))
+	}
+	if o.isPadded() && o.PadToken == "" {
+		aErrors = append(aErrors, errors.New("pad_token: required for padding"))
+	}
+	return errors.Join(aErrors...)
+}
+
+// isPadded checks if the options ask for any padding
+func (o EncodeOptions) isPadded() bool {
+	return o.Padding == PadMaxLength || o.PadToMultipleOf > 0
+}
+
+// Encoding is one window of model input. The attention mask is 1 for every token but padding;
+// padding and special tokens added by a template have empty offsets. Type ids tell the sequences
+// of a pair apart.
+type Encoding struct {
+	Tokens        []int64    `json:"tokens"`
+	AttentionMask []int      `json:"attention_mask"`
+	TypeIDs       []int      `json:"type_ids"`
+	Offsets       []Offset   `json:"offsets"`
+	Overflowing   []Encoding `json:"overflowing,omitempty"`
+}
+
+// EncodeWithOptions encodes a string with its offsets, wraps it in the selected template and
+// applies truncation, overflowing windows and padding. With overflow, the first window is returned
+// and the rest are in its Overflowing list; truncating on the left makes the last window the first
+// one. The max length includes the special tokens of the template.
+func (t *Tokenizer) EncodeWithOptions(sInput string, dataOptions EncodeOptions) (Encoding, error) {
+	return t.encodeWithOptions([]string{sInput}, dataOptions)
+}
+
+// EncodePairWithOptions encodes two strings as a pair with the pair pattern of the selected
+// template. Truncation removes tokens from the longer sequence first; overflow is not supported.
+func (t *Tokenizer) EncodePairWithOptions(sFirst string, sSecond string, dataOptions EncodeOptions) (Encoding, error) {
+	return t.encodeWithOptions([]string{sFirst, sSecond}, dataOptions)
+}
+
+// encodeWithOptions encodes one or two sequences into model input
+func (t *Tokenizer) encodeWithOptions(asInputs []string, dataOptions EncodeOptions) (Encoding, error) {
+	if err := dataOptions.Validate(); err != nil {
+		return Encoding{}, err
+	}
+	if len(asInputs) > 1 && dataOptions.Overflow {
+		return Encoding{}, errors.New("overflow: not supported for pairs")
+	}
+	lPad := int64(0)
+	if dataOptions.isPadded() {
+		var tfOK bool
+		if lPad, tfOK = t.TokenToID(dataOptions.PadToken); !tfOK {
+			return Encoding{}, fmt.Errorf("pad_token: %q is not in the vocabulary", dataOptions.PadToken)
+		}
+	}
+	aPieces, err := t.pattern(dataOptions.Template, len(asInputs) > 1)
+	if err != nil {
+		return Encoding{}, err
+	}
+
+	// the max length has to leave room for the special tokens
+	iBudget := 0
+	if dataOptions.MaxLength > 0 {
+		iBudget = dataOptions.MaxLength - addedTokens(aPieces)
+		if iBudget < 1 {
+			return Encoding{}, fmt.Errorf("max_length: %d leaves no room next to the %d special tokens of the template", dataOptions.MaxLength, addedTokens(aPieces))
+		}
+		if dataOptions.Stride >= iBudget {
+			return Encoding{}, fmt.Errorf("stride: must be less than the %d tokens max_length leaves next to the special tokens of the template", iBudget)
+		}
+	}
+
+	// encode every sequence
+	aSequences := make([]Encoding, len(asInputs))
+	for iIndex, sInput := range asInputs {
+		alTokens, aOffsets, err := t.EncodeWithOffsets(sInput)
+		if err != nil {
+			return Encoding{}, err
+		}
+		aSequences[iIndex] = Encoding{Tokens: alTokens, AttentionMask: make([]int, len(alTokens)), Offsets: aOffsets}
+		for iPosition := range alTokens {
+			aSequences[iIndex].AttentionMask[iPosition] = 1
+		}
+	}
+
+	// cut a single sequence into windows, or truncate a pair
+	aaWindows := [][]Encoding{aSequences}
+	if len(aSequences) == 1 && iBudget > 0 && len(aSequences[0].Tokens) > iBudget {
+		aaWindows = nil
+		for _, aiWindow := range windows(len(aSequences[0].Tokens), iBudget, dataOptions) {
+			aaWindows = append(aaWindows, []Encoding{sliceEncoding(aSequences[0], aiWindow)})
+			if !dataOptions.Overflow {
+				break
+			}
+		}
+	} else if len(aSequences) == 2 && iBudget > 0 {
+		truncatePair(aSequences, iBudget, dataOptions.Truncation)
+	}
+
+	// wrap and pad every window
+	aEncodings := make([]Encoding, len(aaWindows))
+	for iIndex, aWindow := range aaWindows {
+		dataEncoding := t.applyPattern(aPieces, aWindow)
+		for iLength := paddedLength(len(dataEncoding.Tokens), dataOptions); len(dataEncoding.Tokens) < iLength; {
+			dataEncoding.Tokens = append(dataEncoding.Tokens, lPad)
+			dataEncoding.AttentionMask = append(dataEncoding.AttentionMask, 0)
+			dataEncoding.TypeIDs = append(dataEncoding.TypeIDs, 0)
+			dataEncoding.Offsets = append(dataEncoding.Offsets, Offset{})
+		}
+		aEncodings[iIndex] = dataEncoding
+	}
+	if len(aEncodings) > 1 {
+		aEncodings[0].Overflowing = aEncodings[1:]
+	}
+	return aEncodings[0], nil
+}
+
+// pattern looks up the single or pair pattern of a template by name; no name selects "$A" and "$A $B"
+func (t *Tokenizer) pattern(sTemplate string, tfPair bool) ([]templatePiece, error) {
+	pdTemplate := pdDefaultTemplate
+	if sTemplate != "" {
+		var tfOK bool
+		if pdTemplate, tfOK = t.mapTemplates[sTemplate]; !tfOK {
+			return nil, fmt.Errorf("template: unknown template %q", sTemplate)
+		}
+	}
+	if !tfPair {
+		return pdTemplate.aSingle, nil
+	}
+	if pdTemplate.aPair == nil {
+		return nil, fmt.Errorf("template: %q has no pair pattern", sTemplate)
+	}
+	return pdTemplate.aPair, nil
+}
+
+// windows returns the bounds of windows of iLength tokens covering iTokens tokens, each one
+// overlapping the one before it by the stride. The first window is the one truncation keeps.
+func windows(iTokens int, iLength int, dataOptions EncodeOptions) [][2]int {
+	iStep := iLength - dataOptions.Stride
+	var aWindows [][2]int
+	for iCovered := 0; ; iCovered += iStep {
+		iEnd := min(iCovered+iLength, iTokens)
+		if dataOptions.Truncation == TruncateLeft {
+			aWindows = append(aWindows, [2]int{iTokens - iEnd, iTokens - iCovered})
+		} else {
+			aWindows = append(aWindows, [2]int{iCovered, iEnd})
+		}
+		if iEnd == iTokens {
+			return aWindows
+		}
+	}
+}
+
+// sliceEncoding copies the tokens of an encoding between the bounds of a window
+func sliceEncoding(dataEncoding Encoding, aiWindow [2]int) Encoding {
+	return Encoding{
+		Tokens:        append([]int64(nil), dataEncoding.Tokens[aiWindow[0]:aiWindow[1]]...),
+		AttentionMask: append([]int(nil), dataEncoding.AttentionMask[aiWindow[0]:aiWindow[1]]...),
+		Offsets:       append([]Offset(nil), dataEncoding.Offsets[aiWindow[0]:aiWindow[1]]...),
+	}
+}
+
+// truncatePair removes tokens from the longer of two sequences until both fit in iBudget tokens
+func truncatePair(aSequences []Encoding, iBudget int, sTruncation string) {
+	aiLengths := [2]int{len(aSequences[0].Tokens), len(aSequences[1].Tokens)}
+	for aiLengths[0]+aiLengths[1] > iBudget {
+		if aiLengths[0] >= aiLengths[1] {
+			aiLengths[0]--
+		} else {
+			aiLengths[1]--
+		}
+	}
+	for iIndex, iLength := range aiLengths {
+		aiWindow := [2]int{0, iLength}
+		if sTruncation == TruncateLeft {
+			iTokens := len(aSequences[iIndex].Tokens)
+			aiWindow = [2]int{iTokens - iLength, iTokens}
+		}
+		aSequences[iIndex] = sliceEncoding(aSequences[iIndex], aiWindow)
+	}
+}
+
+// paddedLength returns the length a window of iLength tokens is padded to
+func paddedLength(iLength int, dataOptions EncodeOptions) int {
+	if dataOptions.Padding == PadMaxLength {
+		iLength = max(iLength, dataOptions.MaxLength)
+	}
+	if iMultiple := dataOptions.PadToMultipleOf; iMultiple > 0 && iLength%iMultiple != 0 {
+		iLength += iMultiple - iLength%iMultiple
+	}
+	return iLength
+}
@@ -0,0 +1,114 @@
+package bpe
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// newSpecialTokenizer builds a tokenizer whose only merge is "xy", so that every other code point
+// is a token, with special tokens for templates and padding
+func newSpecialTokenizer(t *testing.T) *Tokenizer {
+	t.Helper()
+	return mustTokenizer(t, editTestArtifact(t, newTestArtifact(t, nil, []testMerge{{"x", "y"}}, PreTokenizerWhitespace), func(pdArtifact *artifact) {
+		pdArtifact.SpecialTokens = map[string]int64{"<cls>": unicode.MaxRune + 2, "<sep>": unicode.MaxRune + 3, "<pad>": unicode.MaxRune + 4}
+	}))
+}
+
+// TestEncodeWithOptions checks truncation on both sides, overflowing windows with and without a
+// stride, and padding to a max length or a multiple, on a sequence of eight tokens
+func TestEncodeWithOptions(t *testing.T) {
+	pdTokenizer := newSpecialTokenizer(t)
+	for _, dataCase := range []struct {
+		sName       string
+		dataOptions EncodeOptions
+		asWindows   []string
+		iPadding    int
+	}{
+		{"no options", EncodeOptions{}, []string{"abcdefgh"}, 0},
+		{"shorter than max length", EncodeOptions{MaxLength: 20}, []string{"abcdefgh"}, 0},
+		{"truncate right", EncodeOptions{MaxLength: 5}, []string{"abcde"}, 0},
+		{"truncate left", EncodeOptions{MaxLength: 5, Truncation: TruncateLeft}, []string{"defgh"}, 0},
+		{"overflow", EncodeOptions{MaxLength: 3, Overflow: true}, []string{"abc", "def", "gh"}, 0},
+		{"overflow with stride", EncodeOptions{MaxLength: 3, Overflow: true, Stride: 1}, []string{"abc", "cde", "efg", "gh"}, 0},
+		{"overflow on the left", EncodeOptions{MaxLength: 3, Overflow: true, Truncation: TruncateLeft}, []string{"fgh", "cde", "ab"}, 0},
+		{"pad to max length", EncodeOptions{MaxLength: 10, Padding: PadMaxLength, PadToken: "<pad>"}, []string{"abcdefgh"}, 2},
+		{"truncated, so not padded", EncodeOptions{MaxLength: 5, Padding: PadMaxLength, PadToken: "<pad>"}, []string{"abcde"}, 0},
+		{"pad to a multiple", EncodeOptions{PadToMultipleOf: 3, PadToken: "<pad>"}, []string{"abcdefgh"}, 1},
+		{"pad every window", EncodeOptions{MaxLength: 3, Overflow: true, Padding: PadMaxLength, PadToken: "<pad>"}, []string{"abc", "def", "gh"}, 1},
+	} {
+		dataEncoding, err := pdTokenizer.EncodeWithOptions("abcdefgh", dataCase.dataOptions)
+		if err != nil {
+			t.Errorf("%s: %v", dataCase.sName, err)
+			continue
+		}
+		aEncodings := append([]Encoding{dataEncoding}, dataEncoding.Overflowing...)
+		if len(aEncodings) != len(dataCase.asWindows) {
+			t.Errorf("%s: got %d windows, want %d", dataCase.sName, len(aEncodings), len(dataCase.asWindows))
+			continue
+		}
+		for iIndex, dataWindow := range aEncodings {
+			// only the last window can be short enough to need padding
+			iPadding := 0
+			if iIndex == len(aEncodings)-1 {
+				iPadding = dataCase.iPadding
+			}
+			sWindow := dataCase.asWindows[iIndex]
+			asTokens := pdTokenizer.TokenTexts(dataWindow.Tokens)
+			asExpected := append(strings.Split(sWindow, ""), slices.Repeat([]string{"<pad>"}, iPadding)...)
+			if !slices.Equal(asTokens, asExpected) {
+				t.Errorf("%s: window %d is %q, want %q", dataCase.sName, iIndex, asTokens, asExpected)
+				continue
+			}
+			iStart := strings.Index("abcdefgh", sWindow)
+			for iPosition := range asTokens {
+				iMask, dataOffset := 1, Offset{ByteStart: iStart + iPosition, ByteEnd: iStart + iPosition + 1, RuneStart: iStart + iPosition, RuneEnd: iStart + iPosition + 1}
+				if iPosition >= len(sWindow) {
+					iMask, dataOffset = 0, Offset{}
+				}
+				if dataWindow.AttentionMask[iPosition] != iMask || dataWindow.Offsets[iPosition] != dataOffset || dataWindow.TypeIDs[iPosition] != 0 {
+					t.Errorf("%s: window %d position %d has mask %d, offset %+v, type %d", dataCase.sName, iIndex, iPosition, dataWindow.AttentionMask[iPosition], dataWindow.Offsets[iPosition], dataWindow.TypeIDs[iPosition])
+				}
+			}
+		}
+	}
+}
+
+// TestEncodeOptionsErrors checks the options Validate refuses, all of them at once, and the ones
+// that only fail against the vocabulary or a pair
+func TestEncodeOptionsErrors(t *testing.T) {
+	for _, dataCase := range []struct {
+		dataOptions EncodeOptions
+		asErrors    []string
+	}{
+		{EncodeOptions{MaxLength: -1}, []string{"max_length: must not be negative"}},
+		{EncodeOptions{Truncation: "middle"}, []string{`truncation: unknown side "middle"`}},
+		{EncodeOptions{Overflow: true}, []string{"overflow: requires max_length"}},
+		{EncodeOptions{MaxLength: 4, Stride: 4}, []string{"stride: must be between 0 and max_length - 1, got 4"}},
+		{EncodeOptions{MaxLength: 4, Stride: -1}, []string{"stride:"}},
+		{EncodeOptions{Padding: "longest", PadToken: "<pad>"}, []string{`padding: unknown mode "longest"`}},
+		{EncodeOptions{Padding: PadMaxLength, PadToken: "<pad>"}, []string{"padding: max_length padding requires max_length"}},
+		{EncodeOptions{PadToMultipleOf: -8}, []string{"pad_to_multiple_of: must not be negative"}},
+		{EncodeOptions{MaxLength: 4, Padding: PadMaxLength}, []string{"pad_token: required for padding"}},
+		{EncodeOptions{Overflow: true, Stride: 2, Padding: PadMaxLength}, []string{"overflow:", "stride:", "padding:", "pad_token:"}},
+	} {
+		err := dataCase.dataOptions.Validate()
+		for _, sError := range dataCase.asErrors {
+			if err == nil || !strings.Contains(err.Error(), sError) {
+				t.Errorf("%+v: got %v, want %q", dataCase.dataOptions, err, sError)
+			}
+		}
+	}
+	if err := (EncodeOptions{MaxLength: 8, Overflow: true, Stride: 7, Padding: PadNone}).Validate(); err != nil {
+		t.Errorf("valid options: %v", err)
+	}
+
+	pdTokenizer := newSpecialTokenizer(t)
+	if _, err := pdTokenizer.EncodeWithOptions("abc", EncodeOptions{PadToMultipleOf: 4, PadToken: "[PAD]"}); err == nil || !strings.Contains(err.Error(), `pad_token: "[PAD]" is not in the vocabulary`) {
+		t.Errorf("unknown pad token: got %v", err)
+	}
+	if _, err := pdTokenizer.EncodePairWithOptions("abc", "def", EncodeOptions{MaxLength: 4, Overflow: true}); err == nil || !strings.Contains(err.Error(), "overflow: not supported for pairs") {
+		t.Errorf("overflowing pair: got %v", err)
+	}
+}
@@ -7,6 +7,8 @@ require (
 	github.com/aws/aws-sdk-go-v2/config v1.29.13
 	github.com/aws/aws-sdk-go-v2/credentials v1.17.66
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.79.1
+	golang.org/x/text v0.23.0
+	gopkg.in/yaml.v3 v3.0.1
 	normalize v0.0.0-00010101000000-000000000000
 )
 
@@ -25,7 +27,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.30.1 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.33.18 // indirect
 	github.com/aws/smithy-go v1.22.2 // indirect
-	golang.org/x/text v0.23.0 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
 )
 
 replace normalize => ../normalize
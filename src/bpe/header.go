@@ -0,0 +1,107 @@
+package bpe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ArtifactVersion is the newest artifact format this reader loads. Artifacts without a header are
+// version 0, the original format of merges and ordering; version 2 added byte-level vocabularies
+// imported from other tokenizers.
+const ArtifactVersion = 2
+
+// formats written by the trainer and by imports; only artifacts that need a newer reader get a newer version
+const (
+	iTrainedVersion   = 1
+	iByteLevelVersion = 2
+)
+
+// ErrUnsupportedVersion is returned for artifacts written in a newer format than this reader knows
+var ErrUnsupportedVersion = errors.New("bpe: artifact format is newer than this reader")
+
+// ArtifactHeader describes an artifact: the format it is written in, when and from what it was
+// trained or imported, and the vocabulary it defines
+type ArtifactHeader struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at,omitzero"`
+	Source    string       `json:"source,omitempty"`
+	VocabSize int          `json:"vocab_size,omitempty"`
+	Alphabet  string       `json:"alphabet,omitempty"`
+	Corpus    *CorpusStats `json:"corpus,omitempty"`
+}
+
+// CorpusStats summarizes the corpus an artifact was trained on, after sampling and normalization
+type CorpusStats struct {
+	Sources   []DataSource   `json:"sources"`
+	Languages map[string]int `json:"languages"`
+	Sentences int            `json:"sentences"`
+	Chunks    int            `json:"chunks"`
+	Units     int64          `json:"units"`
+}
+
+// checkVersion reads only the format version of an artifact, so that newer artifacts are refused
+// before their contents are decoded with the wrong schema
+func checkVersion(abData []byte) error {
+	var dataVersion struct {
+		Header struct {
+			Version int `json:"version"`
+		} `json:"header"`
+	}
+	if err := json.Unmarshal(abData, &dataVersion); err != nil {
+		return fmt.Errorf("failed to decode artifact header: %w", err)
+	}
+	iVersion := dataVersion.Header.Version
+	if iVersion < 0 {
+		return fmt.Errorf("invalid artifact format version %d", iVersion)
+	}
+	if iVersion > ArtifactVersion {
+		return fmt.Errorf("%w: artifact is version %d, this reader supports up to version %d", ErrUnsupportedVersion, iVersion, ArtifactVersion)
+	}
+	return nil
+}
+
+// header describes the corpus of the dataset before any merge: the code points it is made of and
+// how much text there is in every language
+func (d *dataDataset) header(pdConfig *TrainingConfig) ArtifactHeader {
+	mapAlphabet := make(map[rune]bool)
+	var lUnits int64
+	for _, alSentence := range d.aalSentences {
+		for _, lToken := range alSentence {
+			if lToken <= unicode.MaxRune {
+				mapAlphabet[rune(lToken)] = true
+			}
+		}
+		lUnits += int64(len(alSentence))
+	}
+
+	iSentences := 0
+	for _, iCount := range d.mapLanguages {
+		iSentences += iCount
+	}
+	return ArtifactHeader{
+		Alphabet: string(slices.Sorted(maps.Keys(mapAlphabet))),
+		Corpus: &CorpusStats{
+			Sources:   pdConfig.Data.Sources,
+			Languages: maps.Clone(d.mapLanguages),
+			Sentences: iSentences,
+			Chunks:    len(d.aalSentences),
+			Units:     lUnits,
+		},
+	}
+}
+
+// stamp completes the header of merges about to be written with the format version, the current
+// time and the size of the vocabulary
+func (m *Merges) stamp() ArtifactHeader {
+	dataHeader := m.dataHeader
+	dataHeader.Version = iTrainedVersion
+	dataHeader.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	dataHeader.VocabSize = utf8.RuneCountInString(dataHeader.Alphabet) + len(m.mapUnits) + len(m.mapSpecialTokens) + len(m.mapMerges)
+	return dataHeader
+}
@@ -0,0 +1,76 @@
+package bpe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckVersion checks which format versions load, that newer ones are refused before their
+// contents are read, and that artifacts without a header load as version 0
+func TestCheckVersion(t *testing.T) {
+	sBody := `"merges": {"97,98": 1114112}, "ordering": [[97, 98]]`
+	for _, dataCase := range []struct {
+		sName       string
+		sArtifact   string
+		iVersion    int
+		errExpected error
+		sError      string
+	}{
+		{"two keys", `{` + sBody + `}`, 0, nil, ""},
+		{"empty header", `{"header": {}, ` + sBody + `}`, 0, nil, ""},
+		{"trained", `{"header": {"version": 1, "source": "train"}, ` + sBody + `}`, 1, nil, ""},
+		{"byte-level", `{"header": {"version": 2}, ` + sBody + `}`, 2, nil, ""},
+		{"newer", `{"header": {"version": 3}, "merges": ["a new schema"]}`, 0, ErrUnsupportedVersion, "artifact is version 3, this reader supports up to version 2"},
+		{"negative", `{"header": {"version": -1}, ` + sBody + `}`, 0, nil, "invalid artifact format version -1"},
+		{"version is not a number", `{"header": {"version": "2"}, ` + sBody + `}`, 0, nil, "failed to decode artifact header"},
+		{"not json", `merges`, 0, nil, "failed to decode artifact header"},
+	} {
+		pdTokenizer, err := NewTokenizerFromBytes([]byte(dataCase.sArtifact))
+		if dataCase.sError == "" {
+			if err != nil {
+				t.Errorf("%s: %v", dataCase.sName, err)
+			} else if dataMetadata := pdTokenizer.Metadata(); dataMetadata.Version != dataCase.iVersion || dataMetadata.Merges != 1 {
+				t.Errorf("%s: metadata %+v", dataCase.sName, dataMetadata)
+			} else if alTokens := pdTokenizer.Encode("ab"); len(alTokens) != 1 || alTokens[0] != 1114112 {
+				t.Errorf("%s: ab encodes to %v", dataCase.sName, alTokens)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), dataCase.sError) || (dataCase.errExpected != nil && !errors.Is(err, dataCase.errExpected)) {
+			t.Errorf("%s: got %v, want %q", dataCase.sName, err, dataCase.sError)
+		}
+	}
+}
+
+// TestTrainedMetadata checks the header training writes and that Metadata reports it along with
+// the vocabulary, and copies what a caller could change
+func TestTrainedMetadata(t *testing.T) {
+	tsBefore := time.Now().UTC().Add(-time.Second)
+	pdTokenizer := trainTestTokenizer(t, map[string][]string{"en": {"the cat", "the hat"}, "fr": {"le chat"}}, func(pdConfig *TrainingConfig) {})
+	dataMetadata := pdTokenizer.Metadata()
+	if dataMetadata.Version != iTrainedVersion || dataMetadata.Source != "" || dataMetadata.ByteLevel {
+		t.Errorf("version %d, source %q, byte level %v", dataMetadata.Version, dataMetadata.Source, dataMetadata.ByteLevel)
+	}
+	if dataMetadata.CreatedAt.Before(tsBefore.Truncate(time.Second)) || dataMetadata.CreatedAt.After(time.Now()) {
+		t.Errorf("created at %v", dataMetadata.CreatedAt)
+	}
+	if dataMetadata.VocabSize != pdTokenizer.VocabSize() || dataMetadata.VocabSize != len([]rune(dataMetadata.Alphabet))+dataMetadata.Units+len(dataMetadata.SpecialTokens)+dataMetadata.Merges {
+		t.Errorf("vocabulary of %d tokens, tokenizer has %d", dataMetadata.VocabSize, pdTokenizer.VocabSize())
+	}
+	if dataMetadata.Alphabet != " acehlt" {
+		t.Errorf("alphabet %q", dataMetadata.Alphabet)
+	}
+	if dataCorpus := dataMetadata.Corpus; dataCorpus == nil || dataCorpus.Languages["en"] != 2 || dataCorpus.Languages["fr"] != 1 || dataCorpus.Sentences != 3 || len(dataCorpus.Sources) != 1 {
+		t.Errorf("corpus %+v", dataCorpus)
+	}
+	if dataMetadata.Training == nil || dataMetadata.Training.Stopping.MaxMerges != 40 {
+		t.Errorf("training configuration %+v", dataMetadata.Training)
+	}
+
+	dataMetadata.Corpus.Languages["en"] = 0
+	if pdTokenizer.Metadata().Corpus.Languages["en"] != 2 {
+		t.Error("metadata shares the corpus languages of the tokenizer")
+	}
+}
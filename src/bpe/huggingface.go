@@ -0,0 +1,210 @@
+package bpe
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"normalize"
+	"slices"
+)
+
+// whitespace as isSpace sees it, the White_Space property and the metaspace, for Oniguruma
+const sOnigSpace = `\x{9}-\x{D} \x{85}\x{A0}\x{1680}\x{2000}-\x{200A}\x{2028}\x{2029}\x{202F}\x{205F}\x{3000}\x{2581}`
+
+// hfTokenizer is the layout of a Hugging Face tokenizer.json
+type hfTokenizer struct {
+	Version       string                 `json:"version"`
+	Truncation    interface{}            `json:"truncation"`
+	Padding       interface{}            `json:"padding"`
+	AddedTokens   []hfAddedToken         `json:"added_tokens"`
+	Normalizer    map[string]interface{} `json:"normalizer"`
+	PreTokenizer  map[string]interface{} `json:"pre_tokenizer"`
+	PostProcessor map[string]interface{} `json:"post_processor"`
+	Decoder       map[string]interface{} `json:"decoder"`
+	Model         hfModel                `json:"model"`
+}
+
+// hfAddedToken is a special token of a tokenizer.json, matched in the raw input
+type hfAddedToken struct {
+	ID         int64  `json:"id"`
+	Content    string `json:"content"`
+	SingleWord bool   `json:"single_word"`
+	LStrip     bool   `json:"lstrip"`
+	RStrip     bool   `json:"rstrip"`
+	Normalized bool   `json:"normalized"`
+	Special    bool   `json:"special"`
+}
+
+// hfModel is the BPE model of a tokenizer.json; merges are pairs rather than space-separated
+// strings so tokens may contain spaces, which needs tokenizers 0.20 or later
+type hfModel struct {
+	Type                    string           `json:"type"`
+	Dropout                 *float64         `json:"dropout"`
+	UnkToken                *string          `json:"unk_token"`
+	ContinuingSubwordPrefix *string          `json:"continuing_subword_prefix"`
+	EndOfWordSuffix         *string          `json:"end_of_word_suffix"`
+	FuseUnk                 bool             `json:"fuse_unk"`
+	ByteFallback            bool             `json:"byte_fallback"`
+	IgnoreMerges            bool             `json:"ignore_merges"`
+	Vocab                   map[string]int64 `json:"vocab"`
+	Merges                  hfMerges         `json:"merges"`
+}
+
+// HuggingFaceJSON converts the tokenizer into a Hugging Face tokenizer.json whose encodings, with
+// special tokens left in the text, equal Encode. The named template becomes the post-processor;
+// none leaves it out. tokenizers drops characters outside the base alphabet, so the characters of
+// sAlphabet are added to it, which version 0 artifacts need for anything their merges do not use.
+// Settings tokenizers cannot reproduce exactly are reported as errors.
+func (t *Tokenizer) HuggingFaceJSON(sTemplate string, sAlphabet string) ([]byte, error) {
+	if len(t.pdArtifact.Units) > 0 {
+		return nil, errors.New("units: tokenizers splits words into code points and has no multi-rune base units")
+	}
+	if len(t.pdArtifact.Bytes) > 0 {
+		return nil, errors.New("bytes: byte-level artifacts are imported from tokenizers, export the tokenizer.json they came from instead")
+	}
+	dataConfig := t.pdNormalizer.Config()
+	aSteps, err := dataConfig.HuggingFace()
+	if err != nil {
+		return nil, fmt.Errorf("normalizer: %w", err)
+	}
+	dataModel, err := t.huggingFaceModel(sAlphabet)
+	if err != nil {
+		return nil, err
+	}
+	dataTokenizer := hfTokenizer{
+		Version:     "1.0",
+		AddedTokens: []hfAddedToken{},
+		Model:       dataModel,
+	}
+
+	// special tokens in id order; the vocabulary holds them too, or tokenizers would give them new ids
+	for _, sSpecialToken := range slices.SortedFunc(maps.Keys(t.pdArtifact.SpecialTokens), func(sA string, sB string) int {
+		return cmp.Compare(t.pdArtifact.SpecialTokens[sA], t.pdArtifact.SpecialTokens[sB])
+	}) {
+		dataTokenizer.AddedTokens = append(dataTokenizer.AddedTokens, hfAddedToken{ID: t.pdArtifact.SpecialTokens[sSpecialToken], Content: sSpecialToken, Special: true})
+	}
+
+	// normalizers run in the order of the pipeline
+	if len(aSteps) > 0 {
+		dataTokenizer.Normalizer = map[string]interface{}{"type": "Sequence", "normalizers": aSteps}
+	}
+
+	// a chunk is a run of whitespace followed by a run of anything else, or trailing whitespace
+	if t.pdEncoder.sPreTokenizer == PreTokenizerWhitespace {
+		dataTokenizer.PreTokenizer = map[string]interface{}{
+			"type":     "Split",
+			"pattern":  map[string]string{"Regex": "[" + sOnigSpace + "]*[^" + sOnigSpace + "]+|[" + sOnigSpace + "]+"},
+			"behavior": "Isolated",
+			"invert":   false,
+		}
+	}
+
+	if sTemplate != "" {
+		if dataTokenizer.PostProcessor, err = t.huggingFaceTemplate(sTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	// tokens are concatenated rather than joined with spaces, then the metaspace and prefix space undone
+	aDecoders := []map[string]interface{}{{"type": "Fuse"}}
+	if dataConfig.Whitespace == normalize.WhitespaceMetaspace {
+		aDecoders = append(aDecoders, map[string]interface{}{"type": "Replace", "pattern": map[string]string{"String": string(normalize.Metaspace)}, "content": " "})
+	}
+	if dataConfig.AddPrefixSpace {
+		aDecoders = append(aDecoders, map[string]interface{}{"type": "Strip", "content": " ", "start": 1, "stop": 0})
+	}
+	dataTokenizer.Decoder = map[string]interface{}{"type": "Sequence", "decoders": aDecoders}
+
+	abData, err := json.MarshalIndent(dataTokenizer, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tokenizer.json: %w", err)
+	}
+	return abData, nil
+}
+
+// huggingFaceModel lists the base alphabet with the extra characters, special tokens and minted
+// tokens by text, which tokenizers requires to be unique, and the merges in training order
+func (t *Tokenizer) huggingFaceModel(sAlphabet string) (hfModel, error) {
+	aalOrdering := t.pdTable.ordering()
+	dataModel := hfModel{Type: "BPE", Vocab: make(map[string]int64), Merges: make(hfMerges, 0, len(aalOrdering))}
+	fnAdd := func(sText string, lID int64) error {
+		if lExisting, tfOK := dataModel.Vocab[sText]; tfOK && lExisting != lID {
+			return fmt.Errorf("tokens %d and %d both spell %q, but tokenizers keys its vocabulary by text", lExisting, lID, sText)
+		}
+		dataModel.Vocab[sText] = lID
+		return nil
+	}
+
+	// the alphabet of the corpus if the artifact records it, the extra characters and the code points the merges use
+	if t.pdArtifact.Header != nil {
+		sAlphabet = t.pdArtifact.Header.Alphabet + sAlphabet
+	}
+	for _, r := range sAlphabet {
+		if err := fnAdd(string(r), int64(r)); err != nil {
+			return hfModel{}, err
+		}
+	}
+	for _, alPair := range aalOrdering {
+		for _, lID := range alPair {
+			if _, tfOK := t.pdTable.text(lID); tfOK {
+				continue
+			}
+			if err := fnAdd(string(rune(lID)), lID); err != nil {
+				return hfModel{}, err
+			}
+		}
+	}
+
+	for sSpecialToken, lID := range t.pdArtifact.SpecialTokens {
+		if err := fnAdd(sSpecialToken, lID); err != nil {
+			return hfModel{}, err
+		}
+	}
+	for _, alPair := range aalOrdering {
+		dataRule, _ := t.pdTable.rule(alPair[0], alPair[1])
+		if err := fnAdd(t.TokenText(alPair[0])+t.TokenText(alPair[1]), dataRule.lToken); err != nil {
+			return hfModel{}, err
+		}
+		dataModel.Merges = append(dataModel.Merges, [2]string{t.TokenText(alPair[0]), t.TokenText(alPair[1])})
+	}
+	return dataModel, nil
+}
+
+// huggingFaceTemplate converts a template into a TemplateProcessing post-processor. Templates
+// without a pair pattern get "$A $B", as encoding a pair without a template does.
+func (t *Tokenizer) huggingFaceTemplate(sTemplate string) (map[string]interface{}, error) {
+	pdTemplate, tfOK := t.mapTemplates[sTemplate]
+	if !tfOK {
+		return nil, fmt.Errorf("template: unknown template %q", sTemplate)
+	}
+	aPair := pdTemplate.aPair
+	if aPair == nil {
+		aPair = pdDefaultTemplate.aPair
+	}
+
+	mapSpecialTokens := make(map[string]interface{})
+	fnPieces := func(aPieces []templatePiece) []interface{} {
+		aResult := make([]interface{}, len(aPieces))
+		for iIndex, dataPiece := range aPieces {
+			if dataPiece.iSequence >= 0 {
+				aResult[iIndex] = map[string]interface{}{"Sequence": map[string]interface{}{"id": [2]string{"A", "B"}[dataPiece.iSequence], "type_id": dataPiece.iTypeID}}
+				continue
+			}
+			aResult[iIndex] = map[string]interface{}{"SpecialToken": map[string]interface{}{"id": dataPiece.sSpecialToken, "type_id": dataPiece.iTypeID}}
+			mapSpecialTokens[dataPiece.sSpecialToken] = map[string]interface{}{
+				"id":     dataPiece.sSpecialToken,
+				"ids":    []int64{t.pdArtifact.SpecialTokens[dataPiece.sSpecialToken]},
+				"tokens": []string{dataPiece.sSpecialToken},
+			}
+		}
+		return aResult
+	}
+	return map[string]interface{}{
+		"type":           "TemplateProcessing",
+		"single":         fnPieces(pdTemplate.aSingle),
+		"pair":           fnPieces(aPair),
+		"special_tokens": mapSpecialTokens,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package bpe
+
+import (
+	"bufio"
+	"encoding/json"
+	"normalize"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newExportArtifact is a version 0 artifact with special tokens, a template and the whitespace
+// pre-tokenizer, whose merges use only some of the letters of its text
+func newExportArtifact(t *testing.T) []byte {
+	t.Helper()
+	pdArtifact := &artifact{}
+	abData := newTestArtifact(t, nil, []testMerge{{"t", "h"}, {"th", "e"}, {" ", "the"}, {"a", "b"}}, PreTokenizerWhitespace)
+	if err := json.Unmarshal(abData, pdArtifact); err != nil {
+		t.Fatal(err)
+	}
+	pdArtifact.Normalizer = &normalize.Config{Form: normalize.FormNFC, Lowercase: true, Whitespace: normalize.WhitespacePreserve}
+	pdArtifact.SpecialTokens = map[string]int64{"<bos>": 0x110000 + 100, "<eos>": 0x110000 + 101}
+	pdArtifact.Templates = map[string]Template{"chat": {Single: "<bos> $A <eos>"}}
+	abData, err := json.Marshal(pdArtifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abData
+}
+
+// TestHuggingFaceJSON checks the structure of an exported tokenizer.json
+func TestHuggingFaceJSON(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newExportArtifact(t))
+	abData, err := pdTokenizer.HuggingFaceJSON("chat", "xé")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dataTokenizer hfTokenizer
+	if err := json.Unmarshal(abData, &dataTokenizer); err != nil {
+		t.Fatal(err)
+	}
+
+	// the vocabulary holds the code points of the merges, the extra characters, the special
+	// tokens and every minted token, each under its own id
+	mapExpected := map[string]int64{
+		"t": 't', "h": 'h', "e": 'e', " ": ' ', "a": 'a', "b": 'b', "x": 'x', "é": 'é',
+		"<bos>": 0x110000 + 100, "<eos>": 0x110000 + 101,
+		"th": 0x110000, "the": 0x110001, " the": 0x110002, "ab": 0x110003,
+	}
+	if len(dataTokenizer.Model.Vocab) != len(mapExpected) {
+		t.Errorf("vocab has %d tokens, want %d: %v", len(dataTokenizer.Model.Vocab), len(mapExpected), dataTokenizer.Model.Vocab)
+	}
+	for sToken, lID := range mapExpected {
+		if lActual, tfOK := dataTokenizer.Model.Vocab[sToken]; !tfOK || lActual != lID {
+			t.Errorf("vocab[%q] = %d, %v, want %d", sToken, lActual, tfOK, lID)
+		}
+	}
+	if dataTokenizer.Model.Type != "BPE" || !slices.Equal(dataTokenizer.Model.Merges, hfMerges{{"t", "h"}, {"th", "e"}, {" ", "the"}, {"a", "b"}}) {
+		t.Errorf("model is %s with merges %v", dataTokenizer.Model.Type, dataTokenizer.Model.Merges)
+	}
+
+	// special tokens, the pipeline and the template
+	if len(dataTokenizer.AddedTokens) != 2 || dataTokenizer.AddedTokens[0].Content != "<bos>" || !dataTokenizer.AddedTokens[1].Special {
+		t.Errorf("added tokens are %+v", dataTokenizer.AddedTokens)
+	}
+	if dataTokenizer.Normalizer["type"] != "Sequence" || dataTokenizer.PreTokenizer["type"] != "Split" || dataTokenizer.Decoder["type"] != "Sequence" {
+		t.Errorf("normalizer %v, pre-tokenizer %v, decoder %v", dataTokenizer.Normalizer, dataTokenizer.PreTokenizer, dataTokenizer.Decoder)
+	}
+	if dataTokenizer.PostProcessor["type"] != "TemplateProcessing" || len(dataTokenizer.PostProcessor["single"].([]interface{})) != 3 {
+		t.Errorf("post-processor is %v", dataTokenizer.PostProcessor)
+	}
+
+	// settings tokenizers cannot reproduce are refused
+	if _, err := pdTokenizer.HuggingFaceJSON("missing", ""); err == nil {
+		t.Error("an unknown template was accepted")
+	}
+	if _, err := mustTokenizer(t, newTestArtifact(t, []string{"👍🏽"}, []testMerge{{"👍🏽", "!"}}, PreTokenizerNone)).HuggingFaceJSON("", ""); err == nil {
+		t.Error("multi-rune base units were accepted")
+	}
+}
+
+// TestExportHuggingFaceSample checks that exporting with a sample puts the characters of the
+// sample in the vocabulary and records the tokens of every sentence
+func TestExportHuggingFaceSample(t *testing.T) {
+	sDirectory := t.TempDir()
+	sArtifactPath := filepath.Join(sDirectory, "merges.json")
+	sSamplePath := filepath.Join(sDirectory, "sample.json")
+	sOutputPath := filepath.Join(sDirectory, "tokenizer.json")
+	if err := os.WriteFile(sArtifactPath, newExportArtifact(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sSamplePath, []byte(`{"fr": ["Le thé", "Où ça"], "en": ["the tab"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportHuggingFace(sArtifactPath, "", sOutputPath, sSamplePath); err != nil {
+		t.Fatal(err)
+	}
+
+	abData, err := os.ReadFile(sOutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dataTokenizer hfTokenizer
+	if err := json.Unmarshal(abData, &dataTokenizer); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range "lethéoùç" {
+		if lID, tfOK := dataTokenizer.Model.Vocab[string(r)]; !tfOK || lID != int64(r) {
+			t.Errorf("vocab[%q] = %d, %v, want %d", r, lID, tfOK, r)
+		}
+	}
+
+	pdFile, err := os.Open(filepath.Join(sDirectory, "tokenizer.expected.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdFile.Close()
+	pdTokenizer := mustTokenizer(t, newExportArtifact(t))
+	var asTexts []string
+	for pdScanner := bufio.NewScanner(pdFile); pdScanner.Scan(); {
+		var dataRecord expectedEncoding
+		if err := json.Unmarshal(pdScanner.Bytes(), &dataRecord); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(dataRecord.Tokens, pdTokenizer.Encode(dataRecord.Text)) {
+			t.Errorf("%q recorded as %v, Encode gives %v", dataRecord.Text, dataRecord.Tokens, pdTokenizer.Encode(dataRecord.Text))
+		}
+		asTexts = append(asTexts, dataRecord.Language+":"+dataRecord.Text)
+	}
+	if sTexts := strings.Join(asTexts, "|"); sTexts != "en:the tab|fr:Le thé|fr:Où ça" {
+		t.Errorf("recorded %s", sTexts)
+	}
+}
@@ -0,0 +1,344 @@
+package bpe
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"normalize"
+	"os"
+	"strings"
+	"time"
+)
+
+// Formats of the vocabularies an artifact can be imported from
+const (
+	ImportFormatGPT2        = "gpt2"
+	ImportFormatHuggingFace = "huggingface"
+)
+
+// PreTokenizerGPT2 is the pre-tokenizer of vocabularies imported from GPT-2 style tokenizers;
+// training configurations cannot select it
+const PreTokenizerGPT2 = "gpt2"
+
+// byte-level BPE spells every byte with a printable character, as GPT-2's bytes_to_unicode does:
+// printable Latin-1 stands for itself and every other byte is shifted past U+00FF in byte order
+var arByteRunes, mapRuneBytes = byteLevelAlphabet()
+
+// byteLevelAlphabet builds the character of every byte and the byte of every character
+func byteLevelAlphabet() ([256]rune, map[rune]byte) {
+	var arRunes [256]rune
+	mapBytes := make(map[rune]byte, 256)
+	rShifted := rune(256)
+	for iByte := range 256 {
+		r := rune(iByte)
+		if r < '!' || (r > '~' && r < 0xA1) || r == 0xAD {
+			r = rShifted
+			rShifted++
+		}
+		arRunes[iByte] = r
+		mapBytes[r] = byte(iByte)
+	}
+	return arRunes, mapBytes
+}
+
+// fromByteLevel converts a token spelled in the byte-level alphabet back to its bytes
+func fromByteLevel(sToken string) (string, bool) {
+	abToken := make([]byte, 0, len(sToken))
+	for _, r := range sToken {
+		b, tfOK := mapRuneBytes[r]
+		if !tfOK {
+			return "", false
+		}
+		abToken = append(abToken, b)
+	}
+	return string(abToken), true
+}
+
+// hfMerges are the merges of a BPE model. Files written before tokenizers 0.20 spell every pair as
+// a single space-separated string, which is read as well.
+type hfMerges [][2]string
+
+func (m *hfMerges) UnmarshalJSON(abData []byte) error {
+	var aRawMerges []json.RawMessage
+	if err := json.Unmarshal(abData, &aRawMerges); err != nil {
+		return err
+	}
+	*m = make(hfMerges, len(aRawMerges))
+	for iIndex, abMerge := range aRawMerges {
+		if json.Unmarshal(abMerge, &(*m)[iIndex]) == nil {
+			continue
+		}
+		var sMerge string
+		if err := json.Unmarshal(abMerge, &sMerge); err != nil {
+			return fmt.Errorf("merges[%d]: expected a pair or a space-separated string", iIndex)
+		}
+		sLeft, sRight, tfOK := strings.Cut(sMerge, " ")
+		if !tfOK {
+			return fmt.Errorf("merges[%d]: %q is not a space-separated pair", iIndex, sMerge)
+		}
+		(*m)[iIndex] = [2]string{sLeft, sRight}
+	}
+	return nil
+}
+
+// hfComponent is a normalizer or pre-tokenizer of a tokenizer.json, possibly a sequence of them
+type hfComponent struct {
+	Type           string        `json:"type"`
+	Normalizers    []hfComponent `json:"normalizers"`
+	PreTokenizers  []hfComponent `json:"pretokenizers"`
+	AddPrefixSpace bool          `json:"add_prefix_space"`
+	UseRegex       *bool         `json:"use_regex"`
+}
+
+// steps flattens nested sequences into the components they run in order
+func (c *hfComponent) steps() []hfComponent {
+	if c == nil {
+		return nil
+	}
+	if c.Type != "Sequence" {
+		return []hfComponent{*c}
+	}
+	var aSteps []hfComponent
+	for iIndex := range c.Normalizers {
+		aSteps = append(aSteps, c.Normalizers[iIndex].steps()...)
+	}
+	for iIndex := range c.PreTokenizers {
+		aSteps = append(aSteps, c.PreTokenizers[iIndex].steps()...)
+	}
+	return aSteps
+}
+
+// ImportGPT2 reads a GPT-2 style vocabulary: vocab.json maps tokens spelled in the byte-level
+// alphabet to their ids and merges.txt lists one space-separated pair per line, in merge order,
+// after an optional #version line. Tokens no merge produces, such as <|endoftext|>, become special
+// tokens.
+func ImportGPT2(pdVocab io.Reader, pdMerges io.Reader) (*Tokenizer, error) {
+	mapVocab := make(map[string]int64)
+	if err := json.NewDecoder(pdVocab).Decode(&mapVocab); err != nil {
+		return nil, fmt.Errorf("failed to decode vocab.json: %w", err)
+	}
+
+	// read merges line by line, skipping the version and blank lines
+	var aMerges hfMerges
+	pdScanner := bufio.NewScanner(pdMerges)
+	pdScanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for iLine := 1; pdScanner.Scan(); iLine++ {
+		sLine := strings.TrimRight(pdScanner.Text(), "\r")
+		if sLine == "" || (iLine == 1 && strings.HasPrefix(sLine, "#version")) {
+			continue
+		}
+		sLeft, sRight, tfOK := strings.Cut(sLine, " ")
+		if !tfOK || strings.Contains(sRight, " ") {
+			return nil, fmt.Errorf("merges.txt line %d: %q is not a space-separated pair", iLine, sLine)
+		}
+		aMerges = append(aMerges, [2]string{sLeft, sRight})
+	}
+	if err := pdScanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read merges.txt: %w", err)
+	}
+
+	dataNormalizer := normalize.Config{Form: normalize.FormNone, Whitespace: normalize.WhitespacePreserve}
+	pdArtifact, err := importByteLevel(mapVocab, aMerges, nil, dataNormalizer, PreTokenizerGPT2, ImportFormatGPT2)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenizer(pdArtifact)
+}
+
+// ImportHuggingFace reads the byte-level BPE model of a Hugging Face tokenizer.json, as GPT-2 and
+// RoBERTa use. Unicode forms and lowercasing are the only normalizers carried over; anything else
+// the tokenizer.json does that Polyglot cannot reproduce exactly is reported as an error. Added
+// tokens become special tokens.
+func ImportHuggingFace(pdReader io.Reader) (*Tokenizer, error) {
+	var dataSource struct {
+		AddedTokens  []hfAddedToken `json:"added_tokens"`
+		Normalizer   *hfComponent   `json:"normalizer"`
+		PreTokenizer *hfComponent   `json:"pre_tokenizer"`
+		Model        hfModel        `json:"model"`
+	}
+	if err := json.NewDecoder(pdReader).Decode(&dataSource); err != nil {
+		return nil, fmt.Errorf("failed to decode tokenizer.json: %w", err)
+	}
+
+	// only byte-level BPE applied as trained maps onto artifacts
+	dataModel := dataSource.Model
+	var aErrors []error
+	if dataModel.Type != "BPE" {
+		aErrors = append(aErrors, fmt.Errorf("model: %q is not a BPE model", dataModel.Type))
+	}
+	if dataModel.Dropout != nil && *dataModel.Dropout > 0 {
+		aErrors = append(aErrors, errors.New("dropout: merges are always applied"))
+	}
+	if dataModel.ContinuingSubwordPrefix != nil && *dataModel.ContinuingSubwordPrefix != "" {
+		aErrors = append(aErrors, errors.New("continuing_subword_prefix: tokens are not marked by their position in a word"))
+	}
+	if dataModel.EndOfWordSuffix != nil && *dataModel.EndOfWordSuffix != "" {
+		aErrors = append(aErrors, errors.New("end_of_word_suffix: tokens are not marked by their position in a word"))
+	}
+	if dataModel.ByteFallback {
+		aErrors = append(aErrors, errors.New("byte_fallback: only byte-level vocabularies are supported"))
+	}
+	if dataModel.IgnoreMerges {
+		aErrors = append(aErrors, errors.New("ignore_merges: words are always merged, even those in the vocabulary"))
+	}
+	dataNormalizer, err := hfNormalizer(dataSource.Normalizer)
+	if err != nil {
+		aErrors = append(aErrors, fmt.Errorf("normalizer: %w", err))
+	}
+	sPreTokenizer, err := hfPreTokenizer(dataSource.PreTokenizer)
+	if err != nil {
+		aErrors = append(aErrors, fmt.Errorf("pre_tokenizer: %w", err))
+	}
+	if err := errors.Join(aErrors...); err != nil {
+		return nil, err
+	}
+
+	mapAdded := make(map[string]int64, len(dataSource.AddedTokens))
+	for _, dataToken := range dataSource.AddedTokens {
+		mapAdded[dataToken.Content] = dataToken.ID
+	}
+	pdArtifact, err := importByteLevel(dataModel.Vocab, dataModel.Merges, mapAdded, dataNormalizer, sPreTokenizer, ImportFormatHuggingFace)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenizer(pdArtifact)
+}
+
+// hfNormalizer converts the normalizers of a tokenizer.json: at most one Unicode form, then
+// lowercasing. tokenizers lowercases İ to i and a combining dot, which a replacement reproduces.
+func hfNormalizer(pdNormalizer *hfComponent) (normalize.Config, error) {
+	dataConfig := normalize.Config{Form: normalize.FormNone, Whitespace: normalize.WhitespacePreserve}
+	for _, dataStep := range pdNormalizer.steps() {
+		switch dataStep.Type {
+		case "NFC", "NFD", "NFKC", "NFKD":
+			if dataConfig.Form != normalize.FormNone || dataConfig.Lowercase {
+				return normalize.Config{}, fmt.Errorf("%s: only a single Unicode form, before lowercasing, is supported", dataStep.Type)
+			}
+			dataConfig.Form = strings.ToLower(dataStep.Type)
+		case "Lowercase":
+			dataConfig.Lowercase = true
+			dataConfig.Replacements = []normalize.Replacement{{Pattern: "İ", Replacement: "i\u0307"}}
+		default:
+			return normalize.Config{}, fmt.Errorf("%s: no Polyglot counterpart", dataStep.Type)
+		}
+	}
+	return dataConfig, nil
+}
+
+// hfPreTokenizer converts the ByteLevel pre-tokenizer of a tokenizer.json; it splits text like
+// GPT-2 unless it is told not to use its regular expression
+func hfPreTokenizer(pdPreTokenizer *hfComponent) (string, error) {
+	aSteps := pdPreTokenizer.steps()
+	if len(aSteps) != 1 || aSteps[0].Type != "ByteLevel" {
+		return "", errors.New("only a single ByteLevel pre-tokenizer is supported")
+	}
+	if aSteps[0].AddPrefixSpace {
+		return "", errors.New("add_prefix_space: ByteLevel adds a space only to text that does not start with one")
+	}
+	if aSteps[0].UseRegex != nil && !*aSteps[0].UseRegex {
+		return PreTokenizerNone, nil
+	}
+	return PreTokenizerGPT2, nil
+}
+
+// importByteLevel builds an artifact from a vocabulary and merges spelled in the byte-level
+// alphabet, keeping the ids of the vocabulary. Added tokens and tokens that neither a byte nor a
+// merge spells become special tokens, named by their text.
+func importByteLevel(mapVocab map[string]int64, aMerges hfMerges, mapAdded map[string]int64, dataNormalizer normalize.Config, sPreTokenizer string, sSource string) (*artifact, error) {
+	mapTexts := make(map[int64]string, len(mapVocab))
+	for sToken, lID := range mapVocab {
+		if sExisting, tfOK := mapTexts[lID]; tfOK {
+			return nil, fmt.Errorf("vocabulary: %q and %q share id %d", sExisting, sToken, lID)
+		}
+		mapTexts[lID] = sToken
+	}
+	pdArtifact := &artifact{
+		Merges:        make(map[string]int64, len(aMerges)),
+		Ordering:      make([][2]int64, 0, len(aMerges)),
+		SpecialTokens: make(map[string]int64),
+		Bytes:         make([]int64, 256),
+		Normalizer:    &dataNormalizer,
+		PreTokenizer:  sPreTokenizer,
+	}
+
+	// every byte is a base unit
+	mapReached := make(map[int64]bool, len(mapVocab))
+	for iByte, r := range arByteRunes {
+		lID, tfOK := mapVocab[string(r)]
+		if !tfOK {
+			return nil, fmt.Errorf("vocabulary: byte 0x%02X (%q) has no token", iByte, r)
+		}
+		pdArtifact.Bytes[iByte] = lID
+		mapReached[lID] = true
+	}
+
+	// merges in rank order, each one joining two tokens into a third
+	for iIndex, asPair := range aMerges {
+		var alPair [2]int64
+		for iSide, sToken := range asPair {
+			lID, tfOK := mapVocab[sToken]
+			if !tfOK {
+				return nil, fmt.Errorf("merges[%d]: %q is not in the vocabulary", iIndex, sToken)
+			}
+			alPair[iSide] = lID
+		}
+		lMerged, tfOK := mapVocab[asPair[0]+asPair[1]]
+		if !tfOK {
+			return nil, fmt.Errorf("merges[%d]: %q is not in the vocabulary", iIndex, asPair[0]+asPair[1])
+		}
+		if _, tfOK := pdArtifact.Merges[keyToString(alPair)]; tfOK {
+			return nil, fmt.Errorf("merges[%d]: %q %q is merged twice", iIndex, asPair[0], asPair[1])
+		}
+		pdArtifact.Merges[keyToString(alPair)] = lMerged
+		pdArtifact.Ordering = append(pdArtifact.Ordering, alPair)
+		mapReached[lMerged] = true
+	}
+	if len(pdArtifact.Ordering) == 0 {
+		return nil, errors.New("merges: the vocabulary has no merges")
+	}
+
+	// added tokens the merges already spell stay regular tokens
+	mapSpecial := make(map[int64]bool, len(mapAdded))
+	for sContent, lID := range mapAdded {
+		if !mapReached[lID] {
+			pdArtifact.SpecialTokens[sContent] = lID
+			mapSpecial[lID] = true
+		}
+	}
+	for lID, sToken := range mapTexts {
+		if mapReached[lID] || mapSpecial[lID] {
+			continue
+		}
+		sName, tfOK := fromByteLevel(sToken)
+		if !tfOK {
+			sName = sToken
+		}
+		if lExisting, tfOK := pdArtifact.SpecialTokens[sName]; tfOK {
+			return nil, fmt.Errorf("vocabulary: tokens %d and %d are both named %q", lExisting, lID, sName)
+		}
+		pdArtifact.SpecialTokens[sName] = lID
+	}
+
+	pdArtifact.Header = &ArtifactHeader{
+		Version:   iByteLevelVersion,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Source:    sSource,
+		VocabSize: len(mapReached) + len(pdArtifact.SpecialTokens),
+	}
+	return pdArtifact, nil
+}
+
+// WriteArtifact saves the artifact of a tokenizer, so that an imported vocabulary can be served
+// and inspected like a trained one; tokenizers loaded from binary artifacts are written back as JSON
+func (t *Tokenizer) WriteArtifact(sFilePath string) error {
+	abData, err := json.Marshal(t.jsonArtifact())
+	if err != nil {
+		return fmt.Errorf("failed to marshal artifact: %w", err)
+	}
+	if err := os.WriteFile(sFilePath, abData, 0644); err != nil {
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	return nil
+}
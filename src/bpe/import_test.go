@@ -0,0 +1,171 @@
+package bpe
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// directory of the vocabularies the import tests read
+const sFixtures = "../../tests/fixtures"
+
+// importFixtureGPT2 imports the GPT-2 vocab.json and merges.txt fixtures; merges.txt has a version
+// line, CRLF line endings and blank lines
+func importFixtureGPT2(t *testing.T) *Tokenizer {
+	t.Helper()
+	pdVocab, err := os.Open(filepath.Join(sFixtures, "gpt2-vocab.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdVocab.Close()
+	pdMerges, err := os.Open(filepath.Join(sFixtures, "gpt2-merges.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdMerges.Close()
+	pdTokenizer, err := ImportGPT2(pdVocab, pdMerges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pdTokenizer
+}
+
+// readFixtureHuggingFace decodes the tokenizer.json fixture, which spells its merges as
+// space-separated strings as files written before tokenizers 0.20 do
+func readFixtureHuggingFace(t *testing.T) map[string]interface{} {
+	t.Helper()
+	abData, err := os.ReadFile(filepath.Join(sFixtures, "hf-legacy-tokenizer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mapTokenizer map[string]interface{}
+	if err := json.Unmarshal(abData, &mapTokenizer); err != nil {
+		t.Fatal(err)
+	}
+	return mapTokenizer
+}
+
+// importHuggingFaceMap imports a tokenizer.json given as a decoded map
+func importHuggingFaceMap(t *testing.T, mapTokenizer map[string]interface{}) (*Tokenizer, error) {
+	t.Helper()
+	abData, err := json.Marshal(mapTokenizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ImportHuggingFace(bytes.NewReader(abData))
+}
+
+// TestImportGPT2 checks the merges, the pre-tokenizer, the special token and the header of an
+// imported GPT-2 vocabulary
+func TestImportGPT2(t *testing.T) {
+	pdTokenizer := importFixtureGPT2(t)
+	sInput := "the thing's ünïcode"
+	alTokens := pdTokenizer.Encode(sInput)
+	asExpected := []string{"t", "he", " t", "h", "ing", "'", "s", " ", "\xc3", "\xbc", "n", "\xc3", "\xaf", "c", "o", "d", "e"}
+	if asTexts := pdTokenizer.TokenTexts(alTokens); !slices.Equal(asTexts, asExpected) {
+		t.Errorf("%q encodes to %q, want %q", sInput, asTexts, asExpected)
+	}
+	if sDecoded, err := pdTokenizer.Decode(alTokens); err != nil || sDecoded != sInput {
+		t.Errorf("decoded to %q, %v", sDecoded, err)
+	}
+
+	dataMetadata := pdTokenizer.Metadata()
+	if dataMetadata.Merges != 5 || dataMetadata.VocabSize != 262 || !dataMetadata.ByteLevel {
+		t.Errorf("metadata is %+v", dataMetadata)
+	}
+	if dataMetadata.Version != iByteLevelVersion || dataMetadata.Source != ImportFormatGPT2 {
+		t.Errorf("header is version %d from %q", dataMetadata.Version, dataMetadata.Source)
+	}
+	if lID, tfOK := dataMetadata.SpecialTokens["<|endoftext|>"]; !tfOK || lID != 261 {
+		t.Errorf("special tokens are %v", dataMetadata.SpecialTokens)
+	}
+
+	// merges.txt lines that are not a pair are refused
+	_, err := ImportGPT2(strings.NewReader(`{"a": 0}`), strings.NewReader("#version: 0.2\na b c\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v, want an error on line 2", err)
+	}
+}
+
+// TestImportHuggingFace checks that the legacy tokenizer.json fixture imports to the same
+// tokenizer as the GPT-2 files, and survives being written as an artifact and read back
+func TestImportHuggingFace(t *testing.T) {
+	pdTokenizer, err := importHuggingFaceMap(t, readFixtureHuggingFace(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdGPT2 := importFixtureGPT2(t)
+	sInput := "the thing<|endoftext|> then\r\n\r\nwith them"
+	alExpected := pdGPT2.Encode(sInput)
+	if alTokens := pdTokenizer.Encode(sInput); !slices.Equal(alTokens, alExpected) {
+		t.Errorf("%q encodes to %v, GPT-2 files give %v", sInput, alTokens, alExpected)
+	}
+	if dataMetadata := pdTokenizer.Metadata(); dataMetadata.Source != ImportFormatHuggingFace || dataMetadata.SpecialTokens["<|endoftext|>"] != 261 {
+		t.Errorf("metadata is %+v", dataMetadata)
+	}
+
+	sArtifactPath := filepath.Join(t.TempDir(), "imported.json")
+	if err := pdTokenizer.WriteArtifact(sArtifactPath); err != nil {
+		t.Fatal(err)
+	}
+	pdLoaded, err := LoadTokenizer(sArtifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alTokens := pdLoaded.Encode(sInput); !slices.Equal(alTokens, alExpected) {
+		t.Errorf("written artifact encodes %q to %v, want %v", sInput, alTokens, alExpected)
+	}
+}
+
+// TestImportHuggingFaceUnsupported checks that every setting Polyglot cannot reproduce is reported
+// at once, each as its own error
+func TestImportHuggingFaceUnsupported(t *testing.T) {
+	mapTokenizer := readFixtureHuggingFace(t)
+	mapTokenizer["normalizer"] = map[string]interface{}{"type": "Sequence", "normalizers": []interface{}{
+		map[string]interface{}{"type": "NFKC"},
+		map[string]interface{}{"type": "StripAccents"},
+	}}
+	mapTokenizer["pre_tokenizer"] = map[string]interface{}{"type": "ByteLevel", "add_prefix_space": true}
+	mapModel := mapTokenizer["model"].(map[string]interface{})
+	mapModel["dropout"] = 0.1
+	mapModel["byte_fallback"] = true
+
+	_, err := importHuggingFaceMap(t, mapTokenizer)
+	if err == nil {
+		t.Fatal("an unsupported tokenizer.json was imported")
+	}
+	pdJoined, tfOK := err.(interface{ Unwrap() []error })
+	if !tfOK || len(pdJoined.Unwrap()) != 4 {
+		t.Fatalf("got %v, want four joined errors", err)
+	}
+	for _, sExpected := range []string{"dropout:", "byte_fallback:", "normalizer: StripAccents:", "pre_tokenizer: add_prefix_space:"} {
+		if !strings.Contains(err.Error(), sExpected) {
+			t.Errorf("%q is missing from %v", sExpected, err)
+		}
+	}
+
+	// a second Unicode form, or one after lowercasing, is refused as well
+	mapTokenizer = readFixtureHuggingFace(t)
+	mapTokenizer["normalizer"] = map[string]interface{}{"type": "Sequence", "normalizers": []interface{}{
+		map[string]interface{}{"type": "Lowercase"},
+		map[string]interface{}{"type": "NFC"},
+	}}
+	if _, err := importHuggingFaceMap(t, mapTokenizer); err == nil || !strings.Contains(err.Error(), "normalizer: NFC:") {
+		t.Errorf("got %v, want an error for NFC after Lowercase", err)
+	}
+}
+
+// TestArtifactVersions checks that trained artifacts keep the version older readers load and only
+// imported byte-level artifacts are stamped with the newer one
+func TestArtifactVersions(t *testing.T) {
+	if iVersion := (&Merges{}).stamp().Version; iVersion != 1 {
+		t.Errorf("trained artifacts are stamped with version %d, want 1", iVersion)
+	}
+	if iVersion := importFixtureGPT2(t).pdArtifact.Header.Version; iVersion != 2 {
+		t.Errorf("imported artifacts are stamped with version %d, want 2", iVersion)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package bpe
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads a file into memory on platforms without mmap
+func mapFile(pdFile *os.File) ([]byte, func(), error) {
+	if _, err := pdFile.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	abData, err := io.ReadAll(pdFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return abData, func() {}, nil
+}
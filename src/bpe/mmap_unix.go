@@ -0,0 +1,25 @@
+//go:build unix
+
+package bpe
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile maps a file into memory read-only; the returned function unmaps it
+func mapFile(pdFile *os.File) ([]byte, func(), error) {
+	dataInfo, err := pdFile.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if dataInfo.Size() == 0 || int64(int(dataInfo.Size())) != dataInfo.Size() {
+		return nil, nil, fmt.Errorf("cannot map a file of %d bytes", dataInfo.Size())
+	}
+	abData, err := syscall.Mmap(int(pdFile.Fd()), 0, int(dataInfo.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return abData, func() { syscall.Munmap(abData) }, nil
+}
@@ -0,0 +1,169 @@
+package bpe
+
+import (
+	"iter"
+	"normalize"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// contractions the GPT-2 pre-tokenizer keeps apart from the word before them, in pattern order
+var asContractions = []string{"s", "t", "re", "ve", "m", "ll", "d"}
+
+// character classes of the GPT-2 pre-tokenizer
+const (
+	iClassSpace = iota
+	iClassLetter
+	iClassNumber
+	iClassOther
+)
+
+// preTokenize splits normalized text into the chunks that merges are not allowed to cross
+func preTokenize(sMode string, sText string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		if sMode == PreTokenizerGPT2 {
+			for iStart := 0; iStart < len(sText); {
+				iLength := gpt2Piece(sText[iStart:])
+				if !yield(sText[iStart : iStart+iLength]) {
+					return
+				}
+				iStart += iLength
+			}
+			return
+		}
+		if sMode != PreTokenizerWhitespace {
+			yield(sText)
+			return
+		}
+
+		// a chunk is a run of whitespace followed by a run of non-whitespace, so "a  b" becomes "a", "  b"
+		iStart := 0
+		tfInWord := false
+		for iIndex, r := range sText {
+			tfSpace := isSpace(r)
+			if tfSpace && tfInWord {
+				if !yield(sText[iStart:iIndex]) {
+					return
+				}
+				iStart = iIndex
+			}
+			tfInWord = !tfSpace
+		}
+		if iStart < len(sText) {
+			yield(sText[iStart:])
+		}
+	}
+}
+
+// gpt2Piece returns the length of the piece at the start of a non-empty text under the GPT-2
+// pattern 's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+, spelled
+// out since Go's regular expressions have no lookahead
+func gpt2Piece(sText string) int {
+	if sText[0] == '\'' {
+		for _, sContraction := range asContractions {
+			if strings.HasPrefix(sText[1:], sContraction) {
+				return 1 + len(sContraction)
+			}
+		}
+	}
+
+	// a run of letters, numbers or other symbols, after an optional space
+	iStart := 0
+	if sText[0] == ' ' && len(sText) > 1 {
+		if r, _ := utf8.DecodeRuneInString(sText[1:]); gpt2Class(r) != iClassSpace {
+			iStart = 1
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(sText[iStart:])
+	if iClass := gpt2Class(r); iClass != iClassSpace {
+		iEnd := iStart
+		for iEnd < len(sText) {
+			r, iSize := utf8.DecodeRuneInString(sText[iEnd:])
+			if gpt2Class(r) != iClass {
+				break
+			}
+			iEnd += iSize
+		}
+		return iEnd
+	}
+
+	// whitespace, leaving its last character to a word that follows
+	iEnd, iLast := 0, 0
+	for iEnd < len(sText) {
+		r, iSize := utf8.DecodeRuneInString(sText[iEnd:])
+		if gpt2Class(r) != iClassSpace {
+			break
+		}
+		iLast = iEnd
+		iEnd += iSize
+	}
+	if iEnd < len(sText) && iLast > 0 {
+		return iLast
+	}
+	return iEnd
+}
+
+// gpt2Class returns the class of a character in the GPT-2 pattern
+func gpt2Class(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return iClassSpace
+	case unicode.IsLetter(r):
+		return iClassLetter
+	case unicode.IsNumber(r):
+		return iClassNumber
+	}
+	return iClassOther
+}
+
+// isSpace checks for whitespace, including the metaspace that stands in for spaces
+func isSpace(r rune) bool {
+	return unicode.IsSpace(r) || r == normalize.Metaspace
+}
+
+// toUnicodePoints converts a string to its code points
+func toUnicodePoints(sText string) []int64 {
+	alUnicodePoints := make([]int64, 0, utf8.RuneCountInString(sText))
+	for _, r := range sText {
+		alUnicodePoints = append(alUnicodePoints, int64(r))
+	}
+	return alUnicodePoints
+}
+
+// isAtomicUnit checks if a grapheme cluster must stay a single base unit instead of being split into
+// code points: every multi-rune cluster with grapheme base units, only emoji otherwise, unless
+// emoji are handled by code point as in the original pipeline
+func isAtomicUnit(sBaseUnits string, tfEmojiUnits bool, sCluster string) bool {
+	if utf8.RuneCountInString(sCluster) < 2 {
+		return false
+	}
+	return sBaseUnits == BaseUnitsGraphemes || (tfEmojiUnits && normalize.IsEmojiCluster(sCluster))
+}
+
+// toUnits converts a string to its base units: code points, except for multi-rune clusters that
+// fnUnitID gives an id. Clusters without an id fall back to their code points.
+func toUnits(sText string, fnUnitID func(sCluster string) (int64, bool)) []int64 {
+	// plain ASCII has no multi-rune cluster other than \r\n
+	tfASCII := true
+	for iIndex := 0; iIndex < len(sText) && tfASCII; iIndex++ {
+		tfASCII = sText[iIndex] < utf8.RuneSelf && sText[iIndex] != '\r'
+	}
+	if tfASCII {
+		return toUnicodePoints(sText)
+	}
+
+	alUnits := make([]int64, 0, len(sText))
+	for sCluster := range normalize.Graphemes(sText) {
+		if _, iSize := utf8.DecodeRuneInString(sCluster); iSize < len(sCluster) {
+			if lUnit, tfOK := fnUnitID(sCluster); tfOK {
+				alUnits = append(alUnits, lUnit)
+				continue
+			}
+		}
+		for _, r := range sCluster {
+			alUnits = append(alUnits, int64(r))
+		}
+	}
+	return alUnits
+}
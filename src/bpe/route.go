@@ -1,13 +1,19 @@
 package bpe
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
 )
 
-// Train executes the training process and returns an error if any step in the process fails.
-func Train() error {
+// Train executes the training process described by the configuration and returns an error if any step in the process fails.
+func Train(pdConfig *TrainingConfig) error {
 	// Get data from the source
-	pdDataset, err := getData()
+	pdDataset, err := getData(pdConfig)
 	if err != nil {
 		return fmt.Errorf("error getting data: %w", err)
 	}
@@ -16,7 +22,7 @@ func Train() error {
 	fmt.Println("Done getting data")
 
 	// Perform merges on the statistics
-	err = merge(pdDataset)
+	err = merge(pdDataset, pdConfig)
 	if err != nil {
 		return fmt.Errorf("error running the BPE algorithm: %w", err)
 	}
@@ -24,9 +30,10 @@ func Train() error {
 	return nil
 }
 
-func GetVocabularySize() error {
+// GetVocabularySize reports the vocabulary size of an artifact over the configured corpus
+func GetVocabularySize(pdConfig *TrainingConfig, sArtifactPath string) error {
 	// Get data from the source
-	pdDataset, err := getData()
+	pdDataset, err := getData(pdConfig)
 	if err != nil {
 		return fmt.Errorf("error getting data: %w", err)
 	}
@@ -35,7 +42,7 @@ func GetVocabularySize() error {
 	fmt.Println("Done getting data")
 
 	// Load the merges map
-	mapMerges, _, err := LoadMaps()
+	mapMerges, _, err := LoadMaps(sArtifactPath)
 	if err != nil {
 		return fmt.Errorf("Failed to load merges map: %s", err)
 	}
@@ -50,3 +57,154 @@ func GetVocabularySize() error {
 
 	return nil
 }
+
+// ExportHuggingFace writes an artifact as a Hugging Face tokenizer.json with the named template as
+// its post-processor. Given a sample corpus in the format of the training data, the characters of
+// the sample join the base alphabet and the tokens Encode produces for every sentence are recorded,
+// one JSON object per line next to the tokenizer.json, for tests/verify_hf.py to check the export against.
+func ExportHuggingFace(sArtifactPath string, sTemplate string, sOutputPath string, sSamplePath string) error {
+	// Load the tokenizer
+	pdTokenizer, err := LoadTokenizer(sArtifactPath)
+	if err != nil {
+		return fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+
+	// Encode the sample, language by language, and collect its normalized characters
+	var aRecords []expectedEncoding
+	mapAlphabet := make(map[rune]bool)
+	if sSamplePath != "" {
+		mapLanguageToSentence, err := fetchJSONFromFile(sSamplePath)
+		if err != nil {
+			return err
+		}
+		for _, sLanguage := range slices.Sorted(maps.Keys(mapLanguageToSentence)) {
+			adataSentences, tfOK := mapLanguageToSentence[sLanguage].([]interface{})
+			if !tfOK {
+				return fmt.Errorf("unable to parse JSON for %s into a string array", sLanguage)
+			}
+			for _, dataSentence := range adataSentences {
+				sSentence, tfOK := dataSentence.(string)
+				if !tfOK {
+					return fmt.Errorf("unable to parse JSON for %s into a string array", sLanguage)
+				}
+				for _, r := range pdTokenizer.pdNormalizer.Normalize(sSentence) {
+					mapAlphabet[r] = true
+				}
+				aRecords = append(aRecords, expectedEncoding{Language: sLanguage, Text: sSentence, Tokens: pdTokenizer.Encode(sSentence)})
+			}
+		}
+	} else if pdTokenizer.pdArtifact.Header == nil || pdTokenizer.pdArtifact.Header.Alphabet == "" {
+		fmt.Println("Warning: the artifact does not record its alphabet, so tokenizers will drop every character its merges do not use; pass -sample to add the characters of a corpus")
+	}
+
+	// Convert it
+	abData, err := pdTokenizer.HuggingFaceJSON(sTemplate, string(slices.Sorted(maps.Keys(mapAlphabet))))
+	if err != nil {
+		return fmt.Errorf("failed to export tokenizer: %w", err)
+	}
+	if err := os.WriteFile(sOutputPath, abData, 0644); err != nil {
+		return fmt.Errorf("failed to write tokenizer: %w", err)
+	}
+	fmt.Println("Wrote", sOutputPath)
+	if sSamplePath == "" {
+		return nil
+	}
+
+	// Record the expected tokens of the sample
+	var dBuilder strings.Builder
+	pdEncoder := json.NewEncoder(&dBuilder)
+	pdEncoder.SetEscapeHTML(false)
+	for _, dataRecord := range aRecords {
+		if err := pdEncoder.Encode(dataRecord); err != nil {
+			return fmt.Errorf("failed to encode expected tokens: %w", err)
+		}
+	}
+	sExpectedPath := strings.TrimSuffix(sOutputPath, ".json") + ".expected.jsonl"
+	if err := os.WriteFile(sExpectedPath, []byte(dBuilder.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write expected tokens: %w", err)
+	}
+	fmt.Println("Wrote", sExpectedPath)
+
+	return nil
+}
+
+// ImportVocabulary converts a third-party BPE vocabulary into an artifact that can be served like
+// a trained one: a GPT-2 vocab.json with its merges.txt, or a Hugging Face tokenizer.json when no
+// merges file is given
+func ImportVocabulary(sVocabPath string, sMergesPath string, sArtifactPath string) error {
+	if sArtifactPath == "" || sArtifactPath == sVocabPath || sArtifactPath == sMergesPath {
+		return errors.New("the artifact needs an output path of its own")
+	}
+
+	// Read the vocabulary in the format it comes in
+	pdVocab, err := os.Open(sVocabPath)
+	if err != nil {
+		return fmt.Errorf("failed to open vocabulary: %w", err)
+	}
+	defer pdVocab.Close()
+	var pdTokenizer *Tokenizer
+	if sMergesPath == "" {
+		pdTokenizer, err = ImportHuggingFace(pdVocab)
+	} else {
+		pdMerges, errOpen := os.Open(sMergesPath)
+		if errOpen != nil {
+			return fmt.Errorf("failed to open merges: %w", errOpen)
+		}
+		defer pdMerges.Close()
+		pdTokenizer, err = ImportGPT2(pdVocab, pdMerges)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import vocabulary: %w", err)
+	}
+
+	// Write it as an artifact
+	if err := pdTokenizer.WriteArtifact(sArtifactPath); err != nil {
+		return err
+	}
+	dataMetadata := pdTokenizer.Metadata()
+	fmt.Printf("Wrote %s: vocabulary of %d, %d merges, %d special tokens\n", sArtifactPath, dataMetadata.VocabSize, dataMetadata.Merges, len(dataMetadata.SpecialTokens))
+
+	return nil
+}
+
+// ConvertArtifact converts a JSON artifact into a binary one that servers memory-map at startup,
+// or a binary artifact back into JSON
+func ConvertArtifact(sArtifactPath string, sOutputPath string) error {
+	if sOutputPath == "" || sOutputPath == sArtifactPath {
+		return errors.New("the converted artifact needs an output path of its own")
+	}
+	abData, err := os.ReadFile(sArtifactPath)
+	if err != nil {
+		return fmt.Errorf("failed to read artifact: %w", err)
+	}
+	pdTokenizer, err := NewTokenizerFromBytes(abData)
+	if err != nil {
+		return err
+	}
+
+	// Write it in the other format
+	if isBinaryArtifact(abData) {
+		if err := pdTokenizer.WriteArtifact(sOutputPath); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s: JSON artifact\n", sOutputPath)
+		return nil
+	}
+	abBinary, err := pdTokenizer.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(sOutputPath, abBinary, 0644); err != nil {
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	fmt.Printf("Wrote %s: binary artifact of %d bytes, from %d bytes of JSON\n", sOutputPath, len(abBinary), len(abData))
+
+	return nil
+}
+
+// expectedEncoding is a sentence of a sample corpus with the tokens Encode produces for it
+type expectedEncoding struct {
+	Language string  `json:"language"`
+	Text     string  `json:"text"`
+	Tokens   []int64 `json:"tokens"`
+}
@@ -0,0 +1,253 @@
+package bpe
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Orders of alternative segmentations
+const (
+	SegmentByLength = "length"
+	SegmentByRank   = "rank"
+)
+
+// default cap on the partial segmentations one call may consider
+const iDefaultMaxWork = 1 << 20
+
+// ErrSegmentationBudget is returned when finding segmentations would take more work than allowed
+var ErrSegmentationBudget = errors.New("bpe: segmentation exceeds the work budget")
+
+// SegmentOptions controls the search for alternative segmentations. A segmentation is any sequence
+// of vocabulary tokens that spells the normalized input without crossing pre-tokenizer chunks.
+type SegmentOptions struct {
+	// SegmentByLength prefers fewer tokens, then earlier merges; SegmentByRank prefers the lowest
+	// sum of merge ranks, where base units rank after every merge
+	Order string `json:"order,omitempty"`
+
+	// most partial segmentations to consider, or iDefaultMaxWork if it is not positive
+	MaxWork int `json:"max_work,omitempty"`
+}
+
+// Validate checks the order
+func (o SegmentOptions) Validate() error {
+	if o.Order != "" && o.Order != SegmentByLength && o.Order != SegmentByRank {
+		return fmt.Errorf("order: unknown order %q (expected %q or %q)", o.Order, SegmentByLength, SegmentByRank)
+	}
+	return nil
+}
+
+// segmentEdge is a token that spans the units from one position of the lattice to another
+type segmentEdge struct {
+	iStart int
+	iEnd   int
+	lToken int64
+}
+
+// segmentPath is a partial segmentation, sharing its prefix with the paths it was extended from
+type segmentPath struct {
+	pdPrevious *segmentPath
+	lToken     int64
+	iTokens    int
+	lRanks     int64
+}
+
+// EncodeNBest returns up to iN distinct segmentations of a string, best first in the chosen order.
+// The canonical BPE encoding is one of them only if the order happens to rank it among the best.
+func (t *Tokenizer) EncodeNBest(sInput string, iN int, dataOptions SegmentOptions) ([][]int64, error) {
+	if err := dataOptions.Validate(); err != nil {
+		return nil, err
+	}
+	if iN < 1 {
+		return nil, fmt.Errorf("n: must be positive, got %d", iN)
+	}
+	iPositions, aEdges := t.lattice(sInput)
+	iBudget := maxWork(dataOptions)
+
+	// the best paths ending at every position, extended by the edges that end at the next ones
+	aaIncoming := make([][]segmentEdge, iPositions)
+	for _, dataEdge := range aEdges {
+		aaIncoming[dataEdge.iEnd] = append(aaIncoming[dataEdge.iEnd], dataEdge)
+	}
+	aapdBest := make([][]*segmentPath, iPositions)
+	aapdBest[0] = []*segmentPath{nil}
+	fnCompare := t.pathOrder(dataOptions.Order)
+	for iEnd := 1; iEnd < iPositions; iEnd++ {
+		var apdCandidates []*segmentPath
+		for _, dataEdge := range aaIncoming[iEnd] {
+			for _, pdPath := range aapdBest[dataEdge.iStart] {
+				apdCandidates = append(apdCandidates, t.extendPath(pdPath, dataEdge.lToken))
+			}
+		}
+		if iBudget -= len(apdCandidates); iBudget < 0 {
+			return nil, ErrSegmentationBudget
+		}
+		slices.SortStableFunc(apdCandidates, fnCompare)
+		aapdBest[iEnd] = apdCandidates[:min(iN, len(apdCandidates))]
+	}
+
+	aalSegmentations := make([][]int64, 0, iN)
+	for _, pdPath := range aapdBest[iPositions-1] {
+		aalSegmentations = append(aalSegmentations, pdPath.tokens())
+	}
+	return aalSegmentations, nil
+}
+
+// EncodeSampled draws iK segmentations of a string uniformly at random from all of its
+// segmentations, so the same one can be drawn more than once. A nil pdRand uses the global source.
+func (t *Tokenizer) EncodeSampled(sInput string, iK int, pdRand *rand.Rand, dataOptions SegmentOptions) ([][]int64, error) {
+	if err := dataOptions.Validate(); err != nil {
+		return nil, err
+	}
+	if iK < 1 {
+		return nil, fmt.Errorf("k: must be positive, got %d", iK)
+	}
+	iPositions, aEdges := t.lattice(sInput)
+	if len(aEdges)+iK*(iPositions-1) > maxWork(dataOptions) {
+		return nil, ErrSegmentationBudget
+	}
+	fnFloat := rand.Float64
+	if pdRand != nil {
+		fnFloat = pdRand.Float64
+	}
+
+	// log of the number of segmentations from every position to the end
+	aaOutgoing := make([][]segmentEdge, iPositions)
+	for _, dataEdge := range aEdges {
+		aaOutgoing[dataEdge.iStart] = append(aaOutgoing[dataEdge.iStart], dataEdge)
+	}
+	afLogCounts := make([]float64, iPositions)
+	for iStart := iPositions - 2; iStart >= 0; iStart-- {
+		afLogCounts[iStart] = math.Inf(-1)
+		for _, dataEdge := range aaOutgoing[iStart] {
+			afLogCounts[iStart] = logAdd(afLogCounts[iStart], afLogCounts[dataEdge.iEnd])
+		}
+	}
+
+	// walk forward, taking every edge with the share of segmentations that go through it
+	aalSegmentations := make([][]int64, iK)
+	for iSample := range aalSegmentations {
+		alTokens := []int64{}
+		for iStart := 0; iStart < iPositions-1; {
+			fTarget := fnFloat()
+			dataChosen := aaOutgoing[iStart][len(aaOutgoing[iStart])-1]
+			for _, dataEdge := range aaOutgoing[iStart] {
+				if fTarget -= math.Exp(afLogCounts[dataEdge.iEnd] - afLogCounts[iStart]); fTarget < 0 {
+					dataChosen = dataEdge
+					break
+				}
+			}
+			alTokens = append(alTokens, dataChosen.lToken)
+			iStart = dataChosen.iEnd
+		}
+		aalSegmentations[iSample] = alTokens
+	}
+	return aalSegmentations, nil
+}
+
+// lattice normalizes a string and lists every token that spans a run of its base units within a
+// chunk. Positions are the boundaries between units, so the last one is the end of the input.
+func (t *Tokenizer) lattice(sInput string) (int, []segmentEdge) {
+	var aEdges []segmentEdge
+	iPosition := 0
+	for sChunk := range preTokenize(t.pdEncoder.sPreTokenizer, t.pdNormalizer.Normalize(sInput)) {
+		// byte offset of every unit boundary in the chunk
+		alUnits := t.pdEncoder.units(sChunk)
+		aiOffsets := make([]int, len(alUnits)+1)
+		for iIndex, lUnit := range alUnits {
+			aiOffsets[iIndex+1] = aiOffsets[iIndex] + len(t.TokenText(lUnit))
+		}
+
+		// every unit is a token, and so is every run of units that spells a minted token
+		for iStart, lUnit := range alUnits {
+			aEdges = append(aEdges, segmentEdge{iStart: iPosition + iStart, iEnd: iPosition + iStart + 1, lToken: lUnit})
+			for iEnd := iStart + 2; iEnd <= len(alUnits) && aiOffsets[iEnd]-aiOffsets[iStart] <= t.pdTable.iMaxPiece; iEnd++ {
+				if lToken, tfOK := t.piece(sChunk[aiOffsets[iStart]:aiOffsets[iEnd]]); tfOK {
+					aEdges = append(aEdges, segmentEdge{iStart: iPosition + iStart, iEnd: iPosition + iEnd, lToken: lToken})
+				}
+			}
+		}
+		iPosition += len(alUnits)
+	}
+	return iPosition + 1, aEdges
+}
+
+// piece returns the first token that spells a run of units; special tokens stand only for their
+// name and are never part of a segmentation
+func (t *Tokenizer) piece(sText string) (int64, bool) {
+	lID, tfOK := t.pdTable.id(sText)
+	if !tfOK {
+		return 0, false
+	}
+	if lSpecial, tfSpecial := t.pdArtifact.SpecialTokens[sText]; tfSpecial && lSpecial == lID {
+		return 0, false
+	}
+	return lID, true
+}
+
+// extendPath adds a token to a partial segmentation
+func (t *Tokenizer) extendPath(pdPath *segmentPath, lToken int64) *segmentPath {
+	pdExtended := &segmentPath{pdPrevious: pdPath, lToken: lToken, iTokens: 1, lRanks: t.mergeRank(lToken)}
+	if pdPath != nil {
+		pdExtended.iTokens += pdPath.iTokens
+		pdExtended.lRanks += pdPath.lRanks
+	}
+	return pdExtended
+}
+
+// mergeRank is the position of a minted token in the merge order, counting from 1; base units and
+// special tokens rank after every merge
+func (t *Tokenizer) mergeRank(lToken int64) int64 {
+	if lRank, tfOK := t.pdTable.mergeRank(lToken); tfOK {
+		return lRank
+	}
+	return int64(t.pdTable.merges()) + 1
+}
+
+// pathOrder returns the comparison of partial segmentations for an order
+func (t *Tokenizer) pathOrder(sOrder string) func(*segmentPath, *segmentPath) int {
+	if sOrder == SegmentByRank {
+		return func(pdA *segmentPath, pdB *segmentPath) int {
+			if pdA.lRanks != pdB.lRanks {
+				return cmp.Compare(pdA.lRanks, pdB.lRanks)
+			}
+			return pdA.iTokens - pdB.iTokens
+		}
+	}
+	return func(pdA *segmentPath, pdB *segmentPath) int {
+		if pdA.iTokens != pdB.iTokens {
+			return pdA.iTokens - pdB.iTokens
+		}
+		return cmp.Compare(pdA.lRanks, pdB.lRanks)
+	}
+}
+
+// tokens spells out a segmentation from its last path node
+func (p *segmentPath) tokens() []int64 {
+	alTokens := []int64{}
+	for pdPath := p; pdPath != nil; pdPath = pdPath.pdPrevious {
+		alTokens = append(alTokens, pdPath.lToken)
+	}
+	slices.Reverse(alTokens)
+	return alTokens
+}
+
+// maxWork returns the work budget of the options
+func maxWork(dataOptions SegmentOptions) int {
+	if dataOptions.MaxWork > 0 {
+		return dataOptions.MaxWork
+	}
+	return iDefaultMaxWork
+}
+
+// logAdd returns log(exp(fA) + exp(fB)) without overflowing
+func logAdd(fA float64, fB float64) float64 {
+	if math.IsInf(fA, -1) {
+		return fB
+	}
+	fHigh, fLow := max(fA, fB), min(fA, fB)
+	return fHigh + math.Log1p(math.Exp(fLow-fHigh))
+}
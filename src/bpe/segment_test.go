@@ -0,0 +1,130 @@
+package bpe
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// merges whose tokens segment "abcd" in seven ways; base units rank 6
+var aSegmentMerges = []testMerge{{"a", "b"}, {"c", "d"}, {"b", "c"}, {"a", "bc"}, {"abc", "d"}}
+
+// segmentTexts spells segmentations as their tokens separated by spaces
+func segmentTexts(pdTokenizer *Tokenizer, aalSegmentations [][]int64) []string {
+	asTexts := make([]string, len(aalSegmentations))
+	for iIndex, alTokens := range aalSegmentations {
+		asTexts[iIndex] = strings.Join(pdTokenizer.TokenTexts(alTokens), " ")
+	}
+	return asTexts
+}
+
+// TestEncodeNBest checks the segmentations EncodeNBest lists in both orders, and that they never
+// cross pre-tokenizer chunks
+func TestEncodeNBest(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, nil, aSegmentMerges, PreTokenizerNone))
+	for _, dataCase := range []struct {
+		sName   string
+		sInput  string
+		iN      int
+		sOrder  string
+		asTexts []string
+	}{
+		{"by length", "abcd", 10, "", []string{"abcd", "ab cd", "abc d", "ab c d", "a b cd", "a bc d", "a b c d"}},
+		{"by rank", "abcd", 10, SegmentByRank, []string{"ab cd", "abcd", "abc d", "ab c d", "a b cd", "a bc d", "a b c d"}},
+		{"best only", "abcd", 1, SegmentByLength, []string{"abcd"}},
+		{"best three by rank", "abcd", 3, SegmentByRank, []string{"ab cd", "abcd", "abc d"}},
+		{"single segmentation", "xa", 4, "", []string{"x a"}},
+		{"empty input", "", 2, "", []string{""}},
+	} {
+		aalSegmentations, err := pdTokenizer.EncodeNBest(dataCase.sInput, dataCase.iN, SegmentOptions{Order: dataCase.sOrder})
+		if asTexts := segmentTexts(pdTokenizer, aalSegmentations); err != nil || !slices.Equal(asTexts, dataCase.asTexts) {
+			t.Errorf("%s: got %q, %v, want %q", dataCase.sName, asTexts, err, dataCase.asTexts)
+		}
+	}
+
+	// the space starts the second chunk, so the merge of "b " is never used
+	pdWhitespace := mustTokenizer(t, newTestArtifact(t, nil, []testMerge{{"b", " "}, {" ", "c"}}, PreTokenizerWhitespace))
+	aalSegmentations, err := pdWhitespace.EncodeNBest("b c", 10, SegmentOptions{})
+	if asTexts := segmentTexts(pdWhitespace, aalSegmentations); err != nil || !slices.Equal(asTexts, []string{"b  c", "b   c"}) {
+		t.Errorf("segmentations across chunks: got %q, %v", asTexts, err)
+	}
+}
+
+// TestEncodeSampled checks that sampling draws every segmentation about equally often, repeats
+// itself for the same seed, and only ever draws segmentations of the input
+func TestEncodeSampled(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, nil, aSegmentMerges, PreTokenizerNone))
+	aalAll, err := pdTokenizer.EncodeNBest("abcd", 10, SegmentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asAll := segmentTexts(pdTokenizer, aalAll)
+
+	const iSamples = 7000
+	aalSamples, err := pdTokenizer.EncodeSampled("abcd", iSamples, rand.New(rand.NewPCG(1, 2)), SegmentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapCounts := make(map[string]int)
+	for _, sText := range segmentTexts(pdTokenizer, aalSamples) {
+		if !slices.Contains(asAll, sText) {
+			t.Fatalf("sampled %q, which is not a segmentation", sText)
+		}
+		mapCounts[sText]++
+	}
+	for _, sText := range asAll {
+		if iCount := mapCounts[sText]; iCount < iSamples/len(asAll)*8/10 || iCount > iSamples/len(asAll)*12/10 {
+			t.Errorf("%q drawn %d times out of %d", sText, iCount, iSamples)
+		}
+	}
+
+	aalFirst, _ := pdTokenizer.EncodeSampled("abcd abcd", 20, rand.New(rand.NewPCG(7, 7)), SegmentOptions{})
+	aalSecond, _ := pdTokenizer.EncodeSampled("abcd abcd", 20, rand.New(rand.NewPCG(7, 7)), SegmentOptions{})
+	if !slices.EqualFunc(aalFirst, aalSecond, slices.Equal[[]int64]) {
+		t.Error("the same seed draws different segmentations")
+	}
+	for _, alTokens := range aalFirst {
+		if sText := strings.Join(pdTokenizer.TokenTexts(alTokens), ""); sText != "abcd abcd" {
+			t.Errorf("sample spells %q", sText)
+		}
+	}
+}
+
+// TestSegmentErrors checks the options and counts both searches refuse, and the work budget
+func TestSegmentErrors(t *testing.T) {
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, nil, aSegmentMerges, PreTokenizerNone))
+	pdRand := rand.New(rand.NewPCG(1, 2))
+	for _, dataCase := range []struct {
+		sName       string
+		fnCall      func() ([][]int64, error)
+		sError      string
+		errExpected error
+	}{
+		{"nbest order", func() ([][]int64, error) {
+			return pdTokenizer.EncodeNBest("abcd", 2, SegmentOptions{Order: "score"})
+		}, `order: unknown order "score"`, nil},
+		{"sampled order", func() ([][]int64, error) {
+			return pdTokenizer.EncodeSampled("abcd", 2, pdRand, SegmentOptions{Order: "score"})
+		}, `order: unknown order "score"`, nil},
+		{"zero n", func() ([][]int64, error) { return pdTokenizer.EncodeNBest("abcd", 0, SegmentOptions{}) }, "n: must be positive, got 0", nil},
+		{"negative k", func() ([][]int64, error) { return pdTokenizer.EncodeSampled("abcd", -1, pdRand, SegmentOptions{}) }, "k: must be positive, got -1", nil},
+		{"nbest budget", func() ([][]int64, error) {
+			return pdTokenizer.EncodeNBest(strings.Repeat("abcd", 10), 8, SegmentOptions{MaxWork: 100})
+		}, "", ErrSegmentationBudget},
+		{"sampled budget", func() ([][]int64, error) {
+			return pdTokenizer.EncodeSampled(strings.Repeat("abcd", 10), 8, pdRand, SegmentOptions{MaxWork: 100})
+		}, "", ErrSegmentationBudget},
+	} {
+		aalSegmentations, err := dataCase.fnCall()
+		if err == nil || aalSegmentations != nil || (dataCase.errExpected != nil && !errors.Is(err, dataCase.errExpected)) || !strings.Contains(err.Error(), dataCase.sError) {
+			t.Errorf("%s: got %d segmentations, %v", dataCase.sName, len(aalSegmentations), err)
+		}
+	}
+
+	// the same input fits the default budget
+	if _, err := pdTokenizer.EncodeNBest(strings.Repeat("abcd", 10), 8, SegmentOptions{}); err != nil {
+		t.Errorf("default budget: %v", err)
+	}
+}
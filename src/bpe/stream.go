@@ -0,0 +1,244 @@
+package bpe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"normalize"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// size of every read from the normalized stream
+const iStreamReadSize = 64 << 10
+
+// StreamEncoder encodes a reader piece by piece with bounded memory. The input is normalized as a
+// stream and the normalized text is cut only where the encoding of both halves equals the encoding
+// of the whole: at chunk boundaries of the whitespace pre-tokenizer, before the last two pieces of
+// the GPT-2 pre-tokenizer, or without a pre-tokenizer between two base units that no token holds
+// next to each other. Text without a pre-tokenizer where some token spans every such pair, like a
+// long run of spaces, cannot be cut; it fails with normalize.ErrNoSplitPoint once it outgrows the
+// buffer, and only the whitespace pre-tokenizer cuts at every word.
+type StreamEncoder struct {
+	pdEncoder  *Encoder
+	pdReader   io.Reader
+	iMaxBuffer int
+	mapPairs   map[[2]int64]bool
+	abBuffer   []byte
+	abRead     []byte
+	tfEOF      bool
+}
+
+// NewStreamEncoder starts encoding pdReader, holding at most iMaxBuffer bytes of input, or
+// normalize.DefaultMaxBuffer if it is not positive, while looking for a place to cut
+func (t *Tokenizer) NewStreamEncoder(pdReader io.Reader, iMaxBuffer int) (*StreamEncoder, error) {
+	if iMaxBuffer <= 0 {
+		iMaxBuffer = normalize.DefaultMaxBuffer
+	}
+	pdTransformer, err := normalize.NewTransformer(t.pdNormalizer, iMaxBuffer)
+	if err != nil {
+		return nil, err
+	}
+	pdStream := &StreamEncoder{
+		pdEncoder:  t.pdEncoder,
+		pdReader:   transform.NewReader(pdReader, pdTransformer),
+		iMaxBuffer: iMaxBuffer,
+		abRead:     make([]byte, iStreamReadSize),
+	}
+
+	// without a pre-tokenizer the only safe cuts are between units no merge joins
+	if t.pdEncoder.sPreTokenizer == PreTokenizerNone {
+		pdStream.mapPairs = unitPairs(t.pdTable)
+	}
+	return pdStream, nil
+}
+
+// EncodeReader encodes everything read from pdReader, passing the tokens to fnEmit a piece at a
+// time in order; an error from fnEmit stops the encoding and is returned
+func (t *Tokenizer) EncodeReader(pdReader io.Reader, fnEmit func(alTokens []int64) error) error {
+	pdStream, err := t.NewStreamEncoder(pdReader, 0)
+	if err != nil {
+		return err
+	}
+	for {
+		alTokens, err := pdStream.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fnEmit(alTokens); err != nil {
+			return err
+		}
+	}
+}
+
+// Next returns the tokens of the next piece of input, or io.EOF once the input is fully encoded.
+// Concatenating every piece gives the same tokens as encoding the whole input at once.
+func (s *StreamEncoder) Next() ([]int64, error) {
+	for {
+		// encode up to the last cut, or everything once the input has ended
+		iCut := len(s.abBuffer)
+		if !s.tfEOF {
+			iCut = s.lastCut()
+		}
+		if iCut > 0 {
+			alTokens := s.encodePrefix(iCut)
+			s.abBuffer = s.abBuffer[:copy(s.abBuffer, s.abBuffer[iCut:])]
+			return alTokens, nil
+		}
+		if s.tfEOF {
+			return nil, io.EOF
+		}
+		if len(s.abBuffer) > s.iMaxBuffer {
+			if s.mapPairs != nil {
+				return nil, fmt.Errorf("%w: without a pre-tokenizer text is only cut between two base units that no token holds next to each other; use the whitespace pre-tokenizer to cut at every word", normalize.ErrNoSplitPoint)
+			}
+			return nil, normalize.ErrNoSplitPoint
+		}
+
+		// read more normalized text
+		iRead, err := s.pdReader.Read(s.abRead)
+		s.abBuffer = append(s.abBuffer, s.abRead[:iRead]...)
+		if errors.Is(err, io.EOF) {
+			s.tfEOF = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// lastCut returns the last position of the buffer where the text can be cut, or 0 if there is none
+func (s *StreamEncoder) lastCut() int {
+	if s.pdEncoder.sPreTokenizer == PreTokenizerGPT2 {
+		return s.lastPieceCut()
+	}
+	if s.mapPairs != nil {
+		return s.lastUnitCut()
+	}
+	for iIndex := len(s.abBuffer); iIndex > 0; {
+		// a whitespace chunk starts where whitespace follows anything else
+		rPrevious, iSize := utf8.DecodeLastRune(s.abBuffer[:iIndex])
+		if iIndex < len(s.abBuffer) && isSpace(s.runeAt(iIndex)) && !isSpace(rPrevious) {
+			return iIndex
+		}
+		iIndex -= iSize
+	}
+	return 0
+}
+
+// lastUnitCut returns the last position of the buffer between two base units that no token holds
+// next to each other, or 0 if there is none. No merge joins the symbols on both sides of such a
+// position, so each side merges as it would on its own. Grapheme cluster boundaries look one rune
+// ahead, so only a cut followed by two clusters is sure to lie between the same units once more
+// text arrives.
+func (s *StreamEncoder) lastUnitCut() int {
+	if alBytes := s.pdEncoder.alBytes; alBytes != nil {
+		for iIndex := len(s.abBuffer) - 1; iIndex > 0; iIndex-- {
+			if !s.mapPairs[[2]int64{alBytes[s.abBuffer[iIndex-1]], alBytes[s.abBuffer[iIndex]]}] {
+				return iIndex
+			}
+		}
+		return 0
+	}
+
+	iCut, iStart := 0, 0
+	lPrevious, sPending := int64(-1), ""
+	for sCluster := range normalize.Graphemes(string(s.abBuffer)) {
+		if sPending != "" {
+			lFirst, lLast := s.clusterUnits(sPending)
+			if lPrevious >= 0 && !s.mapPairs[[2]int64{lPrevious, lFirst}] {
+				iCut = iStart
+			}
+			lPrevious = lLast
+			iStart += len(sPending)
+		}
+		sPending = sCluster
+	}
+	return iCut
+}
+
+// clusterUnits returns the first and last base unit of a grapheme cluster, split as toUnits does
+func (s *StreamEncoder) clusterUnits(sCluster string) (int64, int64) {
+	rFirst, iSize := utf8.DecodeRuneInString(sCluster)
+	if iSize < len(sCluster) {
+		if lUnit, tfOK := s.pdEncoder.unitID(sCluster); tfOK {
+			return lUnit, lUnit
+		}
+	}
+	rLast, _ := utf8.DecodeLastRuneInString(sCluster)
+	return int64(rFirst), int64(rLast)
+}
+
+// unitPairs collects every pair of base units that some token holds next to each other: each
+// merge joins the last unit of its left token to the first unit of its right one
+func unitPairs(pdTable *tokenTable) map[[2]int64]bool {
+	aalOrdering := pdTable.ordering()
+	mapParts := make(map[int64][2]int64, len(aalOrdering))
+	for _, alPair := range aalOrdering {
+		dataRule, _ := pdTable.rule(alPair[0], alPair[1])
+		mapParts[dataRule.lToken] = alPair
+	}
+
+	// the first and last unit of a token, following its merges down to base units
+	mapEnds := make(map[int64][2]int64, len(mapParts))
+	var fnEnds func(lToken int64) [2]int64
+	fnEnds = func(lToken int64) [2]int64 {
+		if alEnds, tfOK := mapEnds[lToken]; tfOK {
+			return alEnds
+		}
+		// a token counts as a base unit while its parts are followed, so merges that mint their own
+		// parts cannot recurse forever
+		alEnds := [2]int64{lToken, lToken}
+		mapEnds[lToken] = alEnds
+		if alPair, tfOK := mapParts[lToken]; tfOK {
+			alEnds = [2]int64{fnEnds(alPair[0])[0], fnEnds(alPair[1])[1]}
+		}
+		mapEnds[lToken] = alEnds
+		return alEnds
+	}
+
+	mapPairs := make(map[[2]int64]bool, len(aalOrdering))
+	for _, alPair := range aalOrdering {
+		mapPairs[[2]int64{fnEnds(alPair[0])[1], fnEnds(alPair[1])[0]}] = true
+	}
+	return mapPairs
+}
+
+// lastPieceCut returns the start of the second to last GPT-2 piece of the buffer, or 0 if there are
+// fewer than three. Every earlier piece is final: it ends where its class of characters does, and
+// deciding whether an apostrophe starts a contraction looks at most two characters further.
+func (s *StreamEncoder) lastPieceCut() int {
+	iPrevious, iLast, iStart := 0, 0, 0
+	for sPiece := range preTokenize(PreTokenizerGPT2, string(s.abBuffer)) {
+		iPrevious, iLast = iLast, iStart
+		iStart += len(sPiece)
+	}
+	return iPrevious
+}
+
+// encodePrefix encodes the buffer up to a cut. GPT-2 pieces are taken from the whole buffer: on its
+// own, the prefix could end in whitespace that the pattern splits differently when text follows.
+func (s *StreamEncoder) encodePrefix(iCut int) []int64 {
+	if s.pdEncoder.sPreTokenizer != PreTokenizerGPT2 {
+		return s.pdEncoder.encode(string(s.abBuffer[:iCut]))
+	}
+	alTokens := make([]int64, 0, iCut)
+	iStart := 0
+	for sPiece := range preTokenize(PreTokenizerGPT2, string(s.abBuffer)) {
+		if iStart >= iCut {
+			break
+		}
+		alTokens = append(alTokens, s.pdEncoder.encodeChunk(sPiece)...)
+		iStart += len(sPiece)
+	}
+	return alTokens
+}
+
+// runeAt decodes the rune starting at a position of the buffer
+func (s *StreamEncoder) runeAt(iIndex int) rune {
+	r, _ := utf8.DecodeRune(s.abBuffer[iIndex:])
+	return r
+}
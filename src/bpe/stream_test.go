@@ -0,0 +1,170 @@
+package bpe
+
+import (
+	"errors"
+	"io"
+	"normalize"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// merges that join letters, spaces and words, so cuts in the wrong place change the tokens
+var aStreamMerges = []testMerge{
+	{"t", "h"}, {"th", "e"}, {" ", "the"}, {"\r\n", "the"}, {"e", "r"}, {" ", " "}, {"  ", " "},
+	{"'", "s"}, {"\t", "a"}, {"a", "b"}, {"ab", "c"}, {"👍🏽", "!"}, {"\r\n", "\r\n"}, {".", "\r\n"},
+}
+
+// text with cuts of every kind: lines, CRLF, tabs, runs of spaces, contractions and emoji
+const sStreamText = "the other's abc\r\nthe  abc   there\n\tabc.\r\n\r\n👍🏽! it's\x0bthe\n abc 👍🏽👍🏽 ther\ne"
+
+// chunkReader returns its chunks one Read at a time
+type chunkReader struct {
+	asChunks []string
+}
+
+// Read implements io.Reader
+func (r *chunkReader) Read(ab []byte) (int, error) {
+	for len(r.asChunks) > 0 && r.asChunks[0] == "" {
+		r.asChunks = r.asChunks[1:]
+	}
+	if len(r.asChunks) == 0 {
+		return 0, io.EOF
+	}
+	iCopied := copy(ab, r.asChunks[0])
+	r.asChunks[0] = r.asChunks[0][iCopied:]
+	return iCopied, nil
+}
+
+// streamTokens reads a stream encoder to the end and joins its pieces
+func streamTokens(pdTokenizer *Tokenizer, pdReader io.Reader, iMaxBuffer int) ([]int64, error) {
+	pdStream, err := pdTokenizer.NewStreamEncoder(pdReader, iMaxBuffer)
+	if err != nil {
+		return nil, err
+	}
+	alResult := []int64{}
+	for {
+		alTokens, err := pdStream.Next()
+		if errors.Is(err, io.EOF) {
+			return alResult, nil
+		}
+		if err != nil {
+			return alResult, err
+		}
+		alResult = append(alResult, alTokens...)
+	}
+}
+
+// base units of the merges above
+var asStreamUnits = []string{"\r\n", "👍🏽"}
+
+// streamTokenizers returns a tokenizer for every pre-tokenizer, plus the trained artifact
+func streamTokenizers(t *testing.T) map[string]*Tokenizer {
+	mapTokenizers := make(map[string]*Tokenizer)
+	for _, sPreTokenizer := range []string{PreTokenizerNone, PreTokenizerWhitespace, PreTokenizerGPT2} {
+		mapTokenizers[sPreTokenizer] = mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, sPreTokenizer))
+	}
+	if pdTokenizer, err := LoadTokenizer("../../artifacts/merges.json"); err == nil {
+		mapTokenizers["artifact"] = pdTokenizer
+	}
+	return mapTokenizers
+}
+
+// TestStreamEncoderSplits reads the text in two parts cut at every byte, and one byte at a time,
+// with several buffer sizes; the tokens must always be those of Encode on the whole text
+func TestStreamEncoderSplits(t *testing.T) {
+	for sName, pdTokenizer := range streamTokenizers(t) {
+		alExpected := pdTokenizer.Encode(sStreamText)
+		for _, iMaxBuffer := range []int{48, 64, 0} {
+			for iSplit := 0; iSplit <= len(sStreamText); iSplit++ {
+				pdReader := &chunkReader{asChunks: []string{sStreamText[:iSplit], sStreamText[iSplit:]}}
+				alActual, err := streamTokens(pdTokenizer, pdReader, iMaxBuffer)
+				if err != nil {
+					t.Fatalf("%s, buffer %d, split at %d: %v", sName, iMaxBuffer, iSplit, err)
+				}
+				if !slices.Equal(alActual, alExpected) {
+					t.Errorf("%s, buffer %d, split at %d: got %v, want %v", sName, iMaxBuffer, iSplit, alActual, alExpected)
+				}
+			}
+			alActual, err := streamTokens(pdTokenizer, iotest.OneByteReader(strings.NewReader(sStreamText)), iMaxBuffer)
+			if err != nil || !slices.Equal(alActual, alExpected) {
+				t.Errorf("%s, buffer %d, one byte at a time: got %v, %v, want %v", sName, iMaxBuffer, alActual, err, alExpected)
+			}
+		}
+	}
+}
+
+// TestStreamEncoderLong checks a text much longer than the buffer, which has to be encoded in many pieces
+func TestStreamEncoderLong(t *testing.T) {
+	sText := strings.Repeat(sStreamText+"\n", 200)
+	for sName, pdTokenizer := range streamTokenizers(t) {
+		var alActual []int64
+		err := pdTokenizer.EncodeReader(iotest.HalfReader(strings.NewReader(sText)), func(alTokens []int64) error {
+			alActual = append(alActual, alTokens...)
+			return nil
+		})
+		if err != nil || !slices.Equal(alActual, pdTokenizer.Encode(sText)) {
+			t.Errorf("%s: streamed tokens differ from Encode (%v)", sName, err)
+		}
+	}
+}
+
+// TestStreamEncoderNoSplitPoint checks that text the encoder cannot cut fails once it outgrows the
+// buffer: without a pre-tokenizer only places between units that no token holds next to each other
+// are cut points, and merges of every pair the text has leave none
+func TestStreamEncoderNoSplitPoint(t *testing.T) {
+	sWords := strings.Repeat("the abc ", 32)
+	pdTokenizer := mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, PreTokenizerNone))
+	if _, err := streamTokens(pdTokenizer, iotest.OneByteReader(strings.NewReader(sWords)), 64); err != nil {
+		t.Errorf("words: %v", err)
+	}
+
+	// merges across both ends of a word leave nothing to cut
+	aMerges := append(slices.Clone(aStreamMerges), testMerge{"e", " "}, testMerge{"c", " "}, testMerge{"b", " "}, testMerge{" ", "a"})
+	pdTokenizer = mustTokenizer(t, newTestArtifact(t, asStreamUnits, aMerges, PreTokenizerNone))
+	for _, sText := range []string{sWords, strings.Repeat("ab ", 64)} {
+		_, err := streamTokens(pdTokenizer, iotest.OneByteReader(strings.NewReader(sText)), 64)
+		if !errors.Is(err, normalize.ErrNoSplitPoint) || !strings.Contains(err.Error(), "whitespace pre-tokenizer") {
+			t.Errorf("%q: got %v, want ErrNoSplitPoint naming the whitespace pre-tokenizer", sText[:8], err)
+		}
+	}
+
+	// the whitespace pre-tokenizer cuts between words
+	pdTokenizer = mustTokenizer(t, newTestArtifact(t, asStreamUnits, aMerges, PreTokenizerWhitespace))
+	if _, err := streamTokens(pdTokenizer, iotest.OneByteReader(strings.NewReader(sWords)), 64); err != nil {
+		t.Errorf("whitespace pre-tokenizer: %v", err)
+	}
+}
+
+// TestStreamEncoderProse streams prose without control characters, many times the buffer, through
+// tokenizers without a pre-tokenizer: code points, the trained artifact and byte-level merges
+func TestStreamEncoderProse(t *testing.T) {
+	sText := strings.Repeat("The other thing's abc, there and then: ünïcode 👍🏽! ", 400)
+	mapTokenizers := map[string]*Tokenizer{
+		"code points": mustTokenizer(t, newTestArtifact(t, asStreamUnits, aStreamMerges, PreTokenizerNone)),
+	}
+	if pdTokenizer := streamTokenizers(t)["artifact"]; pdTokenizer != nil {
+		mapTokenizers["artifact"] = pdTokenizer
+	}
+	mapTokenizer := readFixtureHuggingFace(t)
+	mapTokenizer["pre_tokenizer"].(map[string]interface{})["use_regex"] = false
+	pdTokenizer, err := importHuggingFaceMap(t, mapTokenizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapTokenizers["byte-level"] = pdTokenizer
+
+	for sName, pdTokenizer := range mapTokenizers {
+		if pdTokenizer.pdEncoder.sPreTokenizer != PreTokenizerNone {
+			t.Fatalf("%s: pre-tokenizer %q", sName, pdTokenizer.pdEncoder.sPreTokenizer)
+		}
+		alActual, err := streamTokens(pdTokenizer, iotest.OneByteReader(strings.NewReader(sText)), 256)
+		if err != nil {
+			t.Fatalf("%s: %v", sName, err)
+		}
+		if !slices.Equal(alActual, pdTokenizer.Encode(sText)) {
+			t.Errorf("%s: streamed tokens differ from Encode", sName)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package bpe
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Template wraps encodings in special tokens. A pattern is a space-separated list of $A for the
+// first sequence, $B for the second and special token names, each optionally followed by :n to set
+// its token type id. Without one, $B has type 1 and a special token takes the type of the sequence
+// before it, so "<bos> $A <sep> $B <eos>" gives types 0 to the first half and 1 to the second.
+type Template struct {
+	Single string `json:"single"`
+	Pair   string `json:"pair,omitempty"`
+}
+
+// template used when none is selected: "$A" and "$A $B"
+var pdDefaultTemplate = &compiledTemplate{
+	aSingle: []templatePiece{{iSequence: 0}},
+	aPair:   []templatePiece{{iSequence: 0}, {iSequence: 1, iTypeID: 1}},
+}
+
+// templatePiece is a sequence or special token of a pattern; sequences have an empty special token
+type templatePiece struct {
+	sSpecialToken string
+	iSequence     int
+	iTypeID       int
+}
+
+// compiledTemplate is a template whose patterns have been parsed
+type compiledTemplate struct {
+	aSingle []templatePiece
+	aPair   []templatePiece
+}
+
+// compileTemplate parses both patterns of a template, checking their special tokens against mapSpecialTokens
+func compileTemplate(dataTemplate Template, mapSpecialTokens map[string]int64) (*compiledTemplate, error) {
+	aSingle, err := parsePattern(dataTemplate.Single, false, mapSpecialTokens)
+	if err != nil {
+		return nil, fmt.Errorf("single: %w", err)
+	}
+	pdCompiled := &compiledTemplate{aSingle: aSingle}
+	if dataTemplate.Pair != "" {
+		if pdCompiled.aPair, err = parsePattern(dataTemplate.Pair, true, mapSpecialTokens); err != nil {
+			return nil, fmt.Errorf("pair: %w", err)
+		}
+	}
+	return pdCompiled, nil
+}
+
+// compileTemplates parses a set of named templates
+func compileTemplates(mapTemplates map[string]Template, mapSpecialTokens map[string]int64) (map[string]*compiledTemplate, error) {
+	mapCompiled := make(map[string]*compiledTemplate, len(mapTemplates))
+	for sName, dataTemplate := range mapTemplates {
+		pdCompiled, err := compileTemplate(dataTemplate, mapSpecialTokens)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", sName, err)
+		}
+		mapCompiled[sName] = pdCompiled
+	}
+	return mapCompiled, nil
+}
+
+// parsePattern reads a pattern; a pair pattern needs $A and $B once each, a single one only $A
+func parsePattern(sPattern string, tfPair bool, mapSpecialTokens map[string]int64) ([]templatePiece, error) {
+	var aPieces []templatePiece
+	aiSequences := [2]int{}
+	iTypeID := 0
+	for _, sItem := range strings.Fields(sPattern) {
+		// an explicit type id follows the last colon
+		iExplicit := -1
+		if iColon := strings.LastIndexByte(sItem, ':'); iColon > 0 {
+			if iParsed, err := strconv.Atoi(sItem[iColon+1:]); err == nil && iParsed >= 0 {
+				sItem, iExplicit = sItem[:iColon], iParsed
+			}
+		}
+
+		dataPiece := templatePiece{iSequence: -1}
+		switch sItem {
+		case "$A":
+			dataPiece.iSequence, iTypeID = 0, 0
+		case "$B":
+			dataPiece.iSequence, iTypeID = 1, 1
+		default:
+			if _, tfOK := mapSpecialTokens[sItem]; !tfOK {
+				return nil, fmt.Errorf("%q is not a special token", sItem)
+			}
+			dataPiece.sSpecialToken = sItem
+		}
+		if dataPiece.iSequence >= 0 {
+			aiSequences[dataPiece.iSequence]++
+		}
+		// an explicit type on a sequence carries over to the special tokens after it
+		dataPiece.iTypeID = iTypeID
+		if iExplicit >= 0 {
+			dataPiece.iTypeID = iExplicit
+			if dataPiece.iSequence >= 0 {
+				iTypeID = iExplicit
+			}
+		}
+		aPieces = append(aPieces, dataPiece)
+	}
+
+	if aiSequences[0] != 1 {
+		return nil, errors.New("$A must appear exactly once")
+	}
+	if tfPair && aiSequences[1] != 1 {
+		return nil, errors.New("$B must appear exactly once")
+	}
+	if !tfPair && aiSequences[1] != 0 {
+		return nil, errors.New("$B is only allowed in a pair pattern")
+	}
+	return aPieces, nil
+}
+
+// addedTokens counts the special tokens a pattern adds
+func addedTokens(aPieces []templatePiece) int {
+	iAdded := 0
+	for _, dataPiece := range aPieces {
+		if dataPiece.iSequence < 0 {
+			iAdded++
+		}
+	}
+	return iAdded
+}
+
+// applyPattern wraps the encodings of the sequences in the special tokens of a pattern
+func (t *Tokenizer) applyPattern(aPieces []templatePiece, aSequences []Encoding) Encoding {
+	var dataResult Encoding
+	for _, dataPiece := range aPieces {
+		if dataPiece.iSequence < 0 {
+			dataResult.Tokens = append(dataResult.Tokens, t.pdArtifact.SpecialTokens[dataPiece.sSpecialToken])
+			dataResult.AttentionMask = append(dataResult.AttentionMask, 1)
+			dataResult.Offsets = append(dataResult.Offsets, Offset{})
+			dataResult.TypeIDs = append(dataResult.TypeIDs, dataPiece.iTypeID)
+			continue
+		}
+		dataSequence := aSequences[dataPiece.iSequence]
+		dataResult.Tokens = append(dataResult.Tokens, dataSequence.Tokens...)
+		dataResult.AttentionMask = append(dataResult.AttentionMask, dataSequence.AttentionMask...)
+		dataResult.Offsets = append(dataResult.Offsets, dataSequence.Offsets...)
+		for range dataSequence.Tokens {
+			dataResult.TypeIDs = append(dataResult.TypeIDs, dataPiece.iTypeID)
+		}
+	}
+	return dataResult
+}
@@ -0,0 +1,122 @@
+package bpe
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestTemplates checks the tokens and type ids that templates wrap single sequences and pairs in,
+// with default and explicit types, and how pairs and max lengths leave room for special tokens
+func TestTemplates(t *testing.T) {
+	pdTokenizer, err := newSpecialTokenizer(t).WithTemplates(map[string]Template{
+		"bert":   {Single: "<cls> $A <sep>", Pair: "<cls> $A <sep> $B <sep>"},
+		"typed":  {Single: "<cls>:2 $A", Pair: "$A:1 <sep> $B:0 <sep>:3"},
+		"single": {Single: "$A <sep>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dataCase := range []struct {
+		sName       string
+		asInputs    []string
+		dataOptions EncodeOptions
+		asTokens    []string
+		aiTypeIDs   []int
+	}{
+		{"no template", []string{"ab"}, EncodeOptions{}, []string{"a", "b"}, []int{0, 0}},
+		{"no template pair", []string{"ab", "c"}, EncodeOptions{}, []string{"a", "b", "c"}, []int{0, 0, 1}},
+		{"single", []string{"ab"}, EncodeOptions{Template: "bert"}, []string{"<cls>", "a", "b", "<sep>"}, []int{0, 0, 0, 0}},
+		{"pair", []string{"ab", "c"}, EncodeOptions{Template: "bert"}, []string{"<cls>", "a", "b", "<sep>", "c", "<sep>"}, []int{0, 0, 0, 0, 1, 1}},
+		{"explicit types", []string{"ab"}, EncodeOptions{Template: "typed"}, []string{"<cls>", "a", "b"}, []int{2, 0, 0}},
+		{"explicit pair types", []string{"a", "b"}, EncodeOptions{Template: "typed"}, []string{"a", "<sep>", "b", "<sep>"}, []int{1, 1, 0, 3}},
+		{"max length counts special tokens", []string{"abcdef"}, EncodeOptions{Template: "bert", MaxLength: 5}, []string{"<cls>", "a", "b", "c", "<sep>"}, []int{0, 0, 0, 0, 0}},
+		{"pair truncates the longer sequence", []string{"abcde", "fg"}, EncodeOptions{Template: "bert", MaxLength: 7}, []string{"<cls>", "a", "b", "<sep>", "f", "g", "<sep>"}, []int{0, 0, 0, 0, 1, 1, 1}},
+		{"pair truncates both", []string{"abcde", "fghi"}, EncodeOptions{Template: "bert", MaxLength: 7, Truncation: TruncateLeft}, []string{"<cls>", "d", "e", "<sep>", "h", "i", "<sep>"}, []int{0, 0, 0, 0, 1, 1, 1}},
+		{"padded pair", []string{"a", "b"}, EncodeOptions{Template: "bert", MaxLength: 6, Padding: PadMaxLength, PadToken: "<pad>"}, []string{"<cls>", "a", "<sep>", "b", "<sep>", "<pad>"}, []int{0, 0, 0, 1, 1, 0}},
+	} {
+		var dataEncoding Encoding
+		var err error
+		if len(dataCase.asInputs) == 1 {
+			dataEncoding, err = pdTokenizer.EncodeWithOptions(dataCase.asInputs[0], dataCase.dataOptions)
+		} else {
+			dataEncoding, err = pdTokenizer.EncodePairWithOptions(dataCase.asInputs[0], dataCase.asInputs[1], dataCase.dataOptions)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", dataCase.sName, err)
+			continue
+		}
+		if asTokens := pdTokenizer.TokenTexts(dataEncoding.Tokens); !slices.Equal(asTokens, dataCase.asTokens) || !slices.Equal(dataEncoding.TypeIDs, dataCase.aiTypeIDs) {
+			t.Errorf("%s: got %q with types %v, want %q with types %v", dataCase.sName, asTokens, dataEncoding.TypeIDs, dataCase.asTokens, dataCase.aiTypeIDs)
+		}
+		// special tokens are attended to but have no offsets
+		for iPosition, lToken := range dataEncoding.Tokens {
+			_, tfSpecial := pdTokenizer.pdArtifact.SpecialTokens[pdTokenizer.TokenText(lToken)]
+			if tfSpecial && dataEncoding.Offsets[iPosition] != (Offset{}) || !tfSpecial && dataEncoding.Offsets[iPosition] == (Offset{}) {
+				t.Errorf("%s: position %d has offset %+v", dataCase.sName, iPosition, dataEncoding.Offsets[iPosition])
+			}
+		}
+	}
+
+	// templates are recorded in the metadata and kept apart from the tokenizer they were added to
+	if dataMetadata := pdTokenizer.Metadata(); len(dataMetadata.Templates) != 3 {
+		t.Errorf("metadata lists templates %v", dataMetadata.Templates)
+	}
+	if _, err := newSpecialTokenizer(t).EncodeWithOptions("a", EncodeOptions{Template: "bert"}); err == nil {
+		t.Error("template leaked into a tokenizer without it")
+	}
+}
+
+// TestTemplateErrors checks the patterns a template refuses, and the selections that fail when encoding
+func TestTemplateErrors(t *testing.T) {
+	pdTokenizer := newSpecialTokenizer(t)
+	for _, dataCase := range []struct {
+		dataTemplate Template
+		sError       string
+	}{
+		{Template{Single: "<cls> $A <eos>"}, `template "t": single: "<eos>" is not a special token`},
+		{Template{Single: "<cls>"}, "single: $A must appear exactly once"},
+		{Template{Single: "$A $A"}, "single: $A must appear exactly once"},
+		{Template{Single: "$A $B"}, "single: $B is only allowed in a pair pattern"},
+		{Template{Single: "$A", Pair: "$A <sep>"}, "pair: $B must appear exactly once"},
+		{Template{Single: "$A", Pair: "$A $B $B"}, "pair: $B must appear exactly once"},
+		{Template{Single: "$A:x"}, `single: "$A:x" is not a special token`},
+	} {
+		if _, err := pdTokenizer.WithTemplates(map[string]Template{"t": dataCase.dataTemplate}); err == nil || !strings.Contains(err.Error(), dataCase.sError) {
+			t.Errorf("%+v: got %v, want %q", dataCase.dataTemplate, err, dataCase.sError)
+		}
+	}
+
+	// an artifact with an invalid template does not load
+	abData := editTestArtifact(t, newTestArtifact(t, nil, []testMerge{{"x", "y"}}, PreTokenizerWhitespace), func(pdArtifact *artifact) {
+		pdArtifact.Templates = map[string]Template{"t": {Single: "<cls> $A"}}
+	})
+	if _, err := NewTokenizerFromBytes(abData); err == nil || !strings.Contains(err.Error(), "invalid templates in artifact") {
+		t.Errorf("invalid artifact template: got %v", err)
+	}
+
+	pdTokenizer, err := pdTokenizer.WithTemplates(map[string]Template{"single": {Single: "<cls> $A <sep>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dataCase := range []struct {
+		asInputs    []string
+		dataOptions EncodeOptions
+		sError      string
+	}{
+		{[]string{"a"}, EncodeOptions{Template: "gpt"}, `template: unknown template "gpt"`},
+		{[]string{"a", "b"}, EncodeOptions{Template: "single"}, `template: "single" has no pair pattern`},
+		{[]string{"a"}, EncodeOptions{Template: "single", MaxLength: 2}, "max_length: 2 leaves no room next to the 2 special tokens of the template"},
+		{[]string{"abc"}, EncodeOptions{Template: "single", MaxLength: 4, Overflow: true, Stride: 2}, "stride: must be less than the 2 tokens"},
+	} {
+		var err error
+		if len(dataCase.asInputs) == 1 {
+			_, err = pdTokenizer.EncodeWithOptions(dataCase.asInputs[0], dataCase.dataOptions)
+		} else {
+			_, err = pdTokenizer.EncodePairWithOptions(dataCase.asInputs[0], dataCase.asInputs[1], dataCase.dataOptions)
+		}
+		if err == nil || !strings.Contains(err.Error(), dataCase.sError) {
+			t.Errorf("%+v: got %v, want %q", dataCase.dataOptions, err, dataCase.sError)
+		}
+	}
+}
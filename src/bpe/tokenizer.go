@@ -0,0 +1,430 @@
+package bpe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"normalize"
+	"os"
+	"slices"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// artifact is the typed form of a merges artifact file. Artifacts that predate a field simply leave it empty.
+// Byte-level artifacts, imported from other tokenizers, list the id of every byte in Bytes and the
+// pre-tokenizer in PreTokenizer, as they have no training configuration to take it from.
+type artifact struct {
+	Header        *ArtifactHeader     `json:"header,omitempty"`
+	Merges        map[string]int64    `json:"merges"`
+	Ordering      [][2]int64          `json:"ordering"`
+	SpecialTokens map[string]int64    `json:"special_tokens,omitempty"`
+	Units         map[string]int64    `json:"units,omitempty"`
+	Bytes         []int64             `json:"bytes,omitempty"`
+	PreTokenizer  string              `json:"pre_tokenizer,omitempty"`
+	Normalizer    *normalize.Config   `json:"normalizer,omitempty"`
+	Templates     map[string]Template `json:"templates,omitempty"`
+	Config        *TrainingConfig     `json:"config,omitempty"`
+}
+
+// readArtifact decodes an artifact from JSON, refusing formats newer than this reader
+func readArtifact(pdReader io.Reader) (*artifact, error) {
+	abData, err := io.ReadAll(pdReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	return decodeArtifact(abData)
+}
+
+// decodeArtifact decodes the contents of a JSON artifact
+func decodeArtifact(abData []byte) (*artifact, error) {
+	if err := checkVersion(abData); err != nil {
+		return nil, err
+	}
+	pdArtifact := &artifact{}
+	if err := json.Unmarshal(abData, pdArtifact); err != nil {
+		return nil, fmt.Errorf("failed to decode artifact: %w", err)
+	}
+	if len(pdArtifact.Ordering) == 0 {
+		return nil, errors.New(`"ordering" map has no merges`)
+	}
+	return pdArtifact, nil
+}
+
+// parseArtifact converts an artifact already decoded into a generic map
+func parseArtifact(mapTokenizer map[string]interface{}) (*artifact, error) {
+	abData, err := json.Marshal(mapTokenizer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	return readArtifact(bytes.NewReader(abData))
+}
+
+// ranks compiles the merges into a table from a pair of ids to the id it merges into
+func (a *artifact) ranks() (map[[2]int64]int64, error) {
+	mapRanks := make(map[[2]int64]int64, len(a.Merges))
+	for sPair, lToken := range a.Merges {
+		alPair, err := stringToKey(sPair)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read merges: %w", err)
+		}
+		mapRanks[alPair] = lToken
+	}
+	return mapRanks, nil
+}
+
+// encoder compiles the merge table of an artifact; every merge ranks by its first position in the
+// ordering. Binary artifacts have no ordering to compile and look merges up in their table instead.
+func (a *artifact) encoder(mapRanks map[[2]int64]int64, pdTable *tokenTable) (*Encoder, error) {
+	var mapRules map[[2]int64]mergeRule
+	if mapRanks != nil {
+		mapRules = make(map[[2]int64]mergeRule, len(a.Ordering))
+		for iIndex, alPair := range a.Ordering {
+			lToken, tfOK := mapRanks[alPair]
+			if !tfOK {
+				return nil, fmt.Errorf("minted token for %s does not exist", keyToString(alPair))
+			}
+			if _, tfOK := mapRules[alPair]; !tfOK {
+				mapRules[alPair] = mergeRule{lRank: int64(iIndex), lToken: lToken}
+			}
+		}
+	}
+	if len(a.Bytes) > 0 && len(a.Bytes) != 256 {
+		return nil, fmt.Errorf("bytes: expected the ids of all 256 bytes, got %d", len(a.Bytes))
+	}
+	sPreTokenizer := a.preTokenizer()
+	if sPreTokenizer != PreTokenizerNone && sPreTokenizer != PreTokenizerWhitespace && sPreTokenizer != PreTokenizerGPT2 {
+		return nil, fmt.Errorf("pre_tokenizer: unknown pre-tokenizer %q", sPreTokenizer)
+	}
+	return &Encoder{mapRules: mapRules, pdTable: pdTable, alBytes: a.Bytes, mapUnits: a.Units, sPreTokenizer: sPreTokenizer}, nil
+}
+
+// decodingMap spells out every special token, base unit and minted token. Base symbols are not
+// stored: ids without an entry decode as the code point they represent, except in byte-level
+// artifacts, whose bytes decode to themselves.
+func (a *artifact) decodingMap(mapRanks map[[2]int64]int64) (map[int64]string, error) {
+	mapTokens := make(map[int64]string, len(a.SpecialTokens)+len(a.Units)+len(a.Bytes)+len(a.Ordering))
+	for sSpecialToken, lID := range a.SpecialTokens {
+		mapTokens[lID] = sSpecialToken
+	}
+	for sUnit, lID := range a.Units {
+		mapTokens[lID] = sUnit
+	}
+	for iByte, lID := range a.Bytes {
+		mapTokens[lID] = string([]byte{byte(iByte)})
+	}
+
+	// minted tokens in the order they were created, so their parts are already known
+	for _, alPair := range a.Ordering {
+		lMintedToken, tfOK := mapRanks[alPair]
+		if !tfOK {
+			return nil, fmt.Errorf("minted token for %s does not exist", keyToString(alPair))
+		}
+		mapTokens[lMintedToken] = tokenString(mapTokens, alPair[0]) + tokenString(mapTokens, alPair[1])
+	}
+	return mapTokens, nil
+}
+
+// alphabetSize counts every byte of a byte-level artifact, every code point of the training
+// corpus, or for artifacts that do not record it every base code point the merges are built from
+func (a *artifact) alphabetSize() int {
+	if len(a.Bytes) > 0 {
+		return len(a.Bytes)
+	}
+	if a.Header != nil && a.Header.Alphabet != "" {
+		return utf8.RuneCountInString(a.Header.Alphabet)
+	}
+	mapAlphabet := make(map[int64]bool)
+	for _, alPair := range a.Ordering {
+		for _, lID := range alPair {
+			if lID <= unicode.MaxRune {
+				mapAlphabet[lID] = true
+			}
+		}
+	}
+	return len(mapAlphabet)
+}
+
+// preTokenizer returns the pre-tokenizer the artifact was trained or imported with
+func (a *artifact) preTokenizer() string {
+	if a.PreTokenizer != "" {
+		return a.PreTokenizer
+	}
+	if a.Config == nil {
+		return PreTokenizerNone
+	}
+	return a.Config.PreTokenizer
+}
+
+// normalizer builds the normalizer recorded in the artifact; artifacts that predate configurable
+// normalization get the default pipeline they were trained with
+func (a *artifact) normalizer() (*normalize.Normalizer, error) {
+	if a.Normalizer == nil {
+		return normalize.Default(), nil
+	}
+	pdNormalizer, err := normalize.New(*a.Normalizer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalizer in artifact: %w", err)
+	}
+	return pdNormalizer, nil
+}
+
+// Tokenizer is an immutable tokenizer loaded from an artifact; it is safe for concurrent use
+type Tokenizer struct {
+	pdArtifact   *artifact
+	pdEncoder    *Encoder
+	pdNormalizer *normalize.Normalizer
+	pdTable      *tokenTable
+	mapTemplates map[string]*compiledTemplate
+}
+
+// Metadata describes the artifact a Tokenizer was loaded from. Version 0 artifacts leave the
+// creation time, alphabet and corpus empty.
+type Metadata struct {
+	Version       int                 `json:"version"`
+	CreatedAt     time.Time           `json:"created_at,omitzero"`
+	Source        string              `json:"source,omitempty"`
+	VocabSize     int                 `json:"vocab_size"`
+	ByteLevel     bool                `json:"byte_level,omitempty"`
+	Alphabet      string              `json:"alphabet,omitempty"`
+	Corpus        *CorpusStats        `json:"corpus,omitempty"`
+	Merges        int                 `json:"merges"`
+	Units         int                 `json:"units"`
+	SpecialTokens map[string]int64    `json:"special_tokens"`
+	Normalizer    normalize.Config    `json:"normalizer"`
+	Templates     map[string]Template `json:"templates,omitempty"`
+	Training      *TrainingConfig     `json:"training,omitempty"`
+}
+
+// LoadTokenizer reads a tokenizer from an artifact file; binary artifacts are memory-mapped, and
+// must not change on disk while the tokenizer is in use
+func LoadTokenizer(sFilePath string) (*Tokenizer, error) {
+	pdFile, err := os.Open(sFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer pdFile.Close()
+	abMagic := make([]byte, len(sBinaryMagic))
+	if _, err := io.ReadFull(pdFile, abMagic); err == nil && isBinaryArtifact(abMagic) {
+		return loadBinary(pdFile)
+	}
+	if _, err := pdFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	return NewTokenizer(pdFile)
+}
+
+// NewTokenizerFromBytes reads a tokenizer from the contents of a JSON or binary artifact; a binary
+// artifact is used where it lies, so abData must not change while the tokenizer is in use
+func NewTokenizerFromBytes(abData []byte) (*Tokenizer, error) {
+	if isBinaryArtifact(abData) {
+		return newBinaryTokenizer(abData)
+	}
+	pdArtifact, err := decodeArtifact(abData)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenizer(pdArtifact)
+}
+
+// NewTokenizer reads a tokenizer from a JSON or binary artifact
+func NewTokenizer(pdReader io.Reader) (*Tokenizer, error) {
+	abData, err := io.ReadAll(pdReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	return NewTokenizerFromBytes(abData)
+}
+
+// newTokenizer lays out the vocabulary of a decoded JSON artifact as a binary artifact holds it and
+// compiles the rest
+func newTokenizer(pdArtifact *artifact) (*Tokenizer, error) {
+	mapRanks, err := pdArtifact.ranks()
+	if err != nil {
+		return nil, err
+	}
+	mapDecoder, err := pdArtifact.decodingMap(mapRanks)
+	if err != nil {
+		return nil, err
+	}
+	pdTable, err := newTokenTable(pdArtifact, mapRanks, mapDecoder)
+	if err != nil {
+		return nil, err
+	}
+	return pdArtifact.compile(mapRanks, pdTable)
+}
+
+// compile builds the normalizer, templates and encoder of an artifact around its token table
+func (a *artifact) compile(mapRanks map[[2]int64]int64, pdTable *tokenTable) (*Tokenizer, error) {
+	pdNormalizer, err := a.normalizer()
+	if err != nil {
+		return nil, err
+	}
+	mapTemplates, err := compileTemplates(a.Templates, a.SpecialTokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid templates in artifact: %w", err)
+	}
+	pdEncoder, err := a.encoder(mapRanks, pdTable)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokenizer{pdArtifact: a, pdEncoder: pdEncoder, pdNormalizer: pdNormalizer, pdTable: pdTable, mapTemplates: mapTemplates}, nil
+}
+
+// Encode converts a string to token ids
+func (t *Tokenizer) Encode(sInput string) []int64 {
+	return t.pdEncoder.Encode(t.pdNormalizer, sInput)
+}
+
+// Count returns the number of tokens Encode produces for a string without building them
+func (t *Tokenizer) Count(sInput string) int {
+	return t.pdEncoder.count(t.pdNormalizer.Normalize(sInput))
+}
+
+// EncodeWithOffsets converts a string to token ids along with the span of the original input every token covers
+func (t *Tokenizer) EncodeWithOffsets(sInput string) ([]int64, []Offset, error) {
+	return t.pdEncoder.encodeWithOffsets(t.pdNormalizer, t.TokenText, sInput)
+}
+
+// Decode converts token ids back to text, undoing the reversible normalization steps; ids outside
+// the vocabulary become U+FFFD
+func (t *Tokenizer) Decode(alTokens []int64) (string, error) {
+	return t.DecodeWithOptions(alTokens, DecodeOptions{})
+}
+
+// WithCache returns a copy of the tokenizer that caches the encodings of up to iCapacity
+// pre-tokenized chunks; a capacity of zero or less returns a copy without a cache
+func (t *Tokenizer) WithCache(iCapacity int) *Tokenizer {
+	pdCopy := *t
+	pdEncoder := *t.pdEncoder
+	pdEncoder.pdCache = nil
+	if iCapacity > 0 {
+		pdEncoder.pdCache = newChunkCache(iCapacity)
+	}
+	pdCopy.pdEncoder = &pdEncoder
+	return &pdCopy
+}
+
+// WithTemplates returns a copy of the tokenizer with additional templates, replacing those of the
+// artifact with the same name
+func (t *Tokenizer) WithTemplates(mapTemplates map[string]Template) (*Tokenizer, error) {
+	mapCompiled, err := compileTemplates(mapTemplates, t.pdArtifact.SpecialTokens)
+	if err != nil {
+		return nil, err
+	}
+	pdCopy := *t
+	pdArtifact := *t.pdArtifact
+	pdArtifact.Templates = maps.Clone(t.pdArtifact.Templates)
+	if pdArtifact.Templates == nil {
+		pdArtifact.Templates = make(map[string]Template, len(mapTemplates))
+	}
+	maps.Copy(pdArtifact.Templates, mapTemplates)
+	pdCopy.pdArtifact = &pdArtifact
+	pdCopy.mapTemplates = maps.Clone(t.mapTemplates)
+	maps.Copy(pdCopy.mapTemplates, mapCompiled)
+	return &pdCopy, nil
+}
+
+// CacheStats reports the hits and misses of the chunk cache, which are zero without a cache
+func (t *Tokenizer) CacheStats() CacheStats {
+	if t.pdEncoder.pdCache == nil {
+		return CacheStats{}
+	}
+	return t.pdEncoder.pdCache.stats()
+}
+
+// TokenText returns the text of a token as it appears in normalized text; unknown ids are read as code points
+func (t *Tokenizer) TokenText(lID int64) string {
+	if sText, tfOK := t.pdTable.text(lID); tfOK {
+		return sText
+	}
+	return string(rune(lID))
+}
+
+// TokenTexts returns the text of every token
+func (t *Tokenizer) TokenTexts(alTokens []int64) []string {
+	asTokens := make([]string, len(alTokens))
+	for iIndex, lToken := range alTokens {
+		asTokens[iIndex] = t.TokenText(lToken)
+	}
+	return asTokens
+}
+
+// IDToToken returns the text of a token and whether the id belongs to the vocabulary
+func (t *Tokenizer) IDToToken(lID int64) (string, bool) {
+	if sText, tfOK := t.pdTable.text(lID); tfOK {
+		return sText, true
+	}
+	if t.pdEncoder.alBytes != nil || lID < 0 || lID > unicode.MaxRune || !utf8.ValidRune(rune(lID)) {
+		return "", false
+	}
+	return string(rune(lID)), true
+}
+
+// TokenToID returns the id of a special token name, or else the first id that spells a token text
+func (t *Tokenizer) TokenToID(sToken string) (int64, bool) {
+	if lID, tfOK := t.pdArtifact.SpecialTokens[sToken]; tfOK {
+		return lID, true
+	}
+	if lID, tfOK := t.pdTable.id(sToken); tfOK {
+		return lID, true
+	}
+	if t.pdEncoder.alBytes != nil {
+		return 0, false
+	}
+	if r, iSize := utf8.DecodeRuneInString(sToken); iSize == len(sToken) && (r != utf8.RuneError || iSize > 1) {
+		return int64(r), true
+	}
+	return 0, false
+}
+
+// VocabSize counts the base code points or bytes, the multi-rune base units, the special tokens
+// and the minted tokens, which imported vocabularies may reach through more than one merge
+func (t *Tokenizer) VocabSize() int {
+	return t.pdTable.iAlphabet + len(t.pdArtifact.Units) + len(t.pdArtifact.SpecialTokens) + t.pdTable.iMinted
+}
+
+// Normalizer returns the normalizer recorded in the artifact
+func (t *Tokenizer) Normalizer() *normalize.Normalizer {
+	return t.pdNormalizer
+}
+
+// Metadata describes the artifact; the returned value is a copy
+func (t *Tokenizer) Metadata() Metadata {
+	dataMetadata := Metadata{
+		VocabSize:     t.VocabSize(),
+		ByteLevel:     t.pdEncoder.alBytes != nil,
+		Merges:        t.pdTable.merges(),
+		Units:         len(t.pdArtifact.Units),
+		SpecialTokens: maps.Clone(t.pdArtifact.SpecialTokens),
+		Normalizer:    t.pdNormalizer.Config(),
+		Templates:     maps.Clone(t.pdArtifact.Templates),
+		Training:      t.trainingConfig(),
+	}
+	if pdHeader := t.pdArtifact.Header; pdHeader != nil {
+		dataMetadata.Version = pdHeader.Version
+		dataMetadata.CreatedAt = pdHeader.CreatedAt
+		dataMetadata.Source = pdHeader.Source
+		dataMetadata.Alphabet = pdHeader.Alphabet
+		if pdHeader.Corpus != nil {
+			dataCorpus := *pdHeader.Corpus
+			dataCorpus.Sources = slices.Clone(pdHeader.Corpus.Sources)
+			dataCorpus.Languages = maps.Clone(pdHeader.Corpus.Languages)
+			dataMetadata.Corpus = &dataCorpus
+		}
+	}
+	return dataMetadata
+}
+
+// trainingConfig copies the training configuration recorded in the artifact, if any
+func (t *Tokenizer) trainingConfig() *TrainingConfig {
+	if t.pdArtifact.Config == nil {
+		return nil
+	}
+	dataConfig := *t.pdArtifact.Config
+	return &dataConfig
+}
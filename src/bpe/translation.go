@@ -1,15 +1,16 @@
 package bpe
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"normalize"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
+	"unicode/utf8"
 )
 
 // helper: convert string key "1,2" back to [2]int64
@@ -60,18 +61,33 @@ func keyToString(alKey [2]int64) string {
 	return strconv.FormatInt(alKey[0], 10) + "," + strconv.FormatInt(alKey[1], 10)
 }
 
-// WriteMergesMapToJSONFile converts a map[[2]int64]int to a string-keyed map and writes it as JSON
-func WriteMergesMapToJSONFile(mapMerges *Merges, sFilePath string) error {
+// WriteMergesMapToJSONFile converts a map[[2]int64]int to a string-keyed map and writes it as JSON,
+// together with the header, the special tokens and the configuration that produced it
+func WriteMergesMapToJSONFile(mapMerges *Merges, pdConfig *TrainingConfig, sFilePath string) error {
 	// Convert merges to JSON-friendly format
 	mapMergesJSON := make(map[string]int64, len(mapMerges.mapMerges))
 	for alKeys, iValue := range mapMerges.mapMerges {
 		mapMergesJSON[keyToString(alKeys)] = iValue
 	}
 
-	// Create overall JSON Map
+	// Create overall JSON Map, led by the header that tells readers which format it is in
 	mapJSON := make(map[string]interface{})
+	mapJSON["header"] = mapMerges.stamp()
 	mapJSON["merges"] = mapMergesJSON
 	mapJSON["ordering"] = mapMerges.alKeys
+	if len(mapMerges.mapSpecialTokens) > 0 {
+		mapJSON["special_tokens"] = mapMerges.mapSpecialTokens
+	}
+	if len(mapMerges.mapUnits) > 0 {
+		mapJSON["units"] = mapMerges.mapUnits
+	}
+	if pdConfig != nil {
+		mapJSON["normalizer"] = pdConfig.Normalizer
+		if len(pdConfig.Templates) > 0 {
+			mapJSON["templates"] = pdConfig.Templates
+		}
+		mapJSON["config"] = pdConfig
+	}
 
 	// Marshal without indentation (compressed format)
 	abData, err := json.Marshal(mapJSON)
@@ -87,35 +103,6 @@ func WriteMergesMapToJSONFile(mapMerges *Merges, sFilePath string) error {
 	return nil
 }
 
-// getSmallestMintedTokenPair: For a dataset, get the pair corresponding to the smallest minted token
-func getSmallestMintedTokenPair(dataStatistics *dataStatistics, mapMerges map[string]interface{}) ([2]int64, bool) {
-	// state variables
-	tfFound := false
-	var minToken int64
-	minToken = math.MaxInt64
-	var minPair [2]int64
-
-	// iterate over sentence statistics
-	for alPair := range dataStatistics.mapPairFrequency {
-		// Check if a minted token exists
-		lMintedToken, tfOK := mapMerges[keyToString(alPair)]
-		if !tfOK {
-			continue
-		}
-
-		// Found something (prevents break condition in the caller)
-		tfFound = true
-
-		// track the lowest minted token
-		if int64(lMintedToken.(float64)) < minToken {
-			minToken = int64(lMintedToken.(float64))
-			minPair[0] = int64(alPair[0])
-			minPair[1] = int64(alPair[1])
-		}
-	}
-	return minPair, tfFound
-}
-
 // recursively get the characters that make up this set, return as string
 func getCharacterComposition(token int64, mapMerges map[string]interface{}) ([]string, error) {
 	// iterate over map
@@ -162,6 +149,15 @@ func getCharacterComposition(token int64, mapMerges map[string]interface{}) ([]s
 	}
 }
 
+// TokenTexts: look up the text of every token in the decoding map
+func TokenTexts(mapDecoder map[int64]string, alTokens []int64) []string {
+	asTokens := make([]string, len(alTokens))
+	for iIndex, lToken := range alTokens {
+		asTokens[iIndex] = tokenString(mapDecoder, lToken)
+	}
+	return asTokens
+}
+
 // ListToTokens: list tokens to character sets
 func ListToTokens(tokenList []int64, mapMerges map[string]interface{}) ([]string, error) {
 	// convert every token to its character
@@ -181,152 +177,173 @@ func ListToTokens(tokenList []int64, mapMerges map[string]interface{}) ([]string
 	return asTokens, nil
 }
 
-// Encode: convert a string to a token list (integers)
-func Encode(mapMerges map[string]interface{}, sInput string) ([]int64, error) {
-	// normalize string
-	sInput = normalize.Normalize(sInput)
-
-	// Convert input to unicode integers
-	var unicodePoints []int64
-	for _, r := range sInput {
-		unicodePoints = append(unicodePoints, int64(r))
-	}
-
-	// create dataset
-	dataset := &dataDataset{
-		aalSentences: [][]int64{unicodePoints},
-		pdMutex:      &sync.Mutex{},
-	}
-
-	// get stats
-	var dataMergeStatistics *dataStatistics
-
-	// encoding loop
-	for {
-		// initialize statistics
-		dataMergeStatistics = &dataStatistics{
-			mapPairFrequency: make(map[[2]int64]int),
-			pdMutex:          &sync.Mutex{},
-		}
-
-		// populate statistics
-		err := countStatistics(dataMergeStatistics, dataset)
+// LoadNormalizer builds the normalizer recorded in an artifact; artifacts that predate
+// configurable normalization get the default pipeline they were trained with
+func LoadNormalizer(mapTokenizer map[string]interface{}) (*normalize.Normalizer, error) {
+	pdArtifact := &artifact{}
+	if dataNormalizer, tfOK := mapTokenizer["normalizer"]; tfOK && dataNormalizer != nil {
+		abData, err := json.Marshal(dataNormalizer)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate merge pairs: %w", err)
+			return nil, fmt.Errorf("failed to read normalizer: %w", err)
 		}
-
-		// Get the smallest minted token from statistics
-		alPair, tfOK := getSmallestMintedTokenPair(dataMergeStatistics, mapMerges)
-		if !tfOK {
-			break
+		pdArtifact.Normalizer = &normalize.Config{}
+		if err := json.Unmarshal(abData, pdArtifact.Normalizer); err != nil {
+			return nil, fmt.Errorf("failed to read normalizer: %w", err)
 		}
-
-		// Replace all instances of alPair in the dataset and reassign the dataset for subsequent iteration
-		replace(alPair, int64(mapMerges[keyToString(alPair)].(float64)), dataset)
 	}
-	return dataset.aalSentences[0], nil
+	return pdArtifact.normalizer()
 }
 
-func GenerateDecodingMap(mapTokenizer map[string]interface{}) (map[int64]string, error) {
-	// get the highest token
-	mapOrdering, tfOK := mapTokenizer["ordering"]
-	if !tfOK {
-		return nil, errors.New(`"ordering" not found in merges map`)
-	}
-	aalInsertOrder, tfOK := mapOrdering.([]interface{})
-	if !tfOK {
-		return nil, errors.New(`"ordering" map has unexpected structure`)
-	}
-	if len(aalInsertOrder) == 0 {
-		return nil, errors.New(`"ordering" map has no merges`)
-	}
-	lMaxToken := aalInsertOrder[len(aalInsertOrder)-1]
+// Encode: convert a string to a token list (integers) with a merges map, using the default normalizer
+//
+// Deprecated: every call compiles the whole merges map; load a Tokenizer once and use its Encode.
+func Encode(mapMerges map[string]interface{}, sInput string) ([]int64, error) {
+	return EncodeWithNormalizer(normalize.Default(), mapMerges, sInput)
+}
 
-	// convert to key
-	alTokens, tfOK := lMaxToken.([]interface{})
-	if !tfOK {
-		return nil, errors.New("highest token is not inferrable")
+// EncodeWithNormalizer: convert a string to a token list (integers) with a merges map, after
+// applying the given normalizer. Merges apply in the order of the ids they mint, as in the
+// original encoder; base units and byte-level vocabularies need the whole artifact.
+//
+// Deprecated: every call compiles the whole merges map; load a Tokenizer once and use its Encode.
+func EncodeWithNormalizer(pdNormalizer *normalize.Normalizer, mapMerges map[string]interface{}, sInput string) ([]int64, error) {
+	pdArtifact, err := mergesArtifact(mapMerges)
+	if err != nil {
+		return nil, err
 	}
-	fFirstToken, tfOK := alTokens[0].(float64)
-	if !tfOK {
-		return nil, errors.New("malformed first token in merges map")
+	mapRanks, err := pdArtifact.ranks()
+	if err != nil {
+		return nil, err
 	}
-	fSecondToken, tfOK := alTokens[1].(float64)
-	if !tfOK {
-		return nil, errors.New("malformed second token in merges map")
+	pdEncoder, err := pdArtifact.encoder(mapRanks, nil)
+	if err != nil {
+		return nil, err
 	}
+	return pdEncoder.Encode(pdNormalizer, sInput), nil
+}
 
-	// initial population
-	dataMerges, tfOK := mapTokenizer["merges"]
-	if !tfOK {
-		return nil, errors.New("map merges does not exist")
+// mergesArtifact rebuilds an artifact from a merges map alone; the ordering is the merges sorted by
+// the ids they mint, which is the order training created them in
+func mergesArtifact(mapMerges map[string]interface{}) (*artifact, error) {
+	type mergeEntry struct {
+		alPair [2]int64
+		lToken int64
 	}
-	mapMerges, tfOK := dataMerges.(map[string]interface{})
-	if !tfOK {
-		return nil, errors.New("Merges map type is incorrect")
+	aEntries := make([]mergeEntry, 0, len(mapMerges))
+	for sPair, dataToken := range mapMerges {
+		alPair, err := stringToKey(sPair)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read merges: %w", err)
+		}
+		fToken, tfOK := dataToken.(float64)
+		if !tfOK {
+			return nil, fmt.Errorf("failed to read merges: minted token of %s is not a number", sPair)
+		}
+		aEntries = append(aEntries, mergeEntry{alPair: alPair, lToken: int64(fToken)})
 	}
+	slices.SortFunc(aEntries, func(dataFirst mergeEntry, dataSecond mergeEntry) int {
+		return cmp.Compare(dataFirst.lToken, dataSecond.lToken)
+	})
 
-	// get the max token
-	dataMaxToken, tfOK := mapMerges[keyToString([2]int64{int64(fFirstToken), int64(fSecondToken)})]
-	if !tfOK {
-		return nil, errors.New("no max token exists")
+	pdArtifact := &artifact{Merges: make(map[string]int64, len(aEntries)), Ordering: make([][2]int64, len(aEntries))}
+	for iIndex, dataEntry := range aEntries {
+		pdArtifact.Merges[keyToString(dataEntry.alPair)] = dataEntry.lToken
+		pdArtifact.Ordering[iIndex] = dataEntry.alPair
 	}
-	fMaxToken, tfOK := dataMaxToken.(float64)
-	if !tfOK {
-		return nil, errors.New("token type is not int/float")
-	}
-	iMaxToken := int64(fMaxToken)
+	return pdArtifact, nil
+}
 
-	// populate the map with the basic mapping before overrides
-	iIndex := int64(0)
-	mapTokens := make(map[int64]string)
-	for iIndex < iMaxToken {
-		mapTokens[iIndex] = string(rune(iIndex))
-		iIndex += 1
+// Offset locates a token in the original, un-normalized input
+type Offset struct {
+	ByteStart int `json:"byte_start"`
+	ByteEnd   int `json:"byte_end"`
+	RuneStart int `json:"rune_start"`
+	RuneEnd   int `json:"rune_end"`
+}
+
+// EncodeWithOffsets: convert a string to a token list and report, for every token, the span of the
+// original input it covers. Tokens produced from a single expanded character share its span.
+//
+// Deprecated: every call compiles the whole artifact; load a Tokenizer once and use its EncodeWithOffsets.
+func EncodeWithOffsets(pdNormalizer *normalize.Normalizer, mapTokenizer map[string]interface{}, mapDecoder map[int64]string, sInput string) ([]int64, []Offset, error) {
+	pdEncoder, err := NewEncoder(mapTokenizer)
+	if err != nil {
+		return nil, nil, err
 	}
+	return pdEncoder.EncodeWithOffsets(pdNormalizer, mapDecoder, sInput)
+}
 
-	// override some with the minted tokens
-	for _, lMintedKey := range aalInsertOrder {
-		alTokens, tfOK = lMintedKey.([]interface{})
-		if !tfOK {
-			return nil, errors.New("tokens type cannot be inferred")
-		}
-		if len(alTokens) != 2 {
-			return nil, errors.New("cncorrect token count")
-		}
-		fFirstToken, tfOK = alTokens[0].(float64)
-		if !tfOK {
-			return nil, errors.New("cannot convert first token to float")
-		}
-		fSecondToken, tfOK := alTokens[1].(float64)
-		if !tfOK {
-			return nil, errors.New("cannot convert second token to float")
-		}
+// EncodeWithOffsets converts a string to a token list and reports, for every token, the span of the
+// original input it covers
+func (e *Encoder) EncodeWithOffsets(pdNormalizer *normalize.Normalizer, mapDecoder map[int64]string, sInput string) ([]int64, []Offset, error) {
+	return e.encodeWithOffsets(pdNormalizer, func(lToken int64) string { return tokenString(mapDecoder, lToken) }, sInput)
+}
 
-		// get token
-		dataMerges, tfOK := mapTokenizer["merges"]
-		if !tfOK {
-			return nil, errors.New("map merges does not exist")
-		}
-		mapMerges, tfOK := dataMerges.(map[string]interface{})
-		if !tfOK {
-			return nil, errors.New("merges map type is incorrect")
+// encodeWithOffsets measures every token by the text fnText spells it with
+func (e *Encoder) encodeWithOffsets(pdNormalizer *normalize.Normalizer, fnText func(int64) string, sInput string) ([]int64, []Offset, error) {
+	// normalize while keeping track of where every byte came from
+	sNormalized, aAlignment := pdNormalizer.NormalizeWithAlignment(sInput)
+	alTokens := e.encode(sNormalized)
+
+	// rune index of every byte of the original input; tokens of byte-level vocabularies can start or
+	// end inside a character, whose bytes all belong to it
+	aiRuneIndex := make([]int, len(sInput)+1)
+	iRunes := 0
+	for iIndex := 0; iIndex < len(sInput); iRunes++ {
+		_, iSize := utf8.DecodeRuneInString(sInput[iIndex:])
+		for iByte := iIndex; iByte < iIndex+iSize; iByte++ {
+			aiRuneIndex[iByte] = iRunes
 		}
-		sKey := keyToString([2]int64{int64(fFirstToken), int64(fSecondToken)})
-		dataMintedToken, tfOK := mapMerges[sKey]
-		if !tfOK {
-			return nil, errors.New("minted token does not exist")
+		iIndex += iSize
+	}
+	aiRuneIndex[len(sInput)] = iRunes
+
+	// walk the normalized string token by token
+	aOffsets := make([]Offset, len(alTokens))
+	iPosition := 0
+	for iIndex, lToken := range alTokens {
+		sToken := fnText(lToken)
+		dataSpan := aAlignment.Span(iPosition, iPosition+len(sToken))
+		iRuneEnd := aiRuneIndex[dataSpan.End]
+		if dataSpan.End > 0 && aiRuneIndex[dataSpan.End-1] == iRuneEnd {
+			iRuneEnd++
 		}
-		fMintedToken, tfOK := dataMintedToken.(float64)
-		if !tfOK {
-			return nil, errors.New("minted token is not float")
+		aOffsets[iIndex] = Offset{
+			ByteStart: dataSpan.Start,
+			ByteEnd:   dataSpan.End,
+			RuneStart: aiRuneIndex[dataSpan.Start],
+			RuneEnd:   iRuneEnd,
 		}
+		iPosition += len(sToken)
+	}
+	if iPosition != len(sNormalized) {
+		return nil, nil, fmt.Errorf("token texts cover %d bytes of a %d byte normalized input", iPosition, len(sNormalized))
+	}
 
-		// override
-		mapTokens[int64(fMintedToken)] = mapTokens[int64(fFirstToken)] + mapTokens[int64(fSecondToken)]
+	return alTokens, aOffsets, nil
+}
+
+// GenerateDecodingMap spells out the special tokens, base units and minted tokens of an artifact
+//
+// Deprecated: load a Tokenizer and use its TokenText, which needs no map of the vocabulary.
+func GenerateDecodingMap(mapTokenizer map[string]interface{}) (map[int64]string, error) {
+	pdArtifact, err := parseArtifact(mapTokenizer)
+	if err != nil {
+		return nil, err
+	}
+	mapRanks, err := pdArtifact.ranks()
+	if err != nil {
+		return nil, err
 	}
+	return pdArtifact.decodingMap(mapRanks)
+}
 
-	return mapTokens, nil
+// tokenString returns the text of a token; tokens that are not in the map are raw Unicode code points
+func tokenString(mapTokens map[int64]string, lToken int64) string {
+	if sToken, tfOK := mapTokens[lToken]; tfOK {
+		return sToken
+	}
+	return string(rune(lToken))
 }
 
 // Decode: convert a token list (integers) to a string
@@ -334,56 +351,39 @@ func Decode(mapTokens map[int64]string, tokens []int64) (string, error) {
 	// decode overall string using new mapping
 	var sResult string
 	for _, lToken := range tokens {
-		tokenStr, exists := mapTokens[lToken]
-		if !exists {
-			// If token doesn't exist in our map, use the raw token as a Unicode code point
-			tokenStr = string(rune(lToken))
-		}
-		sResult += tokenStr
+		sResult += tokenString(mapTokens, lToken)
 	}
 	return sResult, nil
 }
 
-// [Test Function] EncodeDecode converts a string to an integer list and back to a string to demonstrate the validity of BPE
-func EncodeDecode(sFilePath string) error {
-	// read merges map into json
-	pdFile, err := os.Open(sFilePath)
+// DecodeWithNormalizer: convert a token list (integers) to a string and undo the reversible
+// normalization steps, such as case markers
+func DecodeWithNormalizer(pdNormalizer *normalize.Normalizer, mapTokens map[int64]string, tokens []int64) (string, error) {
+	sResult, err := Decode(mapTokens, tokens)
 	if err != nil {
-		return fmt.Errorf("failed to marshal map: %w", err)
+		return "", err
 	}
-	defer pdFile.Close()
-
-	// Create a map to store the JSON data
-	var mapMerges map[string]interface{}
+	return pdNormalizer.Denormalize(sResult), nil
+}
 
-	// Decode the JSON data into the map
-	pdDecoder := json.NewDecoder(pdFile)
-	err = pdDecoder.Decode(&mapMerges)
+// [Test Function] EncodeDecode converts a string to an integer list and back to a string to demonstrate the validity of BPE
+func EncodeDecode(sFilePath string) error {
+	// load the tokenizer
+	pdTokenizer, err := LoadTokenizer(sFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to marshal map: %w", err)
+		return fmt.Errorf("unable to load tokenizer: %w", err)
 	}
 
-	// encode a string
+	// encode a string and look up the text of every token
 	sInput := "there is a lot of work to do"
-	alEncoded, err := Encode(mapMerges["merges"].(map[string]interface{}), sInput)
-	if err != nil {
-		return fmt.Errorf("unable to encode: %w", err)
-	}
-
-	// convert to character set
-	asTokens, err := ListToTokens(alEncoded, mapMerges["merges"].(map[string]interface{}))
-	if err != nil {
-		return fmt.Errorf("unable to convert to token list: %w", err)
-	}
-
-	// get the decoding map
-	mapDecoder, err := GenerateDecodingMap(mapMerges)
-	if err != nil {
-		return fmt.Errorf("unable to generate decoded map: %w", err)
+	alEncoded := pdTokenizer.Encode(sInput)
+	asTokens := make([]string, len(alEncoded))
+	for iIndex, lToken := range alEncoded {
+		asTokens[iIndex] = pdTokenizer.TokenText(lToken)
 	}
 
 	// decode it
-	sDecoded, err := Decode(mapDecoder, alEncoded)
+	sDecoded, err := pdTokenizer.Decode(alEncoded)
 	if err != nil {
 		return fmt.Errorf("failed to decode list: %w", err)
 	}
@@ -0,0 +1,48 @@
+package bpe
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+)
+
+// TestLegacyEncode checks that the map-based Encode still works with the merges map of an artifact
+// alone, and agrees with the Tokenizer loaded from the whole artifact
+func TestLegacyEncode(t *testing.T) {
+	abData, err := os.ReadFile("../../artifacts/merges.json")
+	if err != nil {
+		t.Skip(err)
+	}
+	var mapTokenizer map[string]interface{}
+	if err := json.Unmarshal(abData, &mapTokenizer); err != nil {
+		t.Fatal(err)
+	}
+	mapMerges, tfOK := mapTokenizer["merges"].(map[string]interface{})
+	if !tfOK {
+		t.Fatal("artifact has no merges map")
+	}
+	pdTokenizer := mustTokenizer(t, abData)
+	pdNormalizer, err := LoadNormalizer(mapTokenizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sInput := range testTexts(t)[:8] {
+		alExpected := pdTokenizer.Encode(sInput)
+		alActual, err := Encode(mapMerges, sInput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(alActual, alExpected) {
+			t.Errorf("Encode(%q) = %v, want %v", sInput, alActual, alExpected)
+		}
+		if alActual, err = EncodeWithNormalizer(pdNormalizer, mapMerges, sInput); err != nil || !slices.Equal(alActual, alExpected) {
+			t.Errorf("EncodeWithNormalizer(%q) = %v, %v, want %v", sInput, alActual, err, alExpected)
+		}
+	}
+
+	if _, err := Encode(map[string]interface{}{"1,2": "x"}, "a"); err == nil {
+		t.Error("a merge minting a string was accepted")
+	}
+}
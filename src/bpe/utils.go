@@ -8,18 +8,75 @@ import (
 	"os"
 	"sync"
 	"time"
+	"unicode"
 )
 
-// dataDataset holds the sentences and a mutex for concurrent access.
+// dataDataset holds the sentences and a mutex for concurrent access, along with the ids reserved
+// for special tokens and multi-rune base units, which clusters become such units, and how many
+// sentences every language contributed.
 type dataDataset struct {
-	aalSentences [][]int64
-	pdMutex      *sync.Mutex
+	aalSentences     [][]int64
+	pdMutex          *sync.Mutex
+	mapSpecialTokens map[string]int64
+	mapUnits         map[string]int64
+	mapLanguages     map[string]int
+	lNextID          int64
+	sBaseUnits       string
+	tfEmojiUnits     bool
+}
+
+// newDataset creates an empty dataset. Reserved ids start past the Unicode range so that every id
+// below it is unambiguously a code point; special tokens come first so they stay stable across runs.
+func newDataset(asSpecialTokens []string, sBaseUnits string, tfEmojiUnits bool) *dataDataset {
+	dataDataset := &dataDataset{
+		pdMutex:          &sync.Mutex{},
+		mapSpecialTokens: make(map[string]int64),
+		mapUnits:         make(map[string]int64),
+		mapLanguages:     make(map[string]int),
+		lNextID:          int64(unicode.MaxRune) + 1,
+		sBaseUnits:       sBaseUnits,
+		tfEmojiUnits:     tfEmojiUnits,
+	}
+	for _, sSpecialToken := range asSpecialTokens {
+		dataDataset.mapSpecialTokens[sSpecialToken] = dataDataset.lNextID
+		dataDataset.lNextID++
+	}
+	return dataDataset
 }
 
-// Merges tracks the order of insertions into a map
+// unitID returns the id of a multi-rune base unit, reserving one the first time the unit is seen.
+// Clusters that are not atomic under the configured base units report false.
+func (d *dataDataset) unitID(sCluster string) (int64, bool) {
+	if !isAtomicUnit(d.sBaseUnits, d.tfEmojiUnits, sCluster) {
+		return 0, false
+	}
+	d.pdMutex.Lock()
+	defer d.pdMutex.Unlock()
+	lUnit, tfOK := d.mapUnits[sCluster]
+	if !tfOK {
+		lUnit = d.lNextID
+		d.mapUnits[sCluster] = lUnit
+		d.lNextID++
+	}
+	return lUnit, true
+}
+
+// countSentences records the sentences a language contributed to the dataset
+func (d *dataDataset) countSentences(sLanguage string, iSentences int) {
+	d.pdMutex.Lock()
+	defer d.pdMutex.Unlock()
+	d.mapLanguages[sLanguage] += iSentences
+}
+
+// Merges tracks the order of insertions into a map, along with the reserved special tokens and base
+// units, the header describing the corpus and the text of every token so far
 type Merges struct {
-	mapMerges map[[2]int64]int64
-	alKeys    [][2]int64
+	mapMerges        map[[2]int64]int64
+	alKeys           [][2]int64
+	mapSpecialTokens map[string]int64
+	mapUnits         map[string]int64
+	dataHeader       ArtifactHeader
+	mapTexts         map[int64]string
 }
 
 // dataStatistics holds the frequency of pairs and a mutex for concurrent access.
@@ -36,6 +93,13 @@ func (m *Merges) insertMerge(alPair [2]int64, lMintedToken int64) {
 
 	// add to map
 	m.mapMerges[alPair] = lMintedToken
+	m.mapTexts[lMintedToken] = m.tokenText(alPair[0]) + m.tokenText(alPair[1])
+}
+
+// tokenText returns the text of a token as the artifact will decode it; ids without an entry are
+// code points
+func (m *Merges) tokenText(lID int64) string {
+	return tokenString(m.mapTexts, lID)
 }
 
 // insertPair increments the count for a given pair in StatisticsMap
@@ -61,20 +125,16 @@ func (d *dataDataset) add(alSentence []int64) {
 	d.aalSentences = append(d.aalSentences, alSentence)
 }
 
-// AddList add set of sentences to a list
-func (d *dataDataset) AddList(adataSentences []interface{}) {
+// AddList add set of sentences to a list, split into the chunks produced by the pre-tokenizer
+func (d *dataDataset) AddList(adataSentences []interface{}, pdNormalizer *normalize.Normalizer, sPreTokenizer string) {
 	for index := range adataSentences {
 		// Normalize the sentence
-		sentence := normalize.Normalize(adataSentences[index].(string))
+		sentence := pdNormalizer.Normalize(adataSentences[index].(string))
 
-		// Convert to unicode integers
-		var unicodePoints []int64
-		for _, r := range sentence {
-			unicodePoints = append(unicodePoints, int64(r))
+		// Convert every chunk to base units and add it to the list
+		for sChunk := range preTokenize(sPreTokenizer, sentence) {
+			d.add(toUnits(sChunk, d.unitID))
 		}
-
-		// Add to list
-		d.add(unicodePoints)
 	}
 }
 
@@ -149,13 +209,19 @@ func getVocabSize(dataset *dataDataset, mapTokenizer map[string]interface{}) (in
 		return -1, errors.New("Merges map type is incorrect")
 	}
 
-	return len(mapUniqueTokens) + len(mapMerges), nil
+	// special tokens are part of the vocabulary as well
+	iSpecialTokens := 0
+	if mapSpecialTokens, tfOK := mapTokenizer["special_tokens"].(map[string]interface{}); tfOK {
+		iSpecialTokens = len(mapSpecialTokens)
+	}
+
+	return len(mapUniqueTokens) + len(mapMerges) + iSpecialTokens, nil
 }
 
-// LoadMaps loads the merges map from the JSON file
-func LoadMaps() (map[string]interface{}, map[int64]string, error) {
+// LoadMaps loads the merges map from the JSON artifact
+func LoadMaps(sFilePath string) (map[string]interface{}, map[int64]string, error) {
 	// Read merges map from JSON file
-	pdFile, err := os.Open("artifacts/merges.json")
+	pdFile, err := os.Open(sFilePath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open merges file: %w", err)
 	}
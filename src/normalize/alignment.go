@@ -0,0 +1,99 @@
+package normalize
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Span is a half-open byte range [Start, End) of the original, un-normalized input
+type Span struct {
+	Start int
+	End   int
+}
+
+// Alignment maps every byte of a normalized string to the span of the original input that produced it
+type Alignment []Span
+
+// Span returns the original span covered by the normalized byte range [iStart, iEnd)
+func (a Alignment) Span(iStart int, iEnd int) Span {
+	if iStart >= iEnd {
+		if iStart < len(a) {
+			return Span{Start: a[iStart].Start, End: a[iStart].Start}
+		}
+		if len(a) > 0 {
+			return Span{Start: a[len(a)-1].End, End: a[len(a)-1].End}
+		}
+		return Span{}
+	}
+	return Span{Start: a[iStart].Start, End: a[iEnd-1].End}
+}
+
+// text is a string moving through the pipeline; aSpans is nil when offsets are not tracked
+type text struct {
+	sText  string
+	aSpans Alignment
+}
+
+// newText wraps an original input, optionally tracking where every byte came from
+func newText(sInput string, tfTrack bool) text {
+	if !tfTrack {
+		return text{sText: sInput}
+	}
+	aSpans := make(Alignment, len(sInput))
+	for iIndex := range aSpans {
+		aSpans[iIndex] = Span{Start: iIndex, End: iIndex + 1}
+	}
+	return text{sText: sInput, aSpans: aSpans}
+}
+
+// textBuilder produces the output of one pipeline step from its input
+type textBuilder struct {
+	dataInput text
+	dBuilder  strings.Builder
+	aSpans    Alignment
+}
+
+// newTextBuilder starts a step over the given input
+func newTextBuilder(dataInput text) *textBuilder {
+	pdBuilder := &textBuilder{dataInput: dataInput}
+	pdBuilder.dBuilder.Grow(len(dataInput.sText))
+	if dataInput.aSpans != nil {
+		pdBuilder.aSpans = make(Alignment, 0, len(dataInput.sText))
+	}
+	return pdBuilder
+}
+
+// write appends sOut as the replacement of the input byte range [iStart, iEnd)
+func (b *textBuilder) write(sOut string, iStart int, iEnd int) {
+	b.dBuilder.WriteString(sOut)
+	if b.dataInput.aSpans == nil {
+		return
+	}
+	dataSpan := b.dataInput.aSpans.Span(iStart, iEnd)
+	for range len(sOut) {
+		b.aSpans = append(b.aSpans, dataSpan)
+	}
+}
+
+// keep appends the input byte range [iStart, iEnd) unchanged
+func (b *textBuilder) keep(iStart int, iEnd int) {
+	b.dBuilder.WriteString(b.dataInput.sText[iStart:iEnd])
+	if b.dataInput.aSpans != nil {
+		b.aSpans = append(b.aSpans, b.dataInput.aSpans[iStart:iEnd]...)
+	}
+}
+
+// text returns the finished output of the step
+func (b *textBuilder) text() text {
+	dataOutput := text{sText: b.dBuilder.String(), aSpans: b.aSpans}
+	if b.dataInput.aSpans != nil && dataOutput.aSpans == nil {
+		dataOutput.aSpans = Alignment{}
+	}
+	return dataOutput
+}
+
+// runeWidth returns the number of bytes of the rune starting at iIndex, counting invalid bytes as one
+func runeWidth(sText string, iIndex int) int {
+	_, iSize := utf8.DecodeRuneInString(sText[iIndex:])
+	return iSize
+}
@@ -0,0 +1,132 @@
+package normalize
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Denormalizer is an incremental form of Denormalize for text that arrives in pieces. Marker state
+// carries over from one piece to the next and Jamo that may still compose into a syllable are held
+// back, so the concatenated output equals Denormalize on the concatenated input.
+type Denormalizer struct {
+	pdNormalizer *Normalizer
+	tfShift      bool
+	tfCapsLock   bool
+	tfStarted    bool
+	arJamo       []rune
+	dBuilder     strings.Builder
+}
+
+// NewDenormalizer starts an incremental denormalization
+func (n *Normalizer) NewDenormalizer() *Denormalizer {
+	return &Denormalizer{pdNormalizer: n}
+}
+
+// Write denormalizes the next piece of text and returns the output that is complete so far
+func (d *Denormalizer) Write(sText string) string {
+	for len(sText) > 0 {
+		r, iSize := utf8.DecodeRuneInString(sText)
+		if r == utf8.RuneError && iSize == 1 {
+			d.releaseJamo()
+			d.writeOutput(sText[:1])
+		} else {
+			d.replayMarker(r)
+		}
+		sText = sText[iSize:]
+	}
+	return d.take()
+}
+
+// Flush returns the output held back at the end of the text
+func (d *Denormalizer) Flush() string {
+	d.releaseJamo()
+	return d.take()
+}
+
+// replayMarker applies the case and emoji markers like replayMarkers, one rune at a time
+func (d *Denormalizer) replayMarker(r rune) {
+	dataConfig := d.pdNormalizer.dataConfig
+	if !dataConfig.CaseMarkers && !dataConfig.EmojiToken {
+		d.composeJamo(r)
+		return
+	}
+	switch {
+	case r == MarkerShift:
+		d.tfShift = true
+	case r == MarkerCapsLock:
+		d.tfCapsLock = true
+	case r == MarkerCapsEnd:
+		d.tfCapsLock = false
+	case r == MarkerEmoji:
+		for _, rEmoji := range EmojiTokenText {
+			d.composeJamo(rEmoji)
+		}
+		d.tfShift = false
+	case d.tfShift || d.tfCapsLock:
+		d.composeJamo(d.pdNormalizer.dataCase.ToUpper(r))
+		d.tfShift = false
+	default:
+		d.composeJamo(r)
+	}
+}
+
+// composeJamo recomposes Hangul syllables like composeHangul, holding a leading consonant and vowel
+// until the rune that decides whether they compose has arrived
+func (d *Denormalizer) composeJamo(r rune) {
+	if !d.pdNormalizer.dataConfig.HangulJamo {
+		d.writeRune(r)
+		return
+	}
+	if iVowel := r - runeVowelBase; len(d.arJamo) == 1 && iVowel >= 0 && iVowel < iVowelCount {
+		d.arJamo = append(d.arJamo, r)
+		return
+	}
+	if iTrailing := r - runeTrailingBase; len(d.arJamo) == 2 && iTrailing > 0 && iTrailing < iTrailingCount {
+		d.writeRune(composeSyllable(d.arJamo[0], d.arJamo[1], r))
+		d.arJamo = d.arJamo[:0]
+		return
+	}
+	d.releaseJamo()
+	if iLeading := r - runeLeadingBase; iLeading >= 0 && iLeading < iLeadingCount {
+		d.arJamo = append(d.arJamo, r)
+		return
+	}
+	d.writeRune(r)
+}
+
+// releaseJamo writes the Jamo held back, which no longer compose with what follows
+func (d *Denormalizer) releaseJamo() {
+	switch len(d.arJamo) {
+	case 1:
+		d.writeRune(d.arJamo[0])
+	case 2:
+		d.writeRune(composeSyllable(d.arJamo[0], d.arJamo[1], 0))
+	}
+	d.arJamo = d.arJamo[:0]
+}
+
+// writeRune restores spaces and drops the prefix space like the last steps of Denormalize
+func (d *Denormalizer) writeRune(r rune) {
+	if r == Metaspace && d.pdNormalizer.dataConfig.Whitespace == WhitespaceMetaspace {
+		r = ' '
+	}
+	d.writeOutput(string(r))
+}
+
+// writeOutput appends to the output, leaving out the space added in front of the text
+func (d *Denormalizer) writeOutput(sOutput string) {
+	if !d.tfStarted {
+		d.tfStarted = true
+		if d.pdNormalizer.dataConfig.AddPrefixSpace {
+			sOutput = strings.TrimPrefix(sOutput, " ")
+		}
+	}
+	d.dBuilder.WriteString(sOutput)
+}
+
+// take returns and clears the output written so far
+func (d *Denormalizer) take() string {
+	sOutput := d.dBuilder.String()
+	d.dBuilder.Reset()
+	return sOutput
+}
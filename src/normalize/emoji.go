@@ -0,0 +1,76 @@
+package normalize
+
+import (
+	"iter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// the Extended_Pictographic and Emoji_Presentation tables come from Unicode's emoji data
+//go:generate go run gen_emoji.go -version 15.0.0
+
+// Code points that turn a pictograph into an emoji sequence
+const (
+	runeZWJ          = '\u200D'
+	runeVS16         = '\uFE0F'
+	runeKeycap       = '\u20E3'
+	runeModifierLow  = '\U0001F3FB'
+	runeModifierHigh = '\U0001F3FF'
+	runeRegionalLow  = '\U0001F1E6'
+	runeRegionalHigh = '\U0001F1FF'
+)
+
+// emoji blocks of the original pipeline
+var emojiRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F300, Hi: 0x1F64F, Stride: 1},
+		{Lo: 0x1F680, Hi: 0x1F6FF, Stride: 1},
+		{Lo: 0x1F900, Hi: 0x1F9FF, Stride: 1},
+		{Lo: 0x1FA70, Hi: 0x1FAFF, Stride: 1},
+	},
+}
+
+// isRangeEmoji checks a code point against the emoji blocks and variation selectors the original
+// pipeline stripped
+func isRangeEmoji(r rune) bool {
+	return unicode.Is(emojiRanges, r) || unicode.Is(unicode.Variation_Selector, r)
+}
+
+// Graphemes iterates over the extended grapheme clusters (UAX #29) of a string
+func Graphemes(sText string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		iState := -1
+		var sCluster string
+		for len(sText) > 0 {
+			sCluster, sText, _, iState = uniseg.FirstGraphemeClusterInString(sText, iState)
+			if !yield(sCluster) {
+				return
+			}
+		}
+	}
+}
+
+// IsEmojiCluster reports whether an extended grapheme cluster is displayed as an emoji: flags,
+// keycaps, characters with emoji presentation, and pictographs turned into emoji by a variation
+// selector, a skin tone modifier or a ZWJ sequence. Text-style symbols such as © are not emoji.
+func IsEmojiCluster(sCluster string) bool {
+	rFirst, iSize := utf8.DecodeRuneInString(sCluster)
+	if (rFirst >= runeRegionalLow && rFirst <= runeRegionalHigh) || unicode.Is(emojiPresentation, rFirst) {
+		return true
+	}
+	tfPictographic := unicode.Is(extendedPictographic, rFirst)
+	for _, r := range sCluster[iSize:] {
+		switch {
+		case r == runeKeycap:
+			return true
+		case tfPictographic && (r == runeVS16 || r == runeZWJ || (r >= runeModifierLow && r <= runeModifierHigh)):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+//go:build ignore
+
+// gen_emoji writes emoji_tables.go from the emoji-data.txt of a Unicode version, downloaded from
+// unicode.org or read from a local copy:
+//
+//	go run gen_emoji.go -version 15.0.0
+//	go run gen_emoji.go -version 15.0.0 -input emoji-data.txt
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// properties written as tables, in file order
+var aProperties = []struct {
+	sVariable string
+	sProperty string
+}{
+	{"extendedPictographic", "Extended_Pictographic"},
+	{"emojiPresentation", "Emoji_Presentation"},
+}
+
+// codeRange is an inclusive range of code points
+type codeRange struct {
+	lLow  uint64
+	lHigh uint64
+}
+
+func main() {
+	psVersion := flag.String("version", "15.0.0", "Unicode version of the emoji data")
+	psInput := flag.String("input", "", "Local emoji-data.txt to read instead of downloading it")
+	psOutput := flag.String("output", "emoji_tables.go", "Go file to write")
+	flag.Parse()
+
+	sURL := "https://unicode.org/Public/" + *psVersion + "/ucd/emoji/emoji-data.txt"
+	abData, err := readData(sURL, *psInput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mapRanges, err := parseData(abData)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var dSource bytes.Buffer
+	fmt.Fprintf(&dSource, "// Code generated by gen_emoji.go from %s. DO NOT EDIT.\n\npackage normalize\n\nimport \"unicode\"\n", sURL)
+	for _, dataProperty := range aProperties {
+		aRanges := mapRanges[dataProperty.sProperty]
+		if len(aRanges) == 0 {
+			log.Fatalf("%s has no code points with the %s property", sURL, dataProperty.sProperty)
+		}
+		writeTable(&dSource, dataProperty.sVariable, dataProperty.sProperty, aRanges)
+	}
+	abSource, err := format.Source(dSource.Bytes())
+	if err != nil {
+		log.Fatalf("failed to format the tables: %v", err)
+	}
+	if err := os.WriteFile(*psOutput, abSource, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readData reads a local copy of the emoji data, or downloads it
+func readData(sURL string, sInput string) ([]byte, error) {
+	if sInput != "" {
+		return os.ReadFile(sInput)
+	}
+	pdResponse, err := http.Get(sURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", sURL, err)
+	}
+	defer pdResponse.Body.Close()
+	if pdResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", sURL, pdResponse.Status)
+	}
+	return io.ReadAll(pdResponse.Body)
+}
+
+// parseData collects the code point ranges of every property, sorted and with adjacent ranges joined
+func parseData(abData []byte) (map[string][]codeRange, error) {
+	mapRanges := make(map[string][]codeRange)
+	pdScanner := bufio.NewScanner(bytes.NewReader(abData))
+	for iLine := 1; pdScanner.Scan(); iLine++ {
+		sLine, _, _ := strings.Cut(pdScanner.Text(), "#")
+		if strings.TrimSpace(sLine) == "" {
+			continue
+		}
+		sCodes, sProperty, tfOK := strings.Cut(sLine, ";")
+		if !tfOK {
+			return nil, fmt.Errorf("line %d: no property", iLine)
+		}
+		sLow, sHigh, tfRange := strings.Cut(strings.TrimSpace(sCodes), "..")
+		if !tfRange {
+			sHigh = sLow
+		}
+		lLow, errLow := strconv.ParseUint(sLow, 16, 32)
+		lHigh, errHigh := strconv.ParseUint(sHigh, 16, 32)
+		if errLow != nil || errHigh != nil || lLow > lHigh || lHigh > unicode.MaxRune {
+			return nil, fmt.Errorf("line %d: invalid code points %q", iLine, strings.TrimSpace(sCodes))
+		}
+		sProperty = strings.TrimSpace(sProperty)
+		mapRanges[sProperty] = append(mapRanges[sProperty], codeRange{lLow, lHigh})
+	}
+	if err := pdScanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for sProperty, aRanges := range mapRanges {
+		slices.SortFunc(aRanges, func(dataA codeRange, dataB codeRange) int {
+			return cmp.Compare(dataA.lLow, dataB.lLow)
+		})
+		aJoined := aRanges[:1]
+		for _, dataRange := range aRanges[1:] {
+			if pdLast := &aJoined[len(aJoined)-1]; dataRange.lLow <= pdLast.lHigh+1 {
+				pdLast.lHigh = max(pdLast.lHigh, dataRange.lHigh)
+			} else {
+				aJoined = append(aJoined, dataRange)
+			}
+		}
+		mapRanges[sProperty] = aJoined
+	}
+	return mapRanges, nil
+}
+
+// writeTable writes the ranges of a property as a unicode.RangeTable, splitting them at U+FFFF
+func writeTable(dSource *bytes.Buffer, sVariable string, sProperty string, aRanges []codeRange) {
+	var a16, a32 []codeRange
+	for _, dataRange := range aRanges {
+		if dataRange.lLow <= 0xFFFF {
+			a16 = append(a16, codeRange{dataRange.lLow, min(dataRange.lHigh, 0xFFFF)})
+		}
+		if dataRange.lHigh > 0xFFFF {
+			a32 = append(a32, codeRange{max(dataRange.lLow, 0x10000), dataRange.lHigh})
+		}
+	}
+
+	fmt.Fprintf(dSource, "\n// %s holds the code points with the %s property\nvar %s = &unicode.RangeTable{\n", sVariable, sProperty, sVariable)
+	iLatinOffset := 0
+	if len(a16) > 0 {
+		dSource.WriteString("R16: []unicode.Range16{\n")
+		for _, dataRange := range a16 {
+			fmt.Fprintf(dSource, "{Lo: 0x%04x, Hi: 0x%04x, Stride: 1},\n", dataRange.lLow, dataRange.lHigh)
+			if dataRange.lHigh <= unicode.MaxLatin1 {
+				iLatinOffset++
+			}
+		}
+		dSource.WriteString("},\n")
+	}
+	if len(a32) > 0 {
+		dSource.WriteString("R32: []unicode.Range32{\n")
+		for _, dataRange := range a32 {
+			fmt.Fprintf(dSource, "{Lo: 0x%04x, Hi: 0x%04x, Stride: 1},\n", dataRange.lLow, dataRange.lHigh)
+		}
+		dSource.WriteString("},\n")
+	}
+	if iLatinOffset > 0 {
+		fmt.Fprintf(dSource, "LatinOffset: %d,\n", iLatinOffset)
+	}
+	dSource.WriteString("}\n")
+}
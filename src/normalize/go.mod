@@ -2,4 +2,7 @@ module normalize
 
 go 1.24.2
 
-require golang.org/x/text v0.23.0
+require (
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/text v0.23.0
+)
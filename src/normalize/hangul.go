@@ -0,0 +1,99 @@
+package normalize
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Constants of the algorithmic Hangul syllable composition (Unicode chapter 3.12)
+const (
+	runeSyllableBase = 0xAC00
+	runeLeadingBase  = 0x1100
+	runeVowelBase    = 0x1161
+	runeTrailingBase = 0x11A7
+	iLeadingCount    = 19
+	iVowelCount      = 21
+	iTrailingCount   = 28
+	iSyllableCount   = iLeadingCount * iVowelCount * iTrailingCount
+)
+
+// check for a precomposed Hangul syllable
+func isHangulSyllable(r rune) bool {
+	return r >= runeSyllableBase && r < runeSyllableBase+iSyllableCount
+}
+
+// decomposeSyllable spells a precomposed syllable as its leading consonant, vowel and optional trailing consonant
+func decomposeSyllable(r rune) string {
+	iIndex := int(r - runeSyllableBase)
+	arJamo := []rune{
+		runeLeadingBase + rune(iIndex/(iVowelCount*iTrailingCount)),
+		runeVowelBase + rune(iIndex%(iVowelCount*iTrailingCount)/iTrailingCount),
+	}
+	if iTrailing := iIndex % iTrailingCount; iTrailing > 0 {
+		arJamo = append(arJamo, runeTrailingBase+rune(iTrailing))
+	}
+	return string(arJamo)
+}
+
+// Decompose Hangul syllables into conjoining Jamo so syllables share their sub-syllable units
+func (n *Normalizer) decomposeHangul(dataText text) text {
+	if !n.dataConfig.HangulJamo {
+		return dataText
+	}
+	if !strings.ContainsFunc(dataText.sText, isHangulSyllable) {
+		return dataText
+	}
+	pdBuilder := newTextBuilder(dataText)
+	iLast := 0
+	for iIndex, r := range dataText.sText {
+		if isHangulSyllable(r) {
+			pdBuilder.keep(iLast, iIndex)
+			iLast = iIndex + utf8.RuneLen(r)
+			pdBuilder.write(decomposeSyllable(r), iIndex, iLast)
+		}
+	}
+	pdBuilder.keep(iLast, len(dataText.sText))
+	return pdBuilder.text()
+}
+
+// composeHangul recomposes leading consonant + vowel (+ trailing consonant) Jamo sequences into
+// syllables, leaving every other character as it is
+func composeHangul(sText string) string {
+	var dBuilder strings.Builder
+	dBuilder.Grow(len(sText))
+	arText := []rune(sText)
+	for iIndex := 0; iIndex < len(arText); iIndex++ {
+		r := arText[iIndex]
+		iLeading := int(r - runeLeadingBase)
+		if iLeading < 0 || iLeading >= iLeadingCount || iIndex+1 >= len(arText) {
+			dBuilder.WriteRune(r)
+			continue
+		}
+		iVowel := int(arText[iIndex+1] - runeVowelBase)
+		if iVowel < 0 || iVowel >= iVowelCount {
+			dBuilder.WriteRune(r)
+			continue
+		}
+		iIndex++
+
+		// a trailing consonant is optional
+		iTrailing := 0
+		if iIndex+1 < len(arText) {
+			if iNext := int(arText[iIndex+1] - runeTrailingBase); iNext > 0 && iNext < iTrailingCount {
+				iTrailing = iNext
+				iIndex++
+			}
+		}
+		dBuilder.WriteRune(runeSyllableBase + rune((iLeading*iVowelCount+iVowel)*iTrailingCount+iTrailing))
+	}
+	return dBuilder.String()
+}
+
+// composeSyllable combines a leading consonant, a vowel and a trailing consonant, or 0 for none, into a syllable
+func composeSyllable(rLeading rune, rVowel rune, rTrailing rune) rune {
+	iTrailing := rune(0)
+	if rTrailing != 0 {
+		iTrailing = rTrailing - runeTrailingBase
+	}
+	return runeSyllableBase + ((rLeading-runeLeadingBase)*iVowelCount+rVowel-runeVowelBase)*iTrailingCount + iTrailing
+}
@@ -0,0 +1,63 @@
+package normalize
+
+import (
+	"testing"
+)
+
+// TestHangulJamo checks the Jamo spelling of syllables, that only the Jamo mode applies it, and
+// that Denormalize composes exactly the sequences that spell a syllable
+func TestHangulJamo(t *testing.T) {
+	pdJamo := MustNew(Config{Form: FormNFC, Whitespace: WhitespacePreserve, HangulJamo: true})
+	for _, dataCase := range []struct {
+		sName   string
+		sInput  string
+		sOutput string
+	}{
+		{"open syllable", "가", "\u1100\u1161"},
+		{"closed syllable", "각", "\u1100\u1161\u11a8"},
+		{"word with other text", "한국어 text", "\u1112\u1161\u11ab\u1100\u116e\u11a8\u110b\u1165 text"},
+		{"compatibility jamo kept", "ㄱㅏ", "ㄱㅏ"},
+		{"last syllable", "힣", "\u1112\u1175\u11c2"},
+	} {
+		sOutput := pdJamo.Normalize(dataCase.sInput)
+		if sOutput != dataCase.sOutput {
+			t.Errorf("%s: %q normalizes to %q, want %q", dataCase.sName, dataCase.sInput, sOutput, dataCase.sOutput)
+		}
+		if sText := pdJamo.Denormalize(sOutput); sText != dataCase.sInput {
+			t.Errorf("%s: %q comes back as %q", dataCase.sName, dataCase.sInput, sText)
+		}
+	}
+	if sOutput := MustNew(Config{Form: FormNFC, Whitespace: WhitespacePreserve}).Normalize("한국어"); sOutput != "한국어" {
+		t.Errorf("syllables are decomposed without the Jamo mode: %q", sOutput)
+	}
+
+	// every syllable comes back, at once and one rune at a time
+	for r := rune(runeSyllableBase); r < runeSyllableBase+iSyllableCount; r++ {
+		sJamo := pdJamo.Normalize(string(r))
+		if sText := pdJamo.Denormalize(sJamo); sText != string(r) {
+			t.Fatalf("%U comes back as %q", r, sText)
+		}
+		pdDenormalizer := pdJamo.NewDenormalizer()
+		sText := ""
+		for _, rJamo := range sJamo {
+			sText += pdDenormalizer.Write(string(rJamo))
+		}
+		if sText += pdDenormalizer.Flush(); sText != string(r) {
+			t.Fatalf("%U comes back one Jamo at a time as %q", r, sText)
+		}
+	}
+
+	// only a leading consonant followed by a vowel starts a syllable
+	for _, dataCase := range [][2]string{
+		{"\u1100", "\u1100"},
+		{"\u1100\u1100\u1161", "\u1100가"},
+		{"\u1161\u11a8", "\u1161\u11a8"},
+		{"\u1100\u11a8", "\u1100\u11a8"},
+		{"\u1100 \u1161", "\u1100 \u1161"},
+		{"\u1100\u1161\u11a8\u11a8", "각\u11a8"},
+	} {
+		if sText := pdJamo.Denormalize(dataCase[0]); sText != dataCase[1] {
+			t.Errorf("%q composes to %q, want %q", dataCase[0], sText, dataCase[1])
+		}
+	}
+}
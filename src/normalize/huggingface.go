@@ -0,0 +1,152 @@
+package normalize
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// map normalization forms to the normalizers of Hugging Face tokenizers
+var mapHuggingFaceForms = map[string]string{
+	FormNFC:  "NFC",
+	FormNFD:  "NFD",
+	FormNFKC: "NFKC",
+	FormNFKD: "NFKD",
+}
+
+// HuggingFace translates the pipeline into the normalizers of a Hugging Face tokenizer.json, in
+// the order the pipeline runs them. Regular expressions are written for the Oniguruma engine of
+// tokenizers. Settings without an exact counterpart are reported as errors, all at once.
+func (c Config) HuggingFace() ([]map[string]interface{}, error) {
+	var aErrors []error
+	if c.CaseMarkers {
+		aErrors = append(aErrors, errors.New("case_markers: tokenizers has no normalizer that marks case"))
+	}
+	if c.StripControl && !c.StripEmoji && !c.EmojiToken {
+		aErrors = append(aErrors, errors.New("strip_control: cannot keep the joiners and tags of kept emoji while stripping them elsewhere"))
+	}
+	if len(c.Scripts) > 0 {
+		aErrors = append(aErrors, errors.New("scripts: the script rules have no tokenizers counterpart"))
+	}
+	if c.HangulJamo && c.Form != FormNFD && c.Form != FormNFKD {
+		aErrors = append(aErrors, errors.New("hangul_jamo: only exported with the nfd or nfkd form, which already decompose syllables"))
+	}
+	for iIndex, dataReplacement := range c.Replacements {
+		if dataReplacement.Regex && strings.Contains(dataReplacement.Replacement, "$") {
+			aErrors = append(aErrors, fmt.Errorf("replacements[%d]: tokenizers inserts replacements literally, without group references", iIndex))
+		}
+	}
+	if err := errors.Join(aErrors...); err != nil {
+		return nil, err
+	}
+
+	// character stripping: literal emoji markers go first so the ones standing in for emoji stay
+	aSteps := []map[string]interface{}{}
+	if c.EmojiToken {
+		aSteps = append(aSteps, replaceStep("String", string(MarkerEmoji), ""))
+	}
+	if c.EmojiRanges {
+		aSteps = append(aSteps, replaceStep("Regex", `[`+onigRanges(emojiRanges)+onigRanges(unicode.Variation_Selector)+`]`, ""))
+	} else if c.StripEmoji || c.EmojiToken {
+		sContent := ""
+		if c.EmojiToken {
+			sContent = string(MarkerEmoji)
+		}
+		aSteps = append(aSteps, replaceStep("Regex", emojiPattern(), sContent))
+	}
+	if c.StripControl {
+		// everything that is neither printable nor whitespace, as unicode.IsPrint and unicode.IsSpace see it
+		sExcluded := `\x{9}-\x{D}\x{85}`
+		if c.EmojiToken {
+			sExcluded += onigRune(MarkerEmoji)
+		}
+		aSteps = append(aSteps, replaceStep("Regex", `[^\P{C}`+sExcluded+`]`, ""))
+	}
+
+	// replacement rules and the unicode form
+	for _, dataReplacement := range c.Replacements {
+		sType := "String"
+		if dataReplacement.Regex {
+			sType = "Regex"
+		}
+		aSteps = append(aSteps, replaceStep(sType, dataReplacement.Pattern, dataReplacement.Replacement))
+	}
+	if sForm, tfOK := mapHuggingFaceForms[c.Form]; tfOK {
+		aSteps = append(aSteps, map[string]interface{}{"type": sForm})
+	}
+
+	// tokenizers lowercases İ to i and a combining dot, Go to a plain i; the Turkic locales also
+	// lowercase I to a dotless ı
+	if c.Lowercase {
+		aSteps = append(aSteps, replaceStep("String", "İ", "i"))
+		if mapLocaleCases[c.Locale] != nil {
+			aSteps = append(aSteps, replaceStep("String", "I", "ı"))
+		}
+		aSteps = append(aSteps, map[string]interface{}{"type": "Lowercase"})
+	}
+
+	// whitespace: Go's \s only matches ASCII whitespace other than \v
+	if c.Whitespace == WhitespaceCollapse {
+		aSteps = append(aSteps, replaceStep("Regex", `[\t\n\f\r ]+`, " "))
+	}
+	if c.AddPrefixSpace {
+		aSteps = append(aSteps, map[string]interface{}{"type": "Prepend", "prepend": " "})
+	}
+	if c.Whitespace == WhitespaceMetaspace {
+		aSteps = append(aSteps, replaceStep("String", " ", string(Metaspace)))
+	}
+	return aSteps, nil
+}
+
+// replaceStep builds a Replace normalizer for a String or Regex pattern
+func replaceStep(sType string, sPattern string, sContent string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "Replace",
+		"pattern": map[string]string{sType: sPattern},
+		"content": sContent,
+	}
+}
+
+// emojiPattern matches the grapheme clusters IsEmojiCluster accepts: clusters starting with a
+// regional indicator or an emoji presentation character, pictographs followed within their cluster
+// by a variation selector, a joiner or a skin tone modifier, and keycaps
+func emojiPattern() string {
+	sExtend := `[\p{M}\p{Cf}` + onigRune(runeModifierLow) + `-` + onigRune(runeModifierHigh) + `]*`
+	sTrigger := `[` + onigRune(runeVS16) + onigRune(runeZWJ) + onigRune(runeModifierLow) + `-` + onigRune(runeModifierHigh) + `]`
+	asAlternatives := []string{
+		`(?=[` + onigRune(runeRegionalLow) + `-` + onigRune(runeRegionalHigh) + onigRanges(emojiPresentation) + `])\X`,
+		`(?=[` + onigRanges(extendedPictographic) + `]` + sExtend + sTrigger + `)\X`,
+		`(?=\P{Cc}` + sExtend + onigRune(runeKeycap) + `)\X`,
+	}
+	return strings.Join(asAlternatives, "|")
+}
+
+// onigRanges spells the ranges of a table for an Oniguruma character class
+func onigRanges(pdTable *unicode.RangeTable) string {
+	var dBuilder strings.Builder
+	fnRange := func(rLow rune, rHigh rune, rStride rune) {
+		if rStride != 1 {
+			for r := rLow; r <= rHigh; r += rStride {
+				dBuilder.WriteString(onigRune(r))
+			}
+			return
+		}
+		dBuilder.WriteString(onigRune(rLow))
+		if rHigh > rLow {
+			dBuilder.WriteString("-" + onigRune(rHigh))
+		}
+	}
+	for _, dataRange := range pdTable.R16 {
+		fnRange(rune(dataRange.Lo), rune(dataRange.Hi), rune(dataRange.Stride))
+	}
+	for _, dataRange := range pdTable.R32 {
+		fnRange(rune(dataRange.Lo), rune(dataRange.Hi), rune(dataRange.Stride))
+	}
+	return dBuilder.String()
+}
+
+// onigRune escapes a code point for an Oniguruma pattern
+func onigRune(r rune) string {
+	return fmt.Sprintf(`\x{%X}`, r)
+}
@@ -4,49 +4,520 @@ package normalize
 import (
 	"golang.org/x/text/unicode/norm"
 
+	"errors"
+	"fmt"
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Regex to match whitespace
 var pdRegex = regexp.MustCompile(`\s+`)
 
-// check for emoji
-func isEmoji(r rune) bool {
-	// Rough filter for common emoji ranges (can be expanded)
-	return (r >= 0x1F600 && r <= 0x1F64F) || // Emoticons
-		(r >= 0x1F300 && r <= 0x1F5FF) || // Misc Symbols and Pictographs
-		(r >= 0x1F680 && r <= 0x1F6FF) || // Transport & Map
-		(r >= 0x2600 && r <= 0x26FF) || // Misc symbols
-		(r >= 0x2700 && r <= 0x27BF) || // Dingbats
-		(r >= 0x1F900 && r <= 0x1F9FF) || // Supplemental Symbols and Pictographs
-		(r >= 0x1FA70 && r <= 0x1FAFF) || // Symbols and Pictographs Extended-A
-		unicode.Is(unicode.Variation_Selector, r) // Skin tone modifiers etc.
-}
-
-// Remove some characters that we do not want to parse (control chars, emojis, etc.)
-func removeChars(sText string) string {
-	var dBuilder strings.Builder
-	for _, r := range sText {
-		if (unicode.IsPrint(r) || unicode.IsSpace(r)) && !isEmoji(r) {
-			dBuilder.WriteRune(r)
+// Supported unicode normalization forms
+const (
+	FormNone = "none"
+	FormNFC  = "nfc"
+	FormNFD  = "nfd"
+	FormNFKC = "nfkc"
+	FormNFKD = "nfkd"
+)
+
+// Supported whitespace policies
+const (
+	WhitespacePreserve  = "preserve"
+	WhitespaceCollapse  = "collapse"
+	WhitespaceMetaspace = "metaspace"
+)
+
+// Metaspace stands in for the space character under the metaspace policy, as in SentencePiece
+const Metaspace = '\u2581'
+
+// Marker characters inserted by the case-preserving and emoji-token modes. They sit in the Private Use Area so they
+// become base symbols of their own and can be merged like any other character.
+const (
+	MarkerShift    = '\uE000' // the next letter is uppercase
+	MarkerCapsLock = '\uE001' // the following letters are uppercase until MarkerCapsEnd
+	MarkerCapsEnd  = '\uE002'
+	MarkerEmoji    = '\uE003' // stands in for any emoji when EmojiToken is set
+)
+
+// EmojiTokenText is what MarkerEmoji decodes to
+const EmojiTokenText = "<emoji>"
+
+// map configuration names to normalization forms
+var mapForms = map[string]norm.Form{
+	FormNFC:  norm.NFC,
+	FormNFD:  norm.NFD,
+	FormNFKC: norm.NFKC,
+	FormNFKD: norm.NFKD,
+}
+
+// Config describes the normalization pipeline. The steps run in the order: character stripping,
+// replacement rules, unicode normalization, script rules, Hangul decomposition, case handling and
+// whitespace handling.
+// CaseMarkers folds case like Lowercase but records it with marker characters so Denormalize can
+// restore the original casing exactly. EmojiToken replaces every emoji with the shared MarkerEmoji
+// instead of removing it. EmojiRanges strips emoji as the original pipeline did, every code point of
+// the classic emoji blocks and every variation selector on its own, rather than as grapheme
+// clusters found with the Unicode emoji properties. Scripts enables opt-in rule sets for individual writing systems and
+// Locale selects language-specific case mappings such as the Turkish dotted and dotless i, or marks
+// the text as Vietnamese for the vietnamese rules.
+// Whitespace is preserved exactly, collapsed to single spaces, or kept with every space written as
+// Metaspace; AddPrefixSpace puts a space in front of the text so the first word looks like the rest.
+// HangulJamo spells Hangul syllables as conjoining Jamo, which Denormalize composes again.
+type Config struct {
+	Form           string        `json:"form"`
+	Lowercase      bool          `json:"lowercase"`
+	CaseMarkers    bool          `json:"case_markers,omitempty"`
+	StripEmoji     bool          `json:"strip_emoji"`
+	EmojiToken     bool          `json:"emoji_token,omitempty"`
+	EmojiRanges    bool          `json:"emoji_ranges,omitempty"`
+	StripControl   bool          `json:"strip_control"`
+	Whitespace     string        `json:"whitespace"`
+	AddPrefixSpace bool          `json:"add_prefix_space,omitempty"`
+	Replacements   []Replacement `json:"replacements,omitempty"`
+	Scripts        []string      `json:"scripts,omitempty"`
+	Locale         string        `json:"locale,omitempty"`
+	HangulJamo     bool          `json:"hangul_jamo,omitempty"`
+}
+
+// Replacement rewrites every match of Pattern with Replacement. Patterns are literal strings
+// unless Regex is set, in which case Replacement may reference groups as $1.
+type Replacement struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Regex       bool   `json:"regex,omitempty"`
+}
+
+// Normalizer applies a validated Config; it is safe for concurrent use
+type Normalizer struct {
+	dataConfig      Config
+	pdForm          *norm.Form
+	apdReplacements []*regexp.Regexp
+	dataCase        unicode.SpecialCase
+}
+
+// DefaultConfig returns the original pipeline: strip emoji by their code point ranges and control
+// characters, NFKC and lowercase
+func DefaultConfig() Config {
+	return Config{
+		Form:         FormNFKC,
+		Lowercase:    true,
+		StripEmoji:   true,
+		EmojiRanges:  true,
+		StripControl: true,
+		Whitespace:   WhitespacePreserve,
+	}
+}
+
+// default normalizer shared by the package level helpers
+var pdDefault = MustNew(DefaultConfig())
+
+// Default returns the normalizer built from DefaultConfig
+func Default() *Normalizer {
+	return pdDefault
+}
+
+// Validate checks the configuration and reports every problem it finds at once
+func (c Config) Validate() error {
+	var aErrors []error
+	if _, tfOK := mapForms[c.Form]; !tfOK && c.Form != FormNone {
+		aErrors = append(aErrors, fmt.Errorf("form: unknown form %q (expected one of none, nfc, nfd, nfkc, nfkd)", c.Form))
+	}
+	if c.Lowercase && c.CaseMarkers {
+		aErrors = append(aErrors, errors.New("case_markers: cannot be combined with lowercase"))
+	}
+	if c.StripEmoji && c.EmojiToken {
+		aErrors = append(aErrors, errors.New("emoji_token: cannot be combined with strip_emoji"))
+	}
+	if c.EmojiRanges && !c.StripEmoji {
+		aErrors = append(aErrors, errors.New("emoji_ranges: only applies with strip_emoji"))
+	}
+	if c.Whitespace != WhitespacePreserve && c.Whitespace != WhitespaceCollapse && c.Whitespace != WhitespaceMetaspace {
+		aErrors = append(aErrors, fmt.Errorf("whitespace: unknown policy %q (expected %q, %q or %q)", c.Whitespace, WhitespacePreserve, WhitespaceCollapse, WhitespaceMetaspace))
+	}
+	for iIndex, dataReplacement := range c.Replacements {
+		if dataReplacement.Pattern == "" {
+			aErrors = append(aErrors, fmt.Errorf("replacements[%d]: pattern must not be empty", iIndex))
+			continue
+		}
+		if dataReplacement.Regex {
+			if _, err := regexp.Compile(dataReplacement.Pattern); err != nil {
+				aErrors = append(aErrors, fmt.Errorf("replacements[%d]: %w", iIndex, err))
+			}
 		}
 	}
-	return dBuilder.String()
+	for iIndex, sScript := range c.Scripts {
+		if _, tfOK := mapScriptRules[sScript]; !tfOK {
+			aErrors = append(aErrors, fmt.Errorf("scripts[%d]: unknown rule set %q (expected one of arabic, hebrew, thai, bengali, cjk, vietnamese)", iIndex, sScript))
+		}
+	}
+	if _, tfOK := mapLocaleCases[c.Locale]; !tfOK && c.Locale != "" {
+		aErrors = append(aErrors, fmt.Errorf("locale: unsupported locale %q (expected tr, az, vi or empty)", c.Locale))
+	}
+	return errors.Join(aErrors...)
+}
+
+// New builds a normalizer from a configuration
+func New(dataConfig Config) (*Normalizer, error) {
+	if err := dataConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	// resolve the unicode form
+	pdNormalizer := &Normalizer{dataConfig: dataConfig}
+	if dataForm, tfOK := mapForms[dataConfig.Form]; tfOK {
+		pdNormalizer.pdForm = &dataForm
+	}
+	pdNormalizer.dataCase = mapLocaleCases[dataConfig.Locale]
+
+	// compile replacement rules, quoting literal patterns
+	for _, dataReplacement := range dataConfig.Replacements {
+		sPattern := dataReplacement.Pattern
+		if !dataReplacement.Regex {
+			sPattern = regexp.QuoteMeta(sPattern)
+		}
+		pdNormalizer.apdReplacements = append(pdNormalizer.apdReplacements, regexp.MustCompile(sPattern))
+	}
+
+	return pdNormalizer, nil
+}
+
+// MustNew is like New but panics if the configuration is invalid
+func MustNew(dataConfig Config) *Normalizer {
+	pdNormalizer, err := New(dataConfig)
+	if err != nil {
+		panic(err)
+	}
+	return pdNormalizer
+}
+
+// Config returns the configuration the normalizer was built from
+func (n *Normalizer) Config() Config {
+	return n.dataConfig
+}
+
+// Remove some characters that we do not want to parse (control chars, emojis, etc.). Emoji are
+// handled as whole grapheme clusters so ZWJ sequences, flags and skin tones go away together or
+// become a single MarkerEmoji.
+func (n *Normalizer) removeChars(dataText text) text {
+	if !n.dataConfig.StripControl && !n.dataConfig.StripEmoji && !n.dataConfig.EmojiToken {
+		return dataText
+	}
+	pdBuilder := newTextBuilder(dataText)
+	if n.dataConfig.EmojiRanges {
+		return n.removeRanges(dataText, pdBuilder)
+	}
+	iClusterStart := 0
+	for sCluster := range Graphemes(dataText.sText) {
+		// emoji are kept whole so control stripping does not break their ZWJ and tag characters
+		iClusterEnd := iClusterStart + len(sCluster)
+		if IsEmojiCluster(sCluster) {
+			if n.dataConfig.EmojiToken {
+				pdBuilder.write(string(MarkerEmoji), iClusterStart, iClusterEnd)
+			} else if !n.dataConfig.StripEmoji {
+				pdBuilder.keep(iClusterStart, iClusterEnd)
+			}
+			iClusterStart = iClusterEnd
+			continue
+		}
+
+		// filter the characters of everything else one by one
+		for iPosition, r := range sCluster {
+			iIndex := iClusterStart + iPosition
+			if n.dataConfig.StripControl && !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+				continue
+			}
+			if n.dataConfig.EmojiToken && r == MarkerEmoji {
+				continue
+			}
+			iSize := runeWidth(dataText.sText, iIndex)
+			if r == utf8.RuneError && iSize == 1 {
+				pdBuilder.write(string(r), iIndex, iIndex+iSize)
+			} else {
+				pdBuilder.keep(iIndex, iIndex+iSize)
+			}
+		}
+		iClusterStart = iClusterEnd
+	}
+	return pdBuilder.text()
+}
+
+// removeRanges strips emoji one code point at a time by the ranges of the original pipeline
+func (n *Normalizer) removeRanges(dataText text, pdBuilder *textBuilder) text {
+	for iIndex, r := range dataText.sText {
+		if isRangeEmoji(r) || (n.dataConfig.StripControl && !unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			continue
+		}
+		iSize := runeWidth(dataText.sText, iIndex)
+		if r == utf8.RuneError && iSize == 1 {
+			pdBuilder.write(string(r), iIndex, iIndex+iSize)
+		} else {
+			pdBuilder.keep(iIndex, iIndex+iSize)
+		}
+	}
+	return pdBuilder.text()
+}
+
+// Apply the custom replacement rules in order
+func (n *Normalizer) replace(dataText text) text {
+	for iIndex, pdPattern := range n.apdReplacements {
+		dataReplacement := n.dataConfig.Replacements[iIndex]
+		aaiMatches := pdPattern.FindAllStringSubmatchIndex(dataText.sText, -1)
+		if len(aaiMatches) == 0 {
+			continue
+		}
+
+		// every match maps onto the span it replaced
+		pdBuilder := newTextBuilder(dataText)
+		iLast := 0
+		for _, aiMatch := range aaiMatches {
+			pdBuilder.keep(iLast, aiMatch[0])
+			sReplacement := dataReplacement.Replacement
+			if dataReplacement.Regex {
+				sReplacement = string(pdPattern.ExpandString(nil, sReplacement, dataText.sText, aiMatch))
+			}
+			pdBuilder.write(sReplacement, aiMatch[0], aiMatch[1])
+			iLast = aiMatch[1]
+		}
+		pdBuilder.keep(iLast, len(dataText.sText))
+		dataText = pdBuilder.text()
+	}
+	return dataText
 }
 
 // Normalize Unicode characters
-func normalizeUnicode(sText string) string {
-	return norm.NFKC.String(sText)
+func (n *Normalizer) normalizeUnicode(dataText text) text {
+	if n.pdForm == nil {
+		return dataText
+	}
+	if dataText.aSpans == nil {
+		return text{sText: n.pdForm.String(dataText.sText)}
+	}
+
+	// normalize segment by segment so each output maps onto the segment it came from
+	pdBuilder := newTextBuilder(dataText)
+	iStart := 0
+	for iStart < len(dataText.sText) {
+		iEnd := iStart + n.pdForm.NextBoundaryInString(dataText.sText[iStart:], true)
+		pdBuilder.write(n.pdForm.String(dataText.sText[iStart:iEnd]), iStart, iEnd)
+		iStart = iEnd
+	}
+	return pdBuilder.text()
 }
 
-// Normalize
-func Normalize(sText string) string {
+// Lowercase every character
+func (n *Normalizer) lowercase(dataText text) text {
+	if n.dataConfig.CaseMarkers {
+		return n.markCase(dataText)
+	}
+	if !n.dataConfig.Lowercase {
+		return dataText
+	}
+	if dataText.aSpans == nil {
+		if n.dataCase != nil {
+			return text{sText: strings.ToLowerSpecial(n.dataCase, dataText.sText)}
+		}
+		return text{sText: strings.ToLower(dataText.sText)}
+	}
+	pdBuilder := newTextBuilder(dataText)
+	for iIndex, r := range dataText.sText {
+		pdBuilder.write(string(n.dataCase.ToLower(r)), iIndex, iIndex+runeWidth(dataText.sText, iIndex))
+	}
+	return pdBuilder.text()
+}
+
+// check if a letter is uppercase and lowercasing it can be undone exactly
+func isFoldableUpper(dataCase unicode.SpecialCase, r rune) bool {
+	rLower := dataCase.ToLower(r)
+	return rLower != r && dataCase.ToUpper(rLower) == r
+}
+
+// check for the marker characters
+func isMarker(r rune) bool {
+	return r == MarkerShift || r == MarkerCapsLock || r == MarkerCapsEnd
+}
+
+// Lowercase every character, marking single capitals with MarkerShift and runs of capitals with
+// MarkerCapsLock ... MarkerCapsEnd. Marker characters already in the input are dropped.
+func (n *Normalizer) markCase(dataText text) text {
+	pdBuilder := newTextBuilder(dataText)
+	sText := dataText.sText
+	iIndex := 0
+	for iIndex < len(sText) {
+		r, iSize := utf8.DecodeRuneInString(sText[iIndex:])
+		if isMarker(r) {
+			iIndex += iSize
+			continue
+		}
+		if !isFoldableUpper(n.dataCase, r) {
+			pdBuilder.write(string(r), iIndex, iIndex+iSize)
+			iIndex += iSize
+			continue
+		}
+
+		// find the run of capitals starting here
+		iEnd := iIndex + iSize
+		iCount := 1
+		for iEnd < len(sText) {
+			rNext, iNextSize := utf8.DecodeRuneInString(sText[iEnd:])
+			if !isFoldableUpper(n.dataCase, rNext) {
+				break
+			}
+			iEnd += iNextSize
+			iCount++
+		}
+
+		// a single capital gets a shift marker, longer runs are bracketed
+		if iCount == 1 {
+			pdBuilder.write(string(MarkerShift)+string(n.dataCase.ToLower(r)), iIndex, iEnd)
+		} else {
+			pdBuilder.write(string(MarkerCapsLock), iIndex, iIndex)
+			for iPosition, rUpper := range sText[iIndex:iEnd] {
+				iStart := iIndex + iPosition
+				pdBuilder.write(string(n.dataCase.ToLower(rUpper)), iStart, iStart+utf8.RuneLen(rUpper))
+			}
+			pdBuilder.write(string(MarkerCapsEnd), iEnd, iEnd)
+		}
+		iIndex = iEnd
+	}
+	return pdBuilder.text()
+}
+
+// Apply the whitespace policy and the prefix space
+func (n *Normalizer) normalizeWhitespace(dataText text) text {
+	if n.dataConfig.Whitespace == WhitespaceCollapse {
+		dataText = collapseWhitespace(dataText)
+	}
+	if n.dataConfig.AddPrefixSpace && dataText.sText != "" {
+		pdBuilder := newTextBuilder(dataText)
+		pdBuilder.write(" ", 0, 0)
+		pdBuilder.keep(0, len(dataText.sText))
+		dataText = pdBuilder.text()
+	}
+	if n.dataConfig.Whitespace == WhitespaceMetaspace {
+		dataText = writeMetaspace(dataText)
+	}
+	return dataText
+}
+
+// Collapse runs of whitespace into a single space
+func collapseWhitespace(dataText text) text {
+	if dataText.aSpans == nil {
+		return text{sText: pdRegex.ReplaceAllString(dataText.sText, " ")}
+	}
+	pdBuilder := newTextBuilder(dataText)
+	iLast := 0
+	for _, aiMatch := range pdRegex.FindAllStringIndex(dataText.sText, -1) {
+		pdBuilder.keep(iLast, aiMatch[0])
+		pdBuilder.write(" ", aiMatch[0], aiMatch[1])
+		iLast = aiMatch[1]
+	}
+	pdBuilder.keep(iLast, len(dataText.sText))
+	return pdBuilder.text()
+}
+
+// Write every space as Metaspace; other whitespace such as tabs and newlines is kept as is
+func writeMetaspace(dataText text) text {
+	if dataText.aSpans == nil {
+		return text{sText: strings.ReplaceAll(dataText.sText, " ", string(Metaspace))}
+	}
+	pdBuilder := newTextBuilder(dataText)
+	iLast := 0
+	for iIndex := 0; iIndex < len(dataText.sText); iIndex++ {
+		if dataText.sText[iIndex] == ' ' {
+			pdBuilder.keep(iLast, iIndex)
+			pdBuilder.write(string(Metaspace), iIndex, iIndex+1)
+			iLast = iIndex + 1
+		}
+	}
+	pdBuilder.keep(iLast, len(dataText.sText))
+	return pdBuilder.text()
+}
+
+// run the pipeline steps in order
+func (n *Normalizer) run(dataText text) text {
 	// pre processing operations
-	sText = removeChars(sText)
-	sText = normalizeUnicode(sText)
+	dataText = n.removeChars(dataText)
+	dataText = n.replace(dataText)
+	dataText = n.normalizeUnicode(dataText)
+	dataText = n.applyScripts(dataText)
+	dataText = n.decomposeHangul(dataText)
+
+	// case folding
+	dataText = n.lowercase(dataText)
 
 	// return normalized string
-	return strings.ToLower(sText)
+	return n.normalizeWhitespace(dataText)
+}
+
+// Normalize runs the configured pipeline over a string
+func (n *Normalizer) Normalize(sText string) string {
+	return n.run(newText(sText, false)).sText
+}
+
+// NormalizeWithAlignment runs the pipeline and also reports, for every byte of the result,
+// the span of the original input it came from
+func (n *Normalizer) NormalizeWithAlignment(sText string) (string, Alignment) {
+	dataText := n.run(newText(sText, true))
+	return dataText.sText, dataText.aSpans
+}
+
+// Denormalize undoes the reversible steps of the pipeline on decoded text: it restores the casing
+// recorded by case markers, spells out emoji markers as EmojiTokenText, turns Metaspace back into
+// spaces, removes the prefix space and composes Hangul syllables
+func (n *Normalizer) Denormalize(sText string) string {
+	sText = n.replayMarkers(sText)
+	if n.dataConfig.HangulJamo {
+		sText = composeHangul(sText)
+	}
+	if n.dataConfig.Whitespace == WhitespaceMetaspace {
+		sText = strings.ReplaceAll(sText, string(Metaspace), " ")
+	}
+	if n.dataConfig.AddPrefixSpace {
+		sText = strings.TrimPrefix(sText, " ")
+	}
+	return sText
+}
+
+// replayMarkers applies the case and emoji markers to decoded text
+func (n *Normalizer) replayMarkers(sText string) string {
+	if !n.dataConfig.CaseMarkers && !n.dataConfig.EmojiToken {
+		return sText
+	}
+	if !strings.ContainsFunc(sText, func(r rune) bool { return isMarker(r) || r == MarkerEmoji }) {
+		return sText
+	}
+
+	// replay the markers
+	var dBuilder strings.Builder
+	dBuilder.Grow(len(sText))
+	tfShift := false
+	tfCapsLock := false
+	for _, r := range sText {
+		switch {
+		case r == MarkerShift:
+			tfShift = true
+		case r == MarkerCapsLock:
+			tfCapsLock = true
+		case r == MarkerCapsEnd:
+			tfCapsLock = false
+		case r == MarkerEmoji:
+			dBuilder.WriteString(EmojiTokenText)
+			tfShift = false
+		case tfShift || tfCapsLock:
+			dBuilder.WriteRune(n.dataCase.ToUpper(r))
+			tfShift = false
+		default:
+			dBuilder.WriteRune(r)
+		}
+	}
+	return dBuilder.String()
+}
+
+// Normalize applies the default pipeline
+func Normalize(sText string) string {
+	return pdDefault.Normalize(sText)
 }
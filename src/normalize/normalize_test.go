@@ -0,0 +1,138 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+)
+
+// pipelines that each turn one step on or off, with an input and what it normalizes to
+var aNormalizeCases = []struct {
+	sName      string
+	dataConfig Config
+	sInput     string
+	sOutput    string
+}{
+	{"default", DefaultConfig(), "Ｈｅｌｌｏ 👍🏽 WORLD\x00 ©", "hello  world ©"},
+	{"none keeps everything", Config{Form: FormNone, Whitespace: WhitespacePreserve}, "Ｈé 👍\x00  A", "Ｈé 👍\x00  A"},
+	{"nfc", Config{Form: FormNFC, Whitespace: WhitespacePreserve}, "é ﬁ", "é ﬁ"},
+	{"nfd", Config{Form: FormNFD, Whitespace: WhitespacePreserve}, "é", "é"},
+	{"nfkc", Config{Form: FormNFKC, Whitespace: WhitespacePreserve}, "é ﬁ ①", "é fi 1"},
+	{"nfkd", Config{Form: FormNFKD, Whitespace: WhitespacePreserve}, "é ﬁ", "é fi"},
+	{"lowercase", Config{Form: FormNone, Lowercase: true, Whitespace: WhitespacePreserve}, "ÉCOLE Paris", "école paris"},
+	{"emoji clusters", Config{Form: FormNone, StripEmoji: true, Whitespace: WhitespacePreserve}, "a👨‍👩‍👧b 🇫🇷c ©️d", "ab c d"},
+	{"emoji ranges", Config{Form: FormNone, StripEmoji: true, EmojiRanges: true, Whitespace: WhitespacePreserve}, "a👍🏽b ✂️c", "ab c"},
+	{"emoji kept", Config{Form: FormNone, Whitespace: WhitespacePreserve}, "a👍🏽b", "a👍🏽b"},
+	{"control", Config{Form: FormNone, StripControl: true, Whitespace: WhitespacePreserve}, "a\x00b​c\td\n", "abc\td\n"},
+	{"collapse", Config{Form: FormNone, Whitespace: WhitespaceCollapse}, "a \t\n b  c ", "a b c "},
+	{"metaspace", Config{Form: FormNone, Whitespace: WhitespaceMetaspace, AddPrefixSpace: true}, "a b\tc", "▁a▁b\tc"},
+	{"literal replacement", Config{Form: FormNone, Whitespace: WhitespacePreserve, Replacements: []Replacement{{Pattern: "a.b", Replacement: "x"}}}, "a.b acb", "x acb"},
+	{"regex replacement", Config{Form: FormNone, Whitespace: WhitespacePreserve, Replacements: []Replacement{{Pattern: `([0-9])[0-9]*`, Replacement: "<$1>", Regex: true}}}, "a 123 b 4", "a <1> b <4>"},
+	{"replacements in order", Config{Form: FormNone, Whitespace: WhitespacePreserve, Replacements: []Replacement{{Pattern: "a", Replacement: "b"}, {Pattern: "b", Replacement: "c"}}}, "ab", "cc"},
+	{"replacement before nfkc", Config{Form: FormNFKC, Whitespace: WhitespacePreserve, Replacements: []Replacement{{Pattern: "ﬁ", Replacement: "FI"}}}, "ﬁ ﬂ", "FI fl"},
+}
+
+// TestNormalize checks every step of the pipeline on its own and the default pipeline, as a
+// normalizer and through the package function
+func TestNormalize(t *testing.T) {
+	for _, dataCase := range aNormalizeCases {
+		pdNormalizer, err := New(dataCase.dataConfig)
+		if err != nil {
+			t.Fatalf("%s: %v", dataCase.sName, err)
+		}
+		if sOutput := pdNormalizer.Normalize(dataCase.sInput); sOutput != dataCase.sOutput {
+			t.Errorf("%s: %q normalizes to %q, want %q", dataCase.sName, dataCase.sInput, sOutput, dataCase.sOutput)
+		}
+		if sOutput, _ := pdNormalizer.NormalizeWithAlignment(dataCase.sInput); sOutput != dataCase.sOutput {
+			t.Errorf("%s: %q normalizes with alignment to %q, want %q", dataCase.sName, dataCase.sInput, sOutput, dataCase.sOutput)
+		}
+		if pdNormalizer.Config().Form != dataCase.dataConfig.Form {
+			t.Errorf("%s: normalizer reports form %q", dataCase.sName, pdNormalizer.Config().Form)
+		}
+	}
+	if sOutput := Normalize("ÉCOLE 👍"); sOutput != "école " {
+		t.Errorf("package Normalize gives %q", sOutput)
+	}
+}
+
+// TestValidate checks that every invalid setting is reported, all of them at once, and that New and
+// MustNew refuse the configuration
+func TestValidate(t *testing.T) {
+	for _, dataCase := range []struct {
+		sName      string
+		dataConfig Config
+		asErrors   []string
+	}{
+		{"unknown form", Config{Form: "nfx", Whitespace: WhitespacePreserve}, []string{`form: unknown form "nfx"`}},
+		{"empty form", Config{Whitespace: WhitespacePreserve}, []string{`form: unknown form ""`}},
+		{"unknown whitespace", Config{Form: FormNone, Whitespace: "trim"}, []string{`whitespace: unknown policy "trim"`}},
+		{"case markers and lowercase", Config{Form: FormNone, Whitespace: WhitespacePreserve, Lowercase: true, CaseMarkers: true}, []string{"case_markers:"}},
+		{"emoji token and strip", Config{Form: FormNone, Whitespace: WhitespacePreserve, StripEmoji: true, EmojiToken: true}, []string{"emoji_token:"}},
+		{"emoji ranges without strip", Config{Form: FormNone, Whitespace: WhitespacePreserve, EmojiRanges: true}, []string{"emoji_ranges:"}},
+		{"empty pattern", Config{Form: FormNone, Whitespace: WhitespacePreserve, Replacements: []Replacement{{Pattern: "a"}, {Pattern: ""}}}, []string{"replacements[1]: pattern must not be empty"}},
+		{"bad regex", Config{Form: FormNone, Whitespace: WhitespacePreserve, Replacements: []Replacement{{Pattern: "(a", Regex: true}}}, []string{"replacements[0]: error parsing regexp"}},
+		{"unknown script", Config{Form: FormNone, Whitespace: WhitespacePreserve, Scripts: []string{ScriptThai, "latin"}}, []string{`scripts[1]: unknown rule set "latin"`}},
+		{"everything at once", Config{Form: "x", Whitespace: "y", Lowercase: true, CaseMarkers: true, Locale: "xx"}, []string{"form:", "whitespace:", "case_markers:", "locale:"}},
+	} {
+		err := dataCase.dataConfig.Validate()
+		if err == nil {
+			t.Errorf("%s: no error", dataCase.sName)
+			continue
+		}
+		for _, sError := range dataCase.asErrors {
+			if !strings.Contains(err.Error(), sError) {
+				t.Errorf("%s: %q does not report %q", dataCase.sName, err, sError)
+			}
+		}
+		if _, err := New(dataCase.dataConfig); err == nil {
+			t.Errorf("%s: New accepted the configuration", dataCase.sName)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: MustNew did not panic", dataCase.sName)
+				}
+			}()
+			MustNew(dataCase.dataConfig)
+		}()
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("default configuration: %v", err)
+	}
+}
+
+// TestCaseMarkers checks the markers written for single capitals and runs of them, that
+// Denormalize restores the casing exactly, and that markers already in the input are dropped
+func TestCaseMarkers(t *testing.T) {
+	for _, dataCase := range []struct {
+		sLocale string
+		sInput  string
+		sMarked string
+	}{
+		{"", "Paris", "\ue000paris"},
+		{"", "NASA rocks", "\ue001nasa\ue002 rocks"},
+		{"", "iPhone OS X", "i\ue000phone \ue001os\ue002 \ue000x"},
+		{"", "ÉCOLE Élan", "\ue001école\ue002 \ue000élan"},
+		{"", "lower 123 ß ǅ", "lower 123 ß ǅ"},
+		{"tr", "İstanbul IŞIK", "\ue000istanbul \ue001ışık\ue002"},
+	} {
+		pdNormalizer, err := New(Config{Form: FormNFC, CaseMarkers: true, Whitespace: WhitespacePreserve, Locale: dataCase.sLocale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sMarked := pdNormalizer.Normalize(dataCase.sInput)
+		if sMarked != dataCase.sMarked {
+			t.Errorf("%q normalizes to %q, want %q", dataCase.sInput, sMarked, dataCase.sMarked)
+		}
+		if sRestored := pdNormalizer.Denormalize(sMarked); sRestored != dataCase.sInput {
+			t.Errorf("%q comes back as %q", dataCase.sInput, sRestored)
+		}
+	}
+
+	pdNormalizer := MustNew(Config{Form: FormNone, CaseMarkers: true, Whitespace: WhitespacePreserve})
+	if sMarked := pdNormalizer.Normalize("a\ue000b\ue001c\ue002D"); sMarked != "abc\ue000d" {
+		t.Errorf("markers in the input: got %q", sMarked)
+	}
+	if sText := MustNew(Config{Form: FormNone, Whitespace: WhitespacePreserve}).Denormalize("\ue000paris"); sText != "\ue000paris" {
+		t.Errorf("markers are replayed without case markers: got %q", sText)
+	}
+}
@@ -0,0 +1,413 @@
+package normalize
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// Supported script-specific rule sets
+const (
+	ScriptArabic     = "arabic"
+	ScriptHebrew     = "hebrew"
+	ScriptThai       = "thai"
+	ScriptBengali    = "bengali"
+	ScriptCJK        = "cjk"
+	ScriptVietnamese = "vietnamese"
+)
+
+// map rule set names to the step that applies them
+var mapScriptRules = map[string]func(text) text{
+	ScriptArabic:     normalizeArabic,
+	ScriptHebrew:     normalizeHebrew,
+	ScriptThai:       normalizeThai,
+	ScriptBengali:    normalizeBengali,
+	ScriptCJK:        normalizeCJK,
+	ScriptVietnamese: normalizeVietnamese,
+}
+
+// LocaleVietnamese marks text as Vietnamese, so the vietnamese rule set treats every word as Vietnamese
+const LocaleVietnamese = "vi"
+
+// map locales to their case folding rules; Vietnamese cases like the default
+var mapLocaleCases = map[string]unicode.SpecialCase{
+	"tr":             unicode.TurkishCase,
+	"az":             unicode.AzeriCase,
+	LocaleVietnamese: nil,
+}
+
+// Run the configured script rules, then restore the unicode form they may have disturbed
+func (n *Normalizer) applyScripts(dataText text) text {
+	if len(n.dataConfig.Scripts) == 0 {
+		return dataText
+	}
+	for _, sScript := range n.dataConfig.Scripts {
+		fnRule := mapScriptRules[sScript]
+		if sScript == ScriptVietnamese && n.dataConfig.Locale == LocaleVietnamese {
+			fnRule = normalizeTaggedVietnamese
+		}
+		dataText = fnRule(dataText)
+	}
+	return n.normalizeUnicode(dataText)
+}
+
+// mapRunes rewrites a text rune by rune; fnMap returns a negative rune to drop a character
+func mapRunes(dataText text, fnMap func(r rune) rune) text {
+	pdBuilder := newTextBuilder(dataText)
+	for iIndex, r := range dataText.sText {
+		iSize := runeWidth(dataText.sText, iIndex)
+		rMapped := fnMap(r)
+		switch {
+		case rMapped < 0:
+			continue
+		case rMapped == r && (r != utf8.RuneError || iSize > 1):
+			pdBuilder.keep(iIndex, iIndex+iSize)
+		default:
+			pdBuilder.write(string(rMapped), iIndex, iIndex+iSize)
+		}
+	}
+	return pdBuilder.text()
+}
+
+// mapSegments rewrites a text segment by segment; fnNext returns the length of the segment starting
+// at the beginning of its argument and fnMap its replacement
+func mapSegments(dataText text, fnNext func(string) int, fnMap func(string) string) text {
+	pdBuilder := newTextBuilder(dataText)
+	iStart := 0
+	for iStart < len(dataText.sText) {
+		iEnd := iStart + fnNext(dataText.sText[iStart:])
+		sSegment := dataText.sText[iStart:iEnd]
+		if sMapped := fnMap(sSegment); sMapped != sSegment {
+			pdBuilder.write(sMapped, iStart, iEnd)
+		} else {
+			pdBuilder.keep(iStart, iEnd)
+		}
+		iStart = iEnd
+	}
+	return pdBuilder.text()
+}
+
+// nextMarkRun returns the length of a base character followed by the marks that belong to it
+func nextMarkRun(sText string, fnIsMark func(r rune) bool) int {
+	_, iEnd := utf8.DecodeRuneInString(sText)
+	for iEnd < len(sText) {
+		r, iSize := utf8.DecodeRuneInString(sText[iEnd:])
+		if !fnIsMark(r) {
+			break
+		}
+		iEnd += iSize
+	}
+	return iEnd
+}
+
+// reorderMarks stably sorts the marks after the base character by class and drops repeated marks
+func reorderMarks(arSegment []rune, fnClass func(r rune) int) []rune {
+	arMarks := slices.Clone(arSegment[1:])
+	slices.SortStableFunc(arMarks, func(rA rune, rB rune) int {
+		return fnClass(rA) - fnClass(rB)
+	})
+	arResult := []rune{arSegment[0]}
+	for _, r := range arMarks {
+		if r != arResult[len(arResult)-1] {
+			arResult = append(arResult, r)
+		}
+	}
+	return arResult
+}
+
+// Arabic: remove tashkeel and tatweel, unify alef and yeh variants
+func normalizeArabic(dataText text) text {
+	return mapRunes(dataText, func(r rune) rune {
+		switch {
+		case (r >= 0x064B && r <= 0x065F) || r == 0x0670 || (r >= 0x06D6 && r <= 0x06DC) || (r >= 0x06DF && r <= 0x06E8) || (r >= 0x06EA && r <= 0x06ED):
+			return -1 // tashkeel and Quranic annotation marks
+		case r == 0x0640:
+			return -1 // tatweel
+		case r == 0x0622 || r == 0x0623 || r == 0x0625 || r == 0x0671:
+			return 0x0627 // alef with madda, hamza above, hamza below, wasla
+		case r == 0x0649 || r == 0x06CC:
+			return 0x064A // alef maksura and farsi yeh
+		}
+		return r
+	})
+}
+
+// Hebrew: strip niqqud and cantillation marks, keeping the punctuation that shares their block
+func normalizeHebrew(dataText text) text {
+	return mapRunes(dataText, func(r rune) rune {
+		if (r >= 0x0591 && r <= 0x05BD) || r == 0x05BF || r == 0x05C1 || r == 0x05C2 || r == 0x05C4 || r == 0x05C5 || r == 0x05C7 {
+			return -1
+		}
+		return r
+	})
+}
+
+// check for Thai combining vowels, tone marks and signs
+func isThaiMark(r rune) bool {
+	return r == 0x0E31 || (r >= 0x0E34 && r <= 0x0E3A) || (r >= 0x0E47 && r <= 0x0E4E)
+}
+
+// order Thai marks as vowels, then tone marks, then nikhahit
+func thaiMarkClass(r rune) int {
+	switch {
+	case r >= 0x0E48 && r <= 0x0E4C, r == 0x0E4E:
+		return 1
+	case r == 0x0E4D:
+		return 2
+	}
+	return 0
+}
+
+// Thai: put vowels before tone marks, drop duplicated marks and spell nikhahit + sara aa as sara am
+func normalizeThai(dataText text) text {
+	return mapSegments(dataText, func(sText string) int {
+		iEnd := nextMarkRun(sText, isThaiMark)
+		if strings.ContainsRune(sText[:iEnd], 0x0E4D) && strings.HasPrefix(sText[iEnd:], "\u0E32") {
+			iEnd += len("\u0E32")
+		}
+		return iEnd
+	}, func(sSegment string) string {
+		arSegment := []rune(sSegment)
+		if len(arSegment) < 2 || !isThaiMark(arSegment[1]) {
+			return sSegment
+		}
+		tfSaraAm := arSegment[len(arSegment)-1] == 0x0E32
+		if tfSaraAm {
+			arSegment = arSegment[:len(arSegment)-1]
+		}
+		arSegment = reorderMarks(arSegment, thaiMarkClass)
+		if tfSaraAm {
+			arSegment = append(slices.DeleteFunc(arSegment, func(r rune) bool { return r == 0x0E4D }), 0x0E33)
+		}
+		return string(arSegment)
+	})
+}
+
+// check for Bengali dependent vowel signs and other marks
+func isBengaliMark(r rune) bool {
+	return (r >= 0x0981 && r <= 0x0983) || r == 0x09BC || (r >= 0x09BE && r <= 0x09C4) || r == 0x09C7 || r == 0x09C8 || (r >= 0x09CB && r <= 0x09CD) || r == 0x09D7
+}
+
+// order Bengali marks as nukta, virama, vowel signs, then candrabindu, anusvara and visarga
+func bengaliMarkClass(r rune) int {
+	switch {
+	case r == 0x09BC:
+		return 0
+	case r == 0x09CD:
+		return 1
+	case r >= 0x0981 && r <= 0x0983:
+		return 3
+	}
+	return 2
+}
+
+// ta followed by virama, which a ZWJ turns into khanda ta
+const sTaVirama = "\u09A4\u09CD"
+
+// Bengali: canonical order of signs, two-part vowels composed, and ta + virama + ZWJ as khanda ta
+func normalizeBengali(dataText text) text {
+	return mapSegments(dataText, func(sText string) int {
+		iEnd := nextMarkRun(sText, isBengaliMark)
+		if strings.HasPrefix(sText, sTaVirama) && iEnd == len(sTaVirama) && strings.HasPrefix(sText[iEnd:], "\u200D") {
+			iEnd += len("\u200D")
+		}
+		return iEnd
+	}, func(sSegment string) string {
+		if sSegment == sTaVirama+"\u200D" {
+			return "\u09CE"
+		}
+		arSegment := []rune(sSegment)
+		if len(arSegment) < 2 {
+			return sSegment
+		}
+		arSegment = reorderMarks(arSegment, bengaliMarkClass)
+
+		// compose e + aa and e + au length mark
+		sResult := string(arSegment)
+		sResult = strings.ReplaceAll(sResult, "\u09C7\u09BE", "\u09CB")
+		return strings.ReplaceAll(sResult, "\u09C7\u09D7", "\u09CC")
+	})
+}
+
+// CJK: fold full-width ASCII to narrow and half-width katakana to wide
+func normalizeCJK(dataText text) text {
+	return mapRunes(dataText, func(r rune) rune {
+		if rFolded := width.LookupRune(r).Folded(); rFolded != 0 {
+			return rFolded
+		}
+		return r
+	})
+}
+
+// Vietnamese tone marks, in their decomposed form
+const vietnameseTones = "\u0300\u0301\u0303\u0309\u0323"
+
+// check for letters and marks, which make up a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r)
+}
+
+// nextWord returns the length of a word, or of a single character that is not part of one
+func nextWord(sText string) int {
+	r, iEnd := utf8.DecodeRuneInString(sText)
+	if !isWordRune(r) {
+		return iEnd
+	}
+	for iEnd < len(sText) {
+		r, iSize := utf8.DecodeRuneInString(sText[iEnd:])
+		if !isWordRune(r) {
+			break
+		}
+		iEnd += iSize
+	}
+	return iEnd
+}
+
+// Vietnamese: place tone marks by the modern rules so misplaced ones such as ngừơi become người.
+// Only single-syllable words with a letter no other Latin orthography uses (ă, â, ê, ô, ơ, ư or đ)
+// are touched, so café or canción pass through unchanged.
+func normalizeVietnamese(dataText text) text {
+	return mapSegments(dataText, nextWord, func(sWord string) string {
+		return placeVietnameseTone(sWord, false)
+	})
+}
+
+// normalizeTaggedVietnamese places tone marks in text whose locale says it is Vietnamese, where
+// every single-syllable word is taken as Vietnamese, so old-style hòa and new-style hoà become the same
+func normalizeTaggedVietnamese(dataText text) text {
+	return mapSegments(dataText, nextWord, func(sWord string) string {
+		return placeVietnameseTone(sWord, true)
+	})
+}
+
+// consonants a Vietnamese syllable may end with
+var mapVietnameseFinals = map[string]bool{"": true, "c": true, "ch": true, "m": true, "n": true, "ng": true, "nh": true, "p": true, "t": true}
+
+// placeVietnameseTone moves the single tone mark of a one-syllable Latin word to its canonical vowel
+// within the vowel nucleus that carries it. Unless tfTagged, the word also needs a letter only
+// Vietnamese spells.
+func placeVietnameseTone(sWord string, tfTagged bool) string {
+	sDecomposed := norm.NFD.String(sWord)
+	iTones := 0
+	for _, r := range sDecomposed {
+		if strings.ContainsRune(vietnameseTones, r) {
+			iTones++
+		}
+	}
+	if iTones != 1 {
+		return sWord
+	}
+
+	// split into letters with their non-tone marks, remembering the tone and the letter it is on
+	var aarLetters [][]rune
+	var rTone rune
+	iToneLetter := -1
+	tfVietnamese := false
+	for _, r := range sDecomposed {
+		switch {
+		case strings.ContainsRune(vietnameseTones, r):
+			if len(aarLetters) == 0 {
+				return sWord
+			}
+			rTone, iToneLetter = r, len(aarLetters)-1
+		case unicode.Is(unicode.Mn, r):
+			if len(aarLetters) == 0 {
+				return sWord
+			}
+			rBase := unicode.ToLower(aarLetters[len(aarLetters)-1][0])
+			tfVietnamese = tfVietnamese || r == 0x031B || (r == 0x0306 && rBase == 'a') || (r == 0x0302 && strings.ContainsRune("aeo", rBase))
+			aarLetters[len(aarLetters)-1] = append(aarLetters[len(aarLetters)-1], r)
+		case r < utf8.RuneSelf || r == 'đ' || r == 'Đ':
+			tfVietnamese = tfVietnamese || r == 'đ' || r == 'Đ'
+			aarLetters = append(aarLetters, []rune{r})
+		default:
+			return sWord
+		}
+	}
+	if !tfVietnamese && !tfTagged {
+		return sWord
+	}
+
+	// find the vowel nucleus; the u of qu and the i of gi belong to the initial consonant
+	fnIsVowel := func(iIndex int) bool {
+		rBase := unicode.ToLower(aarLetters[iIndex][0])
+		if !strings.ContainsRune("aeiouy", rBase) {
+			return false
+		}
+		if iIndex > 0 && iIndex+1 < len(aarLetters) {
+			rPrevious := unicode.ToLower(aarLetters[iIndex-1][0])
+			if (rBase == 'u' && rPrevious == 'q') || (rBase == 'i' && rPrevious == 'g' && iIndex == 1 && strings.ContainsRune("aeiouy", unicode.ToLower(aarLetters[iIndex+1][0]))) {
+				return false
+			}
+		}
+		return true
+	}
+	iStart := 0
+	for iStart < len(aarLetters) && !fnIsVowel(iStart) {
+		iStart++
+	}
+	iEnd := iStart
+	for iEnd < len(aarLetters) && fnIsVowel(iEnd) {
+		iEnd++
+	}
+
+	// one syllable: the tone sits in the only vowel nucleus, followed by a Vietnamese final consonant
+	if iStart == iEnd || iToneLetter < iStart || iToneLetter >= iEnd {
+		return sWord
+	}
+	var dFinal strings.Builder
+	for _, arLetter := range aarLetters[iEnd:] {
+		if len(arLetter) > 1 {
+			return sWord
+		}
+		dFinal.WriteRune(unicode.ToLower(arLetter[0]))
+	}
+	if !mapVietnameseFinals[dFinal.String()] {
+		return sWord
+	}
+
+	// pick the vowel that carries the tone: the one with a diacritic, else the last vowel before a
+	// final consonant, else the second of oa/oe/uy, the first of two or the middle of three vowels
+	iTarget := -1
+	for iIndex := iStart; iIndex < iEnd; iIndex++ {
+		if len(aarLetters[iIndex]) > 1 {
+			iTarget = iIndex
+		}
+	}
+	if iTarget < 0 {
+		var dBuilder strings.Builder
+		for _, arLetter := range aarLetters[iStart:iEnd] {
+			dBuilder.WriteRune(unicode.ToLower(arLetter[0]))
+		}
+		sNucleus := dBuilder.String()
+		switch {
+		case iEnd < len(aarLetters):
+			iTarget = iEnd - 1
+		case len(sNucleus) == 1:
+			iTarget = iStart
+		case sNucleus == "oa" || sNucleus == "oe" || sNucleus == "uy":
+			iTarget = iStart + 1
+		case len(sNucleus) == 2:
+			iTarget = iStart
+		default:
+			iTarget = iStart + 1
+		}
+	}
+	if iTarget == iToneLetter {
+		return sWord
+	}
+
+	// rebuild the word with the tone on the chosen vowel
+	var dBuilder strings.Builder
+	for iIndex, arLetter := range aarLetters {
+		dBuilder.WriteString(string(arLetter))
+		if iIndex == iTarget {
+			dBuilder.WriteRune(rTone)
+		}
+	}
+	return norm.NFC.String(dBuilder.String())
+}
@@ -0,0 +1,106 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+)
+
+// scriptCase is an input and the text a rule set turns it into
+type scriptCase struct {
+	sName   string
+	sInput  string
+	sOutput string
+}
+
+// cases of every rule set, under a pipeline that otherwise keeps the text as it is
+var mapScriptCases = map[string][]scriptCase{
+	ScriptArabic: {
+		{"tashkeel", "أَحْمَد", "احمد"},
+		{"tatweel", "كـتـاب", "كتاب"},
+		{"alef and yeh variants", "إلى آخر ٱلكتاب فارسی", "الي اخر الكتاب فارسي"},
+	},
+	ScriptHebrew: {
+		{"niqqud", "שָׁלוֹם", "שלום"},
+		{"maqaf kept", "בֵּית־סֵפֶר", "בית־ספר"},
+	},
+	ScriptThai: {
+		{"tone mark before vowel", "ก่ิ", "กิ่"},
+		{"nikhahit and sara aa", "นํ้า", "น้ำ"},
+		{"repeated mark", "ก่่", "ก่"},
+		{"canonical", "น้ำใจ", "น้ำใจ"},
+	},
+	ScriptBengali: {
+		{"two-part vowel", "কো", "কো"},
+		{"au length mark", "কৌ", "কৌ"},
+		{"candrabindu after vowel sign", "কঁি", "কিঁ"},
+		{"khanda ta", "ত্‍", "ৎ"},
+	},
+	ScriptCJK: {
+		{"full-width ASCII", "ＡＢＣ１２３！", "ABC123!"},
+		{"half-width katakana", "ｶﾀｶﾅ", "カタカナ"},
+		{"wide kanji", "漢字", "漢字"},
+	},
+	ScriptVietnamese: {
+		{"tone on the marked vowel", "ngừơi", "người"},
+		{"tone on the horn", "thủơ", "thuở"},
+		{"already canonical", "Việt Nam người thuở", "Việt Nam người thuở"},
+		{"untagged old style", "hòa", "hòa"},
+		{"French", "café où là fête", "café où là fête"},
+		{"Spanish", "canción dió más", "canción dió más"},
+		{"Portuguese", "mãe você três", "mãe você três"},
+		{"English loanwords", "résumé naïve", "résumé naïve"},
+	},
+}
+
+// newScriptNormalizer builds a pipeline that applies one rule set and otherwise keeps the text
+func newScriptNormalizer(t *testing.T, sScript string, sLocale string) *Normalizer {
+	t.Helper()
+	pdNormalizer, err := New(Config{Form: FormNFC, Whitespace: WhitespacePreserve, Scripts: []string{sScript}, Locale: sLocale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pdNormalizer
+}
+
+// TestScripts checks every rule set on its own cases
+func TestScripts(t *testing.T) {
+	for sScript, aCases := range mapScriptCases {
+		pdNormalizer := newScriptNormalizer(t, sScript, "")
+		for _, dataCase := range aCases {
+			if sOutput := pdNormalizer.Normalize(dataCase.sInput); sOutput != dataCase.sOutput {
+				t.Errorf("%s, %s: %q normalizes to %q, want %q", sScript, dataCase.sName, dataCase.sInput, sOutput, dataCase.sOutput)
+			}
+		}
+	}
+}
+
+// TestScriptsTaggedVietnamese checks that text tagged as Vietnamese also folds old-style tone
+// placement, still within single syllables, and that the tag does not change case
+func TestScriptsTaggedVietnamese(t *testing.T) {
+	pdNormalizer := newScriptNormalizer(t, ScriptVietnamese, LocaleVietnamese)
+	for _, dataCase := range []scriptCase{
+		{"oa", "hòa", "hoà"},
+		{"oe", "Hòe", "Hoè"},
+		{"uy", "thủy", "thuỷ"},
+		{"final consonant", "hoàng", "hoàng"},
+		{"qu", "quý", "quý"},
+		{"gi", "già", "già"},
+		{"two syllables", "café canción", "café canción"},
+		{"foreign final consonant", "más", "más"},
+	} {
+		if sOutput := pdNormalizer.Normalize(dataCase.sInput); sOutput != dataCase.sOutput {
+			t.Errorf("%s: %q normalizes to %q, want %q", dataCase.sName, dataCase.sInput, sOutput, dataCase.sOutput)
+		}
+	}
+
+	pdLowercase, err := New(Config{Form: FormNFC, Lowercase: true, Whitespace: WhitespacePreserve, Locale: LocaleVietnamese})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sOutput := pdLowercase.Normalize("ISTANBUL Đà"); sOutput != "istanbul đà" {
+		t.Errorf("vi lowercases to %q", sOutput)
+	}
+	if err := (Config{Form: FormNFC, Whitespace: WhitespacePreserve, Locale: "xx"}).Validate(); err == nil || !strings.Contains(err.Error(), "locale") {
+		t.Errorf("unknown locale: got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package normalize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/transform"
+)
+
+// DefaultMaxBuffer is how much input a Transformer holds while looking for a split point
+const DefaultMaxBuffer = 1 << 20
+
+// ErrNoSplitPoint is returned when the buffered input grows past the limit without a place where
+// it can be split without changing the result
+var ErrNoSplitPoint = errors.New("normalize: no split point within the stream buffer")
+
+// Transformer is a streaming form of a Normalizer implementing transform.Transformer. Input is
+// buffered and cut after whitespace, where every pipeline step gives the same result on both halves
+// as on the whole, so the output is identical to Normalize on the full text. Every byte is checked
+// for a split point once, where the previous call stopped, and normalized once.
+type Transformer struct {
+	pdFirst     *Normalizer
+	pdRest      *Normalizer
+	iMaxBuffer  int
+	tfStarted   bool
+	tfSpaceEnd  bool
+	abPending   []byte
+	iScanned    int
+	abOutput    []byte
+	iOutputRead int
+}
+
+// NewTransformer builds a streaming normalizer holding at most iMaxBuffer bytes of input, or
+// DefaultMaxBuffer if it is not positive. Replacement rules that could match across a split point
+// (whitespace, any character, anchors, empty matches) or that produce a combining mark cannot be
+// streamed and are rejected.
+func NewTransformer(pdNormalizer *Normalizer, iMaxBuffer int) (*Transformer, error) {
+	if iMaxBuffer <= 0 {
+		iMaxBuffer = DefaultMaxBuffer
+	}
+	for iIndex, pdPattern := range pdNormalizer.apdReplacements {
+		pdRegexp, err := syntax.Parse(pdPattern.String(), syntax.Perl)
+		if err != nil {
+			return nil, fmt.Errorf("replacements[%d]: %w", iIndex, err)
+		}
+		if !isStreamable(pdRegexp.Simplify()) {
+			return nil, fmt.Errorf("replacements[%d]: pattern %q may match across whitespace and cannot be streamed", iIndex, pdPattern.String())
+		}
+		if rFirst, _ := utf8.DecodeRuneInString(pdNormalizer.dataConfig.Replacements[iIndex].Replacement); unicode.In(rFirst, unicode.Mn, unicode.Mc, unicode.Me) {
+			return nil, fmt.Errorf("replacements[%d]: replacement starting with a combining mark cannot be streamed", iIndex)
+		}
+	}
+
+	// the prefix space only goes in front of the first chunk
+	pdRest := pdNormalizer
+	if pdNormalizer.dataConfig.AddPrefixSpace {
+		dataConfig := pdNormalizer.dataConfig
+		dataConfig.AddPrefixSpace = false
+		pdRest = MustNew(dataConfig)
+	}
+	return &Transformer{pdFirst: pdNormalizer, pdRest: pdRest, iMaxBuffer: iMaxBuffer}, nil
+}
+
+// NewReader returns a reader producing the normalized contents of pdReader
+func (n *Normalizer) NewReader(pdReader io.Reader) (io.Reader, error) {
+	pdTransformer, err := NewTransformer(n, DefaultMaxBuffer)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(pdReader, pdTransformer), nil
+}
+
+// NewWriter returns a writer normalizing everything written to it into pdWriter; Close flushes the rest
+func (n *Normalizer) NewWriter(pdWriter io.Writer) (io.WriteCloser, error) {
+	pdTransformer, err := NewTransformer(n, DefaultMaxBuffer)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewWriter(pdWriter, pdTransformer), nil
+}
+
+// Reset clears the buffered input and output so the transformer can start a new stream
+func (t *Transformer) Reset() {
+	t.tfStarted = false
+	t.tfSpaceEnd = false
+	t.abPending = t.abPending[:0]
+	t.iScanned = 0
+	t.abOutput = t.abOutput[:0]
+	t.iOutputRead = 0
+}
+
+// Transform implements transform.Transformer. All of src is appended to the internal buffer, whose
+// new bytes are searched for the last split point, and the buffer is normalized up to it; output
+// that does not fit in dst is kept for the next call.
+func (t *Transformer) Transform(abDst []byte, abSrc []byte, tfAtEOF bool) (int, int, error) {
+	// flush what is left from the previous call first
+	iDst := t.flush(abDst)
+	if t.iOutputRead < len(t.abOutput) {
+		return iDst, 0, transform.ErrShortDst
+	}
+
+	// normalize the buffered input up to the last split point
+	t.abPending = append(t.abPending, abSrc...)
+	iSplit := len(t.abPending)
+	if !tfAtEOF {
+		iSplit = t.lastSplit()
+	}
+	if iSplit > 0 {
+		pdNormalizer := t.pdRest
+		if !t.tfStarted {
+			pdNormalizer = t.pdFirst
+		}
+		t.tfStarted = true
+		sOutput := pdNormalizer.Normalize(string(t.abPending[:iSplit]))
+
+		// characters removed at the start of a chunk can leave two whitespace runs that collapse into one
+		if t.pdFirst.dataConfig.Whitespace == WhitespaceCollapse {
+			if t.tfSpaceEnd {
+				sOutput = strings.TrimPrefix(sOutput, " ")
+			}
+			if sOutput != "" {
+				t.tfSpaceEnd = strings.HasSuffix(sOutput, " ")
+			}
+		}
+		t.abOutput = append(t.abOutput[:0], sOutput...)
+		t.iOutputRead = 0
+		t.abPending = t.abPending[:copy(t.abPending, t.abPending[iSplit:])]
+		t.iScanned = max(t.iScanned-iSplit, 0)
+	} else if len(t.abPending) > t.iMaxBuffer {
+		return iDst, len(abSrc), ErrNoSplitPoint
+	}
+
+	iDst += t.flush(abDst[iDst:])
+	if t.iOutputRead < len(t.abOutput) {
+		return iDst, len(abSrc), transform.ErrShortDst
+	}
+	return iDst, len(abSrc), nil
+}
+
+// flush copies pending output into abDst and returns how much was written
+func (t *Transformer) flush(abDst []byte) int {
+	iCopied := copy(abDst, t.abOutput[t.iOutputRead:])
+	t.iOutputRead += iCopied
+	return iCopied
+}
+
+// lastSplit returns the last split point of the pending input, or 0 if there is none. A split
+// point follows a whitespace character and precedes a complete rune that starts a new grapheme
+// cluster and a new normalization segment, so no pipeline step looks across it. The scan goes on
+// from where the previous call stopped: earlier positions are no split point, or the input would
+// have been cut there. It stops before whitespace whose next rune has not fully arrived.
+func (t *Transformer) lastSplit() int {
+	iSplit := 0
+	for t.iScanned < len(t.abPending) && utf8.FullRune(t.abPending[t.iScanned:]) {
+		r, iSize := utf8.DecodeRune(t.abPending[t.iScanned:])
+		if unicode.IsSpace(r) {
+			if !utf8.FullRune(t.abPending[t.iScanned+iSize:]) {
+				break
+			}
+			if t.canSplitBefore(t.abPending[t.iScanned:], iSize) {
+				iSplit = t.iScanned + iSize
+			}
+		}
+		t.iScanned += iSize
+	}
+	return iSplit
+}
+
+// canSplitBefore checks the rune that follows the iSpaceSize bytes of whitespace at the start of ab
+func (t *Transformer) canSplitBefore(ab []byte, iSpaceSize int) bool {
+	abNext := ab[iSpaceSize:]
+	if !utf8.FullRune(abNext) {
+		return false
+	}
+	rNext, iNextSize := utf8.DecodeRune(abNext)
+	if unicode.IsSpace(rNext) || rNext == utf8.RuneError {
+		return false
+	}
+	if pdForm := t.pdFirst.pdForm; pdForm != nil && !pdForm.Properties(abNext).BoundaryBefore() {
+		return false
+	}
+	abCluster, _, _, _ := uniseg.FirstGraphemeCluster(ab[:iSpaceSize+iNextSize], -1)
+	return len(abCluster) == iSpaceSize
+}
+
+// isStreamable checks that a replacement pattern only matches non-empty runs of non-whitespace
+// and does not depend on where the text starts or ends
+func isStreamable(pdRegexp *syntax.Regexp) bool {
+	return minLength(pdRegexp) > 0 && !matchesAcross(pdRegexp)
+}
+
+// matchesAcross checks for anything in a pattern that can match whitespace or a text boundary
+func matchesAcross(pdRegexp *syntax.Regexp) bool {
+	switch pdRegexp.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return true
+	case syntax.OpLiteral:
+		for _, r := range pdRegexp.Rune {
+			if unicode.IsSpace(r) {
+				return true
+			}
+		}
+	case syntax.OpCharClass:
+		for iIndex := 0; iIndex+1 < len(pdRegexp.Rune); iIndex += 2 {
+			for _, r := range arSpaces {
+				if r >= pdRegexp.Rune[iIndex] && r <= pdRegexp.Rune[iIndex+1] {
+					return true
+				}
+			}
+		}
+	}
+	for _, pdSub := range pdRegexp.Sub {
+		if matchesAcross(pdSub) {
+			return true
+		}
+	}
+	return false
+}
+
+// every rune unicode.IsSpace accepts
+var arSpaces = []rune{'\t', '\n', '\v', '\f', '\r', ' ', 0x85, 0xA0, 0x1680, 0x2000, 0x2001, 0x2002, 0x2003,
+	0x2004, 0x2005, 0x2006, 0x2007, 0x2008, 0x2009, 0x200A, 0x2028, 0x2029, 0x202F, 0x205F, 0x3000}
+
+// minLength returns the length in runes of the shortest text a pattern can match
+func minLength(pdRegexp *syntax.Regexp) int {
+	switch pdRegexp.Op {
+	case syntax.OpLiteral:
+		return len(pdRegexp.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return minLength(pdRegexp.Sub[0])
+	case syntax.OpRepeat:
+		return pdRegexp.Min * minLength(pdRegexp.Sub[0])
+	case syntax.OpConcat:
+		iLength := 0
+		for _, pdSub := range pdRegexp.Sub {
+			iLength += minLength(pdSub)
+		}
+		return iLength
+	case syntax.OpAlternate:
+		iLength := -1
+		for _, pdSub := range pdRegexp.Sub {
+			if iSub := minLength(pdSub); iLength < 0 || iSub < iLength {
+				iLength = iSub
+			}
+		}
+		return max(iLength, 0)
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package normalize
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// pipelines whose streaming output has to match Normalize
+var mapStreamConfigs = map[string]Config{
+	"default":  DefaultConfig(),
+	"clusters": {Form: FormNFKC, Lowercase: true, StripEmoji: true, StripControl: true, Whitespace: WhitespacePreserve},
+	"collapse": {Form: FormNFC, Lowercase: true, StripControl: true, Whitespace: WhitespaceCollapse},
+	"metaspace": {Form: FormNFC, CaseMarkers: true, Whitespace: WhitespaceMetaspace, AddPrefixSpace: true,
+		Replacements: []Replacement{{Pattern: `[0-9]+`, Replacement: "0", Regex: true}}},
+	"jamo":  {Form: FormNFD, Lowercase: true, Whitespace: WhitespacePreserve, HangulJamo: true},
+	"emoji": {Form: FormNFKC, EmojiToken: true, StripControl: true, Whitespace: WhitespacePreserve},
+}
+
+// inputs with something to get wrong at every cut: marks after spaces, runs of whitespace,
+// stripped characters at the start of a chunk, emoji sequences, capitals and Hangul
+var asStreamInputs = []string{
+	"",
+	"Hello  World\tAGAIN\r\nnext",
+	"a ́b  c̈ é ｆｕｌｌ width",
+	" \x00 x \x01\x02  y 12 345 ",
+	"👍🏽 team 🇫🇷 ok ‍ 👨‍👩‍👧 ❤️ 1️⃣",
+	"한국어 텍스트  입니다 ＡＢＣ",
+	"‍ ̀ ️  ",
+	"x \U0001F3FD y \u20e3 z \u200d\U0001F44D \ufe0f",
+}
+
+// transformChunks feeds the chunks to a transformer one Transform call at a time through a
+// destination of iDst bytes, as transform.Reader would with a short buffer
+func transformChunks(pdTransformer *Transformer, asChunks []string, iDst int) (string, error) {
+	var dBuilder strings.Builder
+	abDst := make([]byte, iDst)
+	for iIndex, sChunk := range asChunks {
+		abSrc := []byte(sChunk)
+		tfAtEOF := iIndex == len(asChunks)-1
+		for {
+			iWritten, iRead, err := pdTransformer.Transform(abDst, abSrc, tfAtEOF)
+			dBuilder.Write(abDst[:iWritten])
+			abSrc = abSrc[iRead:]
+			if errors.Is(err, transform.ErrShortDst) {
+				continue
+			}
+			if err != nil {
+				return dBuilder.String(), err
+			}
+			break
+		}
+	}
+	return dBuilder.String(), nil
+}
+
+// TestTransformerSplits cuts every input at every byte and drains it through destinations of
+// several sizes; the output must always be what Normalize gives for the whole input
+func TestTransformerSplits(t *testing.T) {
+	for sName, dataConfig := range mapStreamConfigs {
+		pdNormalizer := MustNew(dataConfig)
+		for _, sInput := range asStreamInputs {
+			sExpected := pdNormalizer.Normalize(sInput)
+			for iSplit := 0; iSplit <= len(sInput); iSplit++ {
+				for _, iDst := range []int{1, 3, 7, 64} {
+					pdTransformer, err := NewTransformer(pdNormalizer, 0)
+					if err != nil {
+						t.Fatalf("%s: %v", sName, err)
+					}
+					sActual, err := transformChunks(pdTransformer, []string{sInput[:iSplit], sInput[iSplit:]}, iDst)
+					if err != nil {
+						t.Fatalf("%s %q split at %d: %v", sName, sInput, iSplit, err)
+					}
+					if sActual != sExpected {
+						t.Errorf("%s %q split at %d, dst %d: got %q, want %q", sName, sInput, iSplit, iDst, sActual, sExpected)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestTransformerBytes feeds every input one byte at a time with small buffers that still hold the
+// longest stretch without a split point, and through transform.String after Reset
+func TestTransformerBytes(t *testing.T) {
+	for sName, dataConfig := range mapStreamConfigs {
+		pdNormalizer := MustNew(dataConfig)
+		for _, sInput := range asStreamInputs {
+			sExpected := pdNormalizer.Normalize(sInput)
+			asBytes := make([]string, len(sInput)+1)
+			for iIndex := range len(sInput) {
+				asBytes[iIndex] = sInput[iIndex : iIndex+1]
+			}
+			for _, iMaxBuffer := range []int{32, 64, DefaultMaxBuffer} {
+				pdTransformer, err := NewTransformer(pdNormalizer, iMaxBuffer)
+				if err != nil {
+					t.Fatalf("%s: %v", sName, err)
+				}
+				sActual, err := transformChunks(pdTransformer, asBytes, 2)
+				if err != nil {
+					t.Fatalf("%s %q with a buffer of %d: %v", sName, sInput, iMaxBuffer, err)
+				}
+				if sActual != sExpected {
+					t.Errorf("%s %q with a buffer of %d: got %q, want %q", sName, sInput, iMaxBuffer, sActual, sExpected)
+				}
+				pdTransformer.Reset()
+				if sActual, _, err = transform.String(pdTransformer, sInput); err != nil || sActual != sExpected {
+					t.Errorf("%s %q after Reset: got %q, %v, want %q", sName, sInput, sActual, err, sExpected)
+				}
+			}
+		}
+	}
+}
+
+// TestTransformerNoSplitPoint checks that input without whitespace stops the stream once it
+// outgrows the buffer, and that the same amount of text with whitespace does not
+func TestTransformerNoSplitPoint(t *testing.T) {
+	pdTransformer, err := NewTransformer(Default(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transformChunks(pdTransformer, []string{"abcdef", "ghijkl", "mnop", ""}, 64); !errors.Is(err, ErrNoSplitPoint) {
+		t.Errorf("got %v, want ErrNoSplitPoint", err)
+	}
+
+	pdTransformer.Reset()
+	sInput := "abc def ghi jkl mno pqr"
+	sActual, err := transformChunks(pdTransformer, []string{sInput[:6], sInput[6:12], sInput[12:], ""}, 64)
+	if err != nil || sActual != sInput {
+		t.Errorf("got %q, %v, want %q", sActual, err, sInput)
+	}
+}
+
+// TestTransformerScanPosition feeds a long stretch without a split point one byte at a time and
+// checks that every call only scans the bytes it added, stopping at most before a whitespace
+// character and a rune that are still incomplete
+func TestTransformerScanPosition(t *testing.T) {
+	pdNormalizer := MustNew(mapStreamConfigs["clusters"])
+	sInput := strings.Repeat("wörd\u0301 ", 2000) + strings.Repeat("日本語", 2000) + " end"
+	pdTransformer, err := NewTransformer(pdNormalizer, len(sInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dBuilder strings.Builder
+	abDst := make([]byte, len(sInput)*2)
+	for iIndex := range len(sInput) {
+		iWritten, _, err := pdTransformer.Transform(abDst, []byte(sInput[iIndex:iIndex+1]), false)
+		if err != nil {
+			t.Fatalf("byte %d: %v", iIndex, err)
+		}
+		dBuilder.Write(abDst[:iWritten])
+		if iBehind := len(pdTransformer.abPending) - pdTransformer.iScanned; iBehind < 0 || iBehind > 2*utf8.UTFMax {
+			t.Fatalf("byte %d: scanned %d of %d pending bytes", iIndex, pdTransformer.iScanned, len(pdTransformer.abPending))
+		}
+	}
+	iWritten, _, err := pdTransformer.Transform(abDst, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dBuilder.Write(abDst[:iWritten])
+	if sExpected := pdNormalizer.Normalize(sInput); dBuilder.String() != sExpected {
+		t.Errorf("got %d bytes, want %d bytes matching Normalize", dBuilder.Len(), len(sExpected))
+	}
+	if pdTransformer.iScanned != 0 {
+		t.Errorf("scan position %d left after the end of the stream", pdTransformer.iScanned)
+	}
+}
+
+// TestTransformerRejectsReplacements checks the replacement rules that cannot be streamed
+func TestTransformerRejectsReplacements(t *testing.T) {
+	for _, dataReplacement := range []Replacement{
+		{Pattern: `\s+`, Replacement: " ", Regex: true},
+		{Pattern: `a.b`, Replacement: "x", Regex: true},
+		{Pattern: `^x`, Replacement: "y", Regex: true},
+		{Pattern: `x*`, Replacement: "y", Regex: true},
+		{Pattern: "a b", Replacement: "ab"},
+		{Pattern: "e", Replacement: "́"},
+	} {
+		dataConfig := DefaultConfig()
+		dataConfig.Replacements = []Replacement{dataReplacement}
+		if _, err := NewTransformer(MustNew(dataConfig), 0); err == nil {
+			t.Errorf("replacement %+v was accepted", dataReplacement)
+		}
+	}
+}
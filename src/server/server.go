@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,9 +12,8 @@ import (
 	"bpe"
 )
 
-// Global variable to store the merges and decoder maps
-var mapMerges map[string]interface{}
-var mapDecoder map[int64]string
+// Global variable to store the tokenizer loaded from the artifact
+var pdTokenizer *bpe.Tokenizer
 var pdSync sync.Once
 
 // enableCORS sets the necessary headers for Cross-Origin Resource Sharing
@@ -23,20 +23,28 @@ func enableCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 }
 
-// Launch the server
-func Launch() {
-	// Pre-load the merges map
+// Launch the server with the given merges artifact, caching up to iCacheSize chunk encodings
+func Launch(sArtifactPath string, iCacheSize int) {
+	// Pre-load the tokenizer
 	pdSync.Do(func() {
 		var err error
-		mapMerges, mapDecoder, err = bpe.LoadMaps()
+		pdTokenizer, err = bpe.LoadTokenizer(sArtifactPath)
 		if err != nil {
-			log.Fatalf("Failed to load merges map: %s", err)
+			log.Fatalf("Failed to load tokenizer: %s", err)
 		}
+		pdTokenizer = pdTokenizer.WithCache(iCacheSize)
+
+		// say which artifact is served, so a mismatched one is noticed at startup
+		dataMetadata := pdTokenizer.Metadata()
+		fmt.Printf("Loaded %s: format version %d, vocabulary of %d, created %s\n", sArtifactPath, dataMetadata.Version, dataMetadata.VocabSize, createdAt(dataMetadata))
 	})
 
 	// Set up handlers with CORS middleware
 	http.HandleFunc("/encode", encodeHandler)
 	http.HandleFunc("/decode", decodeHandler)
+	http.HandleFunc("/count", countHandler)
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/metadata", metadataHandler)
 
 	fmt.Println("Server starting on :8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -46,10 +54,21 @@ func Launch() {
 
 // Response structure for the encode endpoint
 type EncodeResponse struct {
-	Tokens            []int64  `json:"tokens"`
-	TokenTexts        []string `json:"token_texts"`
-	ComputationTimeMs string   `json:"computation_time_ms"`
-	ComputationTimeS  float64  `json:"computation_seconds"`
+	Tokens            []int64        `json:"tokens"`
+	TokenTexts        []string       `json:"token_texts"`
+	Offsets           []bpe.Offset   `json:"offsets"`
+	AttentionMask     []int          `json:"attention_mask"`
+	TypeIDs           []int          `json:"type_ids"`
+	Overflowing       []bpe.Encoding `json:"overflowing,omitempty"`
+	ComputationTimeMs string         `json:"computation_time_ms"`
+	ComputationTimeS  float64        `json:"computation_seconds"`
+}
+
+// Request structure for the encode endpoint when encoding options are given
+type EncodeRequest struct {
+	Text     string  `json:"text"`
+	TextPair *string `json:"text_pair,omitempty"`
+	bpe.EncodeOptions
 }
 
 // encodeHandler handles the /encode endpoint
@@ -69,39 +88,49 @@ func encodeHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
 		return
 	}
 
-	// Retrieve the input string from the HTTP request
-	var sInput string
-	if err := json.NewDecoder(pdRequest.Body).Decode(&sInput); err != nil {
-		http.Error(dataWriter, "Invalid input, expected a JSON string", http.StatusBadRequest)
+	// Retrieve the input from the HTTP request: a JSON string, or an object with the text and encoding options
+	var abBody json.RawMessage
+	var request EncodeRequest
+	if err := json.NewDecoder(pdRequest.Body).Decode(&abBody); err != nil {
+		http.Error(dataWriter, "Invalid input, expected a JSON string or object", http.StatusBadRequest)
 		return
 	}
-
-	// get a part of it
-	convertedMap, tfOK := mapMerges["merges"].(map[string]interface{})
-	if !tfOK {
-		http.Error(dataWriter, "Failed to convert map: merges key not found or not a map", http.StatusInternalServerError)
+	if err := json.Unmarshal(abBody, &request.Text); err != nil {
+		if err := json.Unmarshal(abBody, &request); err != nil {
+			http.Error(dataWriter, "Invalid input, expected a JSON string or object", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := request.Validate(); err != nil {
+		http.Error(dataWriter, fmt.Sprintf("Invalid input: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	// Call bpe.Encode() with the input string
+	// Encode the input string or pair, applying the template, truncation and padding as asked
 	startTime := time.Now()
-	alEncodedTokens, err := bpe.Encode(convertedMap, sInput)
+	var dataEncoding bpe.Encoding
+	var err error
+	if request.TextPair != nil {
+		dataEncoding, err = pdTokenizer.EncodePairWithOptions(request.Text, *request.TextPair, request.EncodeOptions)
+	} else {
+		dataEncoding, err = pdTokenizer.EncodeWithOptions(request.Text, request.EncodeOptions)
+	}
 	if err != nil {
-		http.Error(dataWriter, fmt.Sprintf("Encoding error: %v", err), http.StatusInternalServerError)
+		http.Error(dataWriter, fmt.Sprintf("Encoding error: %v", err), http.StatusBadRequest)
 		return
 	}
 
 	// Convert tokens to text representations
-	asTokenTexts, err := bpe.ListToTokens(alEncodedTokens, convertedMap)
-	if err != nil {
-		http.Error(dataWriter, fmt.Sprintf("Token text conversion error: %v", err), http.StatusInternalServerError)
-		return
-	}
+	asTokenTexts := pdTokenizer.TokenTexts(dataEncoding.Tokens)
 	totalComputationTime := time.Since(startTime)
 
 	dataResponse := EncodeResponse{
-		Tokens:            alEncodedTokens,
+		Tokens:            dataEncoding.Tokens,
 		TokenTexts:        asTokenTexts,
+		Offsets:           dataEncoding.Offsets,
+		AttentionMask:     dataEncoding.AttentionMask,
+		TypeIDs:           dataEncoding.TypeIDs,
+		Overflowing:       dataEncoding.Overflowing,
 		ComputationTimeMs: bpe.FormatDuration(totalComputationTime),
 		ComputationTimeS:  totalComputationTime.Seconds(),
 	}
@@ -117,6 +146,7 @@ func encodeHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
 // Request structure for the decode endpoint
 type DecodeRequest struct {
 	Tokens []int64 `json:"tokens"`
+	bpe.DecodeOptions
 }
 
 // decodeHandler handles the /decode endpoint
@@ -143,9 +173,19 @@ func decodeHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
 		return
 	}
 
-	// Call bpe.Decode() with the input tokens
+	if err := request.Validate(); err != nil {
+		http.Error(dataWriter, fmt.Sprintf("Invalid input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Decode the input tokens, rejecting ids outside the vocabulary in strict mode
 	startTime := time.Now()
-	sDecodedString, err := bpe.Decode(mapDecoder, request.Tokens)
+	sDecodedString, err := pdTokenizer.DecodeWithOptions(request.Tokens, request.DecodeOptions)
+	var pdInvalid *bpe.InvalidTokensError
+	if errors.As(err, &pdInvalid) {
+		http.Error(dataWriter, fmt.Sprintf("Decoding error: %v", err), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(dataWriter, fmt.Sprintf("Decoding error: %v", err), http.StatusInternalServerError)
 		return
@@ -171,3 +211,129 @@ func decodeHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
 		return
 	}
 }
+
+// Response structure for the count endpoint; Count is set for a single input and Counts for a batch
+type CountResponse struct {
+	Count             *int    `json:"count,omitempty"`
+	Counts            []int   `json:"counts,omitzero"`
+	ComputationTimeMs string  `json:"computation_time_ms"`
+	ComputationTimeS  float64 `json:"computation_seconds"`
+}
+
+// countHandler handles the /count endpoint
+func countHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
+	// Enable CORS for all requests
+	enableCORS(dataWriter)
+
+	// Handle preflight OPTIONS request
+	if pdRequest.Method == http.MethodOptions {
+		dataWriter.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Only accept POST requests
+	if pdRequest.Method != http.MethodPost {
+		http.Error(dataWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Retrieve the input from the HTTP request: a JSON string, or an array of strings for a batch
+	var abBody json.RawMessage
+	if err := json.NewDecoder(pdRequest.Body).Decode(&abBody); err != nil {
+		http.Error(dataWriter, "Invalid input, expected a JSON string or array of strings", http.StatusBadRequest)
+		return
+	}
+
+	// Count the tokens without building them
+	startTime := time.Now()
+	var dataResponse CountResponse
+	var sInput string
+	var asInputs []string
+	if err := json.Unmarshal(abBody, &sInput); err == nil {
+		iCount := pdTokenizer.Count(sInput)
+		dataResponse.Count = &iCount
+	} else if err := json.Unmarshal(abBody, &asInputs); err == nil {
+		aiCounts, err := pdTokenizer.CountBatch(pdRequest.Context(), asInputs, 0)
+		if err != nil {
+			http.Error(dataWriter, fmt.Sprintf("Counting error: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		dataResponse.Counts = aiCounts
+	} else {
+		http.Error(dataWriter, "Invalid input, expected a JSON string or array of strings", http.StatusBadRequest)
+		return
+	}
+	totalComputationTime := time.Since(startTime)
+	dataResponse.ComputationTimeMs = bpe.FormatDuration(totalComputationTime)
+	dataResponse.ComputationTimeS = totalComputationTime.Seconds()
+
+	// Return the counts as the HTTP response
+	dataWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(dataWriter).Encode(dataResponse); err != nil {
+		http.Error(dataWriter, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Response structure for the metrics endpoint
+type MetricsResponse struct {
+	Cache bpe.CacheStats `json:"cache"`
+}
+
+// metricsHandler handles the /metrics endpoint
+func metricsHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
+	// Enable CORS for all requests
+	enableCORS(dataWriter)
+
+	// Handle preflight OPTIONS request
+	if pdRequest.Method == http.MethodOptions {
+		dataWriter.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Only accept GET requests
+	if pdRequest.Method != http.MethodGet {
+		http.Error(dataWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Return the cache statistics
+	dataWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(dataWriter).Encode(MetricsResponse{Cache: pdTokenizer.CacheStats()}); err != nil {
+		http.Error(dataWriter, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// metadataHandler handles the /metadata endpoint
+func metadataHandler(dataWriter http.ResponseWriter, pdRequest *http.Request) {
+	// Enable CORS for all requests
+	enableCORS(dataWriter)
+
+	// Handle preflight OPTIONS request
+	if pdRequest.Method == http.MethodOptions {
+		dataWriter.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Only accept GET requests
+	if pdRequest.Method != http.MethodGet {
+		http.Error(dataWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Return the metadata of the served artifact
+	dataWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(dataWriter).Encode(pdTokenizer.Metadata()); err != nil {
+		http.Error(dataWriter, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// createdAt formats the creation time of an artifact, which artifacts before version 1 do not record
+func createdAt(dataMetadata bpe.Metadata) string {
+	if dataMetadata.CreatedAt.IsZero() {
+		return "at an unknown time"
+	}
+	return dataMetadata.CreatedAt.Format(time.RFC3339)
+}
@@ -0,0 +1,57 @@
+#!/usr/bin/env python3
+"""
+Verify HF export
+
+Check that a tokenizer.json exported with `go run main.go -func e -sample ...` reproduces the
+tokens Polyglot recorded for every sentence of the sample corpus.
+
+Usage: python tests/verify_hf.py tokenizer.json tokenizer.expected.jsonl
+"""
+
+# Imports
+import json
+import sys
+from tokenizers import Tokenizer
+
+# Global variables
+MAX_REPORTED = 10
+
+# --------------------------------------------------------------------------- #
+def first_difference(actual, expected):
+    for index, (actual_id, expected_id) in enumerate(zip(actual, expected)):
+        if actual_id != expected_id:
+            return index
+    return min(len(actual), len(expected))
+
+# --------------------------------------------------------------------------- #
+def main(tokenizer_path, expected_path):
+    tokenizer = Tokenizer.from_file(tokenizer_path)
+
+    # Polyglot does not look for special tokens in the text it encodes
+    tokenizer.encode_special_tokens = True
+
+    total = 0
+    mismatches = 0
+    with open(expected_path, encoding="utf-8") as expected_file:
+        for line in expected_file:
+            record = json.loads(line)
+            actual = tokenizer.encode(record["text"], add_special_tokens=False).ids
+            total += 1
+            if actual == record["tokens"]:
+                continue
+
+            # Report where the first few mismatches start
+            mismatches += 1
+            if mismatches <= MAX_REPORTED:
+                index = first_difference(actual, record["tokens"])
+                print(f"[{record['language']}] {record['text']!r}")
+                print(f"  token {index}: expected {record['tokens'][index:index + 5]}, got {actual[index:index + 5]}")
+
+    print(f"{total - mismatches}/{total} sentences match")
+    return 1 if mismatches else 0
+
+if __name__ == "__main__":
+    if len(sys.argv) != 3:
+        print(__doc__.strip().splitlines()[-1])
+        sys.exit(2)
+    sys.exit(main(sys.argv[1], sys.argv[2]))